@@ -13,6 +13,7 @@ import (
 	"github.com/jnd-labs/aiblackbox/internal/audit"
 	"github.com/jnd-labs/aiblackbox/internal/config"
 	"github.com/jnd-labs/aiblackbox/internal/proxy"
+	"github.com/jnd-labs/aiblackbox/internal/tlsutil"
 )
 
 const (
@@ -24,8 +25,12 @@ const (
 	shutdownTimeout = 30 * time.Second
 )
 
+// version is the build version recorded in the startup audit entry
+// Set at build time: go build -ldflags "-X main.version=v1.2.0"
+var version = "dev"
+
 func main() {
-	log.Println("Starting AIBlackBox Proxy...")
+	log.Printf("Starting AIBlackBox Proxy %s...", version)
 
 	// Load configuration
 	cfg, err := config.Load()
@@ -35,7 +40,15 @@ func main() {
 
 	log.Printf("Configuration loaded: %d endpoints defined", len(cfg.Endpoints))
 	for _, ep := range cfg.Endpoints {
-		log.Printf("  - %s -> %s", ep.Name, ep.Target)
+		for _, t := range ep.Upstreams() {
+			log.Printf("  - %s -> %s", ep.Name, t.URL)
+		}
+	}
+
+	if cfg.ForwardProxy.Enabled {
+		for _, fh := range cfg.ForwardProxy.Hosts {
+			log.Printf("  - CONNECT %s -> %s", fh.Host, fh.Endpoint)
+		}
 	}
 
 	// Initialize storage
@@ -52,28 +65,64 @@ func main() {
 	// Create prox handler
 	handler := proxy.NewHandler(cfg, auditWorker)
 
+	// Open the audit trail of this run with the effective configuration
+	handler.RecordStartup(version)
+
 	// Create HTTP server
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler:      handler,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  120 * time.Second,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout) * time.Second,
+	}
+
+	// Serve HTTPS when a certificate is configured; the certificate is reloaded when renewed
+	if cfg.Server.TLS.Enabled() {
+		tlsConfig, err := tlsutil.ServerConfig(cfg.Server.TLS)
+		if err != nil {
+			log.Fatalf("Failed to load TLS configuration: %v", err)
+		}
+		server.TLSConfig = tlsConfig
 	}
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Server listening on port %d", cfg.Server.Port)
-		log.Println("Ready to proxy requests")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if server.TLSConfig != nil {
+			log.Printf("Server listening on port %d (HTTPS)", cfg.Server.Port)
+			log.Println("Ready to proxy requests")
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Server listening on port %d", cfg.Server.Port)
+			log.Println("Ready to proxy requests")
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server error: %v", err)
 		}
 	}()
 
-	// Wait for interrupt signal
+	// Reload endpoints, routing and policies when the config file changes or on SIGHUP
+	watcher, err := config.Watch(handler.Reload)
+	if err != nil {
+		log.Fatalf("Failed to watch configuration: %v", err)
+	}
+	if watcher.Path() != "" {
+		log.Printf("Watching %s for configuration changes", watcher.Path())
+	}
+
+	// Wait for interrupt signal; SIGHUP reloads the configuration
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		log.Println("SIGHUP received, reloading configuration...")
+		watcher.Reload("SIGHUP")
+	}
+	watcher.Close()
 
 	log.Println("Shutdown signal received, gracefully shutting down...")
 
@@ -86,6 +135,9 @@ func main() {
 		log.Printf("Error during server shutdown: %v", err)
 	}
 
+	// Persist budget consumption
+	handler.Shutdown()
+
 	// Shutdown audit worker (processes remaining entries)
 	log.Println("Flushing remaining audit entries...")
 	auditWorker.Shutdown()
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jnd-labs/aiblackbox/internal/redact"
+)
+
+// Exit codes
+const (
+	ExitSuccess       = 0
+	ExitUsageError    = 1
+	ExitVaultError    = 2
+	ExitTokenNotFound = 3
+)
+
+var (
+	vaultFile = flag.String("vault", "vault/redaction.jsonl", "Path to the redaction vault file")
+	keyEnv    = flag.String("key-env", "REDACTION_VAULT_KEY", "Environment variable holding the vault key")
+)
+
+// reveal prints the original values of redaction tokens such as [TOKEN:email:3f2a9c4e1b7d8a06]
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] TOKEN...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(ExitUsageError)
+	}
+
+	key := os.Getenv(*keyEnv)
+	if key == "" {
+		fmt.Fprintf(os.Stderr, "❌ Vault key not set: %s is empty\n", *keyEnv)
+		os.Exit(ExitUsageError)
+	}
+
+	vault, err := redact.OpenVault(*vaultFile, []byte(key))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to open vault: %v\n", err)
+		os.Exit(ExitVaultError)
+	}
+
+	exitCode := ExitSuccess
+	for _, arg := range flag.Args() {
+		token := parseToken(arg)
+		detectorName, value, err := vault.Lookup(token)
+		switch {
+		case errors.Is(err, redact.ErrTokenNotFound):
+			fmt.Fprintf(os.Stderr, "❌ %s: not found in vault\n", token)
+			exitCode = ExitTokenNotFound
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(ExitVaultError)
+		default:
+			fmt.Printf("%s\t%s\t%s\n", token, detectorName, value)
+		}
+	}
+	os.Exit(exitCode)
+}
+
+// parseToken accepts a bare token or a full [TOKEN:detector:token] placeholder
+func parseToken(arg string) string {
+	if strings.HasPrefix(arg, "[TOKEN:") && strings.HasSuffix(arg, "]") {
+		parts := strings.Split(strings.TrimSuffix(arg, "]"), ":")
+		return parts[len(parts)-1]
+	}
+	return arg
+}
@@ -9,6 +9,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+
+	"github.com/jnd-labs/aiblackbox/internal/media"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+	"github.com/jnd-labs/aiblackbox/internal/proxy"
 )
 
 // LogEntry represents a single audit log entry with blockchain-like chaining
@@ -17,28 +22,53 @@ type LogEntry struct {
 	Endpoint  string `json:"endpoint"`
 	Request   struct {
 		Body string `json:"body"`
+		URL  string `json:"url,omitempty"`
 	} `json:"request"`
 	Response struct {
 		Body       string `json:"body"`
 		StatusCode int    `json:"status_code"`
 		Error      string `json:"error,omitempty"`
 		IsComplete bool   `json:"is_complete"`
+		// Preserved raw SSE transcript (optional)
+		MediaReferences []models.MediaReference    `json:"media_references,omitempty"`
+		RawStream       *models.RawStreamReference `json:"raw_stream,omitempty"`
 	} `json:"response"`
 	// Trace field is now part of the integrity check
-	Trace    *TraceContext `json:"trace,omitempty"`
-	PrevHash string        `json:"prev_hash"`
-	Hash     string        `json:"hash"`
+	Trace *TraceContext `json:"trace,omitempty"`
+	// Upstream routing (optional)
+	Upstream *models.UpstreamDetails `json:"upstream,omitempty"`
+	// Token usage and cost (optional)
+	Usage *models.TokenUsage `json:"usage,omitempty"`
+	// Authenticated client (optional)
+	Principal *models.Principal `json:"principal,omitempty"`
+	// WebSocket session transcript (optional)
+	WebSocket *models.WebSocketSession `json:"websocket,omitempty"`
+	// Redacted personal data and secrets (optional)
+	Redactions []models.RedactionFinding `json:"redactions,omitempty"`
+	// Request policy decision (optional)
+	Policy *models.PolicyDecision `json:"policy,omitempty"`
+	// Response guardrail findings (optional)
+	Findings []models.Finding `json:"findings,omitempty"`
+	// Proxy event such as a configuration reload (optional)
+	System   *models.SystemEvent `json:"system,omitempty"`
+	PrevHash string              `json:"prev_hash"`
+	Hash     string              `json:"hash"`
 }
 
 // TraceContext represents distributed tracing metadata
 type TraceContext struct {
-	TraceID      string          `json:"trace_id,omitempty"`
-	SpanID       string          `json:"span_id,omitempty"`
-	ParentSpanID string          `json:"parent_span_id,omitempty"`
-	SpanType     string          `json:"span_type,omitempty"`
-	SpanName     string          `json:"span_name,omitempty"`
-	ToolCall     *ToolCallInfo   `json:"tool_call,omitempty"`
-	ToolResult   *ToolResultInfo `json:"tool_result,omitempty"`
+	TraceID      string           `json:"trace_id,omitempty"`
+	SpanID       string           `json:"span_id,omitempty"`
+	ParentSpanID string           `json:"parent_span_id,omitempty"`
+	SpanType     string           `json:"span_type,omitempty"`
+	SpanName     string           `json:"span_name,omitempty"`
+	ToolCall     *ToolCallInfo    `json:"tool_call,omitempty"`
+	ToolResult   *ToolResultInfo  `json:"tool_result,omitempty"`
+	ToolCalls    []ToolCallInfo   `json:"tool_calls,omitempty"`
+	ToolResults  []ToolResultInfo `json:"tool_results,omitempty"`
+
+	Documents []models.DocumentInfo `json:"documents,omitempty"`
+	Attempts  []models.AttemptSpan  `json:"attempts,omitempty"`
 }
 
 // ToolCallInfo represents a tool invocation
@@ -46,6 +76,7 @@ type ToolCallInfo struct {
 	ID       string       `json:"id"`
 	Type     string       `json:"type"`
 	Function FunctionCall `json:"function"`
+	SpanID   string       `json:"span_id,omitempty"`
 }
 
 // FunctionCall represents a function invocation
@@ -56,9 +87,12 @@ type FunctionCall struct {
 
 // ToolResultInfo represents the result of a tool execution
 type ToolResultInfo struct {
-	ToolCallID  string `json:"tool_call_id"`
-	ContentHash string `json:"content_hash"`
-	IsError     bool   `json:"is_error,omitempty"`
+	ToolCallID     string   `json:"tool_call_id"`
+	ContentHash    string   `json:"content_hash"`
+	IsError        bool     `json:"is_error,omitempty"`
+	LinkedSpanID   string   `json:"linked_span_id,omitempty"`
+	InjectionRisk  int      `json:"injection_risk,omitempty"`
+	InjectionRules []string `json:"injection_rules,omitempty"`
 }
 
 // Exit codes
@@ -69,12 +103,14 @@ const (
 	ExitDataTampered = 3
 	ExitParseError   = 4
 	ExitScanError    = 5
+	ExitStreamBroken = 6
 )
 
 var (
-	logFile = flag.String("file", "logs/audit.jsonl", "Path to the audit log file")
-	verbose = flag.Bool("verbose", false, "Enable verbose output for each line")
-	quiet   = flag.Bool("quiet", false, "Suppress all output except errors")
+	logFile  = flag.String("file", "logs/audit.jsonl", "Path to the audit log file")
+	verbose  = flag.Bool("verbose", false, "Enable verbose output for each line")
+	quiet    = flag.Bool("quiet", false, "Suppress all output except errors")
+	mediaDir = flag.String("media-dir", "logs/media", "Directory containing extracted media and raw stream sidecar files")
 )
 
 func main() {
@@ -96,13 +132,15 @@ func verifyLog(filename string) error {
 	scanner := bufio.NewScanner(file)
 
 	// Set maximum buffer size for large log entries (default is 64KB)
-	const maxScanTokenSize = 1024 * 1024 // 1MB
+	// Entries with preserved raw streams can exceed the body size limit
+	const maxScanTokenSize = 64 * 1024 * 1024 // 64MB
 	buf := make([]byte, maxScanTokenSize)
 	scanner.Buffer(buf, maxScanTokenSize)
 
 	var expectedPrevHash string
 	lineNum := 0
 	errorCount := 0
+	streamsVerified := 0
 
 	for scanner.Scan() {
 		lineNum++
@@ -136,6 +174,16 @@ func verifyLog(filename string) error {
 			os.Exit(ExitDataTampered)
 		}
 
+		// Re-run reconstruction on the preserved raw stream and compare with the stored body
+		if entry.Response.RawStream != nil {
+			if err := verifyRawStream(&entry); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ STREAM RECONSTRUCTION MISMATCH at line %d!\n", lineNum)
+				fmt.Fprintf(os.Stderr, "   %v\n", err)
+				os.Exit(ExitStreamBroken)
+			}
+			streamsVerified++
+		}
+
 		expectedPrevHash = entry.Hash
 
 		if *verbose && !*quiet {
@@ -157,12 +205,39 @@ func verifyLog(filename string) error {
 		fmt.Printf("   Total entries verified: %d\n", lineNum)
 		fmt.Printf("   Chain integrity: INTACT\n")
 		fmt.Printf("   Data integrity: VERIFIED\n")
+		if streamsVerified > 0 {
+			fmt.Printf("   Raw streams re-reconstructed: %d\n", streamsVerified)
+		}
 	}
 
 	os.Exit(ExitSuccess)
 	return nil
 }
 
+// verifyRawStream decodes the preserved raw SSE transcript, checks its hash, re-runs
+// stream reconstruction and confirms the result matches the stored response body
+func verifyRawStream(entry *LogEntry) error {
+	raw, err := proxy.LoadRawStream(entry.Response.RawStream, *mediaDir)
+	if err != nil {
+		return err
+	}
+
+	reconstructed, ok := proxy.ReconstructStream(raw)
+	if !ok {
+		return fmt.Errorf("raw stream could not be reconstructed")
+	}
+
+	// Apply the same media extraction placeholders as the stored body
+	reconstructed = media.ApplyReferences(reconstructed, entry.Response.MediaReferences)
+
+	if reconstructed != entry.Response.Body {
+		return fmt.Errorf("reconstructed body (%d bytes) differs from stored body (%d bytes)",
+			len(reconstructed), len(entry.Response.Body))
+	}
+
+	return nil
+}
+
 // calculateHash computes the SHA-256 hash of a log entry
 // Must match the calculation in internal/audit/worker.go exactly
 func calculateHash(entry *LogEntry) string {
@@ -181,6 +256,119 @@ func calculateHash(entry *LogEntry) string {
 		h.Write([]byte("false"))
 	}
 
+	// Include the client request URL (empty in entries written before it was recorded)
+	h.Write([]byte(entry.Request.URL))
+
+	// Include the preserved raw stream transcript hash if present
+	if entry.Response.RawStream != nil {
+		h.Write([]byte(entry.Response.RawStream.SHA256))
+	}
+
+	// Include token usage and cost if present
+	if entry.Usage != nil {
+		h.Write([]byte(entry.Usage.Model))
+		h.Write([]byte(strconv.FormatInt(entry.Usage.PromptTokens, 10)))
+		h.Write([]byte(strconv.FormatInt(entry.Usage.CompletionTokens, 10)))
+		h.Write([]byte(strconv.FormatInt(entry.Usage.TotalTokens, 10)))
+		h.Write([]byte(strconv.FormatInt(entry.Usage.CachedTokens, 10)))
+		h.Write([]byte(strconv.FormatInt(entry.Usage.ReasoningTokens, 10)))
+		if entry.Usage.CostUSD != nil {
+			h.Write([]byte(strconv.FormatFloat(*entry.Usage.CostUSD, 'f', -1, 64)))
+			h.Write([]byte(entry.Usage.PricedAs))
+		}
+	}
+
+	// Include upstream routing if present
+	if entry.Upstream != nil {
+		h.Write([]byte(entry.Upstream.Target))
+		h.Write([]byte(entry.Upstream.URL))
+		for _, a := range entry.Upstream.Attempts {
+			h.Write([]byte(a.Target))
+			h.Write([]byte(strconv.Itoa(a.StatusCode)))
+			h.Write([]byte(a.Error))
+			h.Write([]byte(a.Outcome))
+			h.Write([]byte(a.SpanID))
+			if a.BackoffMs > 0 {
+				h.Write([]byte(strconv.FormatInt(a.BackoffMs, 10)))
+			}
+		}
+	}
+
+	// Include the authenticated principal if present
+	if entry.Principal != nil {
+		h.Write([]byte(entry.Principal.ID))
+		h.Write([]byte(entry.Principal.Method))
+		h.Write([]byte(entry.Principal.Issuer))
+	}
+
+	// Include the WebSocket session transcript if present
+	if entry.WebSocket != nil {
+		ws := entry.WebSocket
+		h.Write([]byte(ws.Subprotocol))
+		h.Write([]byte(strconv.Itoa(ws.CloseCode)))
+		h.Write([]byte(ws.CloseReason))
+		h.Write([]byte(ws.ClosedBy))
+		h.Write([]byte(strconv.FormatBool(ws.Truncated)))
+		for _, ev := range ws.Events {
+			h.Write([]byte(ev.Direction))
+			h.Write([]byte(strconv.FormatInt(ev.OffsetMs, 10)))
+			h.Write([]byte(ev.Opcode))
+			h.Write([]byte(ev.Type))
+			h.Write([]byte(strconv.FormatInt(ev.Size, 10)))
+			h.Write([]byte(ev.Payload))
+			h.Write([]byte(strconv.FormatBool(ev.Truncated)))
+		}
+		for _, audio := range ws.Audio {
+			h.Write([]byte(audio.SHA256))
+			h.Write([]byte(strconv.FormatInt(audio.SizeBytes, 10)))
+		}
+	}
+
+	// Include the system event if present
+	if entry.System != nil {
+		h.Write([]byte(entry.System.Type))
+		h.Write([]byte(entry.System.ConfigHash))
+		for _, change := range entry.System.Changes {
+			h.Write([]byte(change))
+		}
+		h.Write(entry.System.Config)
+		h.Write([]byte(entry.System.Version))
+		h.Write([]byte(entry.System.Host))
+	}
+
+	// Include redaction findings if present
+	for _, f := range entry.Redactions {
+		h.Write([]byte(f.Detector))
+		h.Write([]byte(f.Location))
+		h.Write([]byte(strconv.Itoa(f.Start)))
+		h.Write([]byte(strconv.Itoa(f.End)))
+		h.Write([]byte(f.Token))
+	}
+
+	// Include the policy decision if present
+	if entry.Policy != nil {
+		h.Write([]byte(entry.Policy.Action))
+		h.Write([]byte(entry.Policy.Rule))
+		for _, m := range entry.Policy.Matches {
+			h.Write([]byte(m.Rule))
+			h.Write([]byte(m.Action))
+			for _, reason := range m.Reasons {
+				h.Write([]byte(reason))
+			}
+		}
+		for _, mutation := range entry.Policy.Mutations {
+			h.Write([]byte(mutation))
+		}
+	}
+
+	// Include guardrail findings if present
+	for _, f := range entry.Findings {
+		h.Write([]byte(f.Rule))
+		h.Write([]byte(f.Action))
+		h.Write([]byte(f.Kind))
+		h.Write([]byte(f.Value))
+	}
+
 	// Include trace context if present (maintains backward compatibility)
 	if entry.Trace != nil {
 		h.Write([]byte(entry.Trace.TraceID))
@@ -207,6 +395,47 @@ func calculateHash(entry *LogEntry) string {
 				h.Write([]byte("false"))
 			}
 		}
+
+		// Include every parallel tool call and tool result
+		for _, tc := range entry.Trace.ToolCalls {
+			h.Write([]byte(tc.ID))
+			h.Write([]byte(tc.Type))
+			h.Write([]byte(tc.Function.Name))
+			h.Write([]byte(tc.Function.ArgumentsHash))
+			h.Write([]byte(tc.SpanID))
+		}
+		for _, tr := range entry.Trace.ToolResults {
+			h.Write([]byte(tr.ToolCallID))
+			h.Write([]byte(tr.ContentHash))
+			if tr.IsError {
+				h.Write([]byte("true"))
+			} else {
+				h.Write([]byte("false"))
+			}
+			h.Write([]byte(tr.LinkedSpanID))
+			if tr.InjectionRisk > 0 {
+				h.Write([]byte(strconv.Itoa(tr.InjectionRisk)))
+			}
+			for _, rule := range tr.InjectionRules {
+				h.Write([]byte(rule))
+			}
+		}
+		for _, d := range entry.Trace.Documents {
+			h.Write([]byte(strconv.Itoa(d.Index)))
+			h.Write([]byte(d.ContentHash))
+			h.Write([]byte(strconv.Itoa(d.InjectionRisk)))
+			for _, rule := range d.InjectionRules {
+				h.Write([]byte(rule))
+			}
+		}
+		for _, a := range entry.Trace.Attempts {
+			h.Write([]byte(a.SpanID))
+			h.Write([]byte(strconv.Itoa(a.Attempt)))
+			h.Write([]byte(a.Target))
+			h.Write([]byte(strconv.Itoa(a.StatusCode)))
+			h.Write([]byte(a.Error))
+			h.Write([]byte(a.Outcome))
+		}
 	}
 
 	h.Write([]byte(entry.PrevHash))
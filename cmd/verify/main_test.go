@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/audit"
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+	"github.com/jnd-labs/aiblackbox/internal/proxy"
+)
+
+// splitEmailSSE streams an email address split across two deltas, so no single event contains it
+const splitEmailSSE = `data: {"id":"chatcmpl-split","object":"chat.completion.chunk","created":1,"model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","content":"Contact john.doe"},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-split","object":"chat.completion.chunk","created":1,"model":"gpt-4","choices":[{"index":0,"delta":{"content":"@example.com today"},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-split","object":"chat.completion.chunk","created":1,"model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`
+
+// TestVerifyProcess runs the verifier in a child process, as verifyLog exits the process
+func TestVerifyProcess(t *testing.T) {
+	if os.Getenv("AIBLACKBOX_VERIFY_PROCESS") != "1" {
+		t.Skip("only run as the child process of runVerify")
+	}
+	verifyLog(*logFile)
+}
+
+// runVerify verifies the log file and returns the exit code of the verifier
+func runVerify(t *testing.T, logPath, mediaPath string) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestVerifyProcess$", "-file", logPath, "-media-dir", mediaPath, "-quiet")
+	cmd.Env = append(os.Environ(), "AIBLACKBOX_VERIFY_PROCESS=1")
+	output, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		t.Logf("verify output: %s", output)
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("Failed to run verify: %v", err)
+	}
+	return ExitSuccess
+}
+
+// TestVerifyRedactedStream verifies streamed values split across events do not leak into the
+// audit log when redaction is enabled, and that the log still verifies
+func TestVerifyRedactedStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		redaction bool
+	}{
+		{"redaction enabled", true},
+		{"redaction disabled", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(splitEmailSSE))
+			}))
+			defer backend.Close()
+
+			dir := t.TempDir()
+			logPath := filepath.Join(dir, "audit.jsonl")
+			mediaPath := filepath.Join(dir, "media")
+
+			cfg := &config.Config{
+				Server:    config.ServerConfig{Port: 8080, GenesisSeed: "test-seed"},
+				Endpoints: []config.EndpointConfig{{Name: "test", Target: backend.URL}},
+				Storage:   config.StorageConfig{Path: logPath},
+				Streaming: config.StreamingConfig{
+					MaxAuditBodySize:  10485760,
+					StreamTimeout:     300,
+					PreserveRawStream: true,
+				},
+				Media:     config.MediaConfig{StoragePath: mediaPath},
+				Redaction: config.RedactionConfig{Enabled: tt.redaction},
+			}
+
+			storage, err := audit.NewFileStorage(logPath)
+			if err != nil {
+				t.Fatalf("Failed to create storage: %v", err)
+			}
+			worker := audit.NewWorker(storage, cfg.Server.GenesisSeed, 10)
+			handler := proxy.NewHandler(cfg, worker)
+
+			// Both the streaming and the regular handler reconstruct the stream
+			for _, body := range []string{`{"stream":true}`, `{}`} {
+				req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(body))
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			handler.Shutdown()
+			worker.Shutdown()
+			storage.Close()
+
+			data, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatalf("Failed to read audit log: %v", err)
+			}
+			if n := strings.Count(string(data), "\n"); n != 2 {
+				t.Fatalf("Expected 2 audit entries, got %d", n)
+			}
+
+			if tt.redaction {
+				if strings.Contains(string(data), "john.doe") || strings.Contains(string(data), "raw_stream") {
+					t.Errorf("Redacted log should not contain the address or a raw stream: %s", data)
+				}
+				if !strings.Contains(string(data), "[REDACTED:email]") {
+					t.Errorf("Expected the reassembled address to be redacted: %s", data)
+				}
+			} else if strings.Count(string(data), `"raw_stream"`) != 2 {
+				t.Errorf("Expected both raw streams to be preserved: %s", data)
+			}
+
+			if code := runVerify(t, logPath, mediaPath); code != ExitSuccess {
+				t.Errorf("Expected verification to succeed, got exit code %d", code)
+			}
+		})
+	}
+}
+
+// TestVerifyDetectsRequestURLTampering verifies the recorded client URL is covered by the hash chain
+func TestVerifyDetectsRequestURLTampering(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "audit.jsonl")
+
+	storage, err := audit.NewFileStorage(logPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	worker.Log(&models.AuditEntry{
+		Timestamp: time.Now(),
+		Endpoint:  "test",
+		Request: models.RequestDetails{
+			Method: "POST",
+			Path:   "/v1/chat/completions",
+			URL:    "http://proxy.local/test/v1/chat/completions?api-version=2024-02-01",
+			Body:   `{}`,
+		},
+		Response: models.ResponseDetails{StatusCode: 200, IsComplete: true},
+	})
+	worker.Shutdown()
+	storage.Close()
+
+	if code := runVerify(t, logPath, dir); code != ExitSuccess {
+		t.Fatalf("Expected the untouched log to verify, got exit code %d", code)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	tampered := strings.Replace(string(data), "api-version=2024-02-01", "api-version=2023-05-15", 1)
+	if tampered == string(data) {
+		t.Fatal("Expected the request URL in the audit log")
+	}
+	if err := os.WriteFile(logPath, []byte(tampered), 0644); err != nil {
+		t.Fatalf("Failed to write audit log: %v", err)
+	}
+
+	if code := runVerify(t, logPath, dir); code != ExitDataTampered {
+		t.Errorf("Expected a modified request URL to be detected, got exit code %d", code)
+	}
+}
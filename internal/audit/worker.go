@@ -152,7 +152,8 @@ func (w *Worker) processEntry(entry *models.AuditEntry) {
 }
 
 // computeHash generates the SHA-256 hash for an audit entry
-// Hash = SHA256(Timestamp + Endpoint + RequestBody + ResponseBody + StatusCode + Error + IsComplete + TraceContext + PrevHash)
+// Hash = SHA256(Timestamp + Endpoint + RequestBody + ResponseBody + StatusCode + Error + IsComplete + RequestURL + Usage + Upstream + Principal + WebSocket + System + Redactions + Policy + Findings + TraceContext + PrevHash)
+// TraceContext covers the span fields plus every tool call, tool result and upstream attempt span
 func (w *Worker) computeHash(entry *models.AuditEntry) string {
 	h := sha256.New()
 
@@ -165,6 +166,119 @@ func (w *Worker) computeHash(entry *models.AuditEntry) string {
 	h.Write([]byte(entry.Response.Error))
 	h.Write([]byte(strconv.FormatBool(entry.Response.IsComplete)))
 
+	// Include the client request URL (empty in entries written before it was recorded)
+	h.Write([]byte(entry.Request.URL))
+
+	// Include the preserved raw stream transcript hash if present
+	if entry.Response.RawStream != nil {
+		h.Write([]byte(entry.Response.RawStream.SHA256))
+	}
+
+	// Include token usage and cost if present
+	if entry.Usage != nil {
+		h.Write([]byte(entry.Usage.Model))
+		h.Write([]byte(strconv.FormatInt(entry.Usage.PromptTokens, 10)))
+		h.Write([]byte(strconv.FormatInt(entry.Usage.CompletionTokens, 10)))
+		h.Write([]byte(strconv.FormatInt(entry.Usage.TotalTokens, 10)))
+		h.Write([]byte(strconv.FormatInt(entry.Usage.CachedTokens, 10)))
+		h.Write([]byte(strconv.FormatInt(entry.Usage.ReasoningTokens, 10)))
+		if entry.Usage.CostUSD != nil {
+			h.Write([]byte(strconv.FormatFloat(*entry.Usage.CostUSD, 'f', -1, 64)))
+			h.Write([]byte(entry.Usage.PricedAs))
+		}
+	}
+
+	// Include upstream routing if present
+	if entry.Upstream != nil {
+		h.Write([]byte(entry.Upstream.Target))
+		h.Write([]byte(entry.Upstream.URL))
+		for _, a := range entry.Upstream.Attempts {
+			h.Write([]byte(a.Target))
+			h.Write([]byte(strconv.Itoa(a.StatusCode)))
+			h.Write([]byte(a.Error))
+			h.Write([]byte(a.Outcome))
+			h.Write([]byte(a.SpanID))
+			if a.BackoffMs > 0 {
+				h.Write([]byte(strconv.FormatInt(a.BackoffMs, 10)))
+			}
+		}
+	}
+
+	// Include the authenticated principal if present
+	if entry.Principal != nil {
+		h.Write([]byte(entry.Principal.ID))
+		h.Write([]byte(entry.Principal.Method))
+		h.Write([]byte(entry.Principal.Issuer))
+	}
+
+	// Include the WebSocket session transcript if present
+	if entry.WebSocket != nil {
+		ws := entry.WebSocket
+		h.Write([]byte(ws.Subprotocol))
+		h.Write([]byte(strconv.Itoa(ws.CloseCode)))
+		h.Write([]byte(ws.CloseReason))
+		h.Write([]byte(ws.ClosedBy))
+		h.Write([]byte(strconv.FormatBool(ws.Truncated)))
+		for _, ev := range ws.Events {
+			h.Write([]byte(ev.Direction))
+			h.Write([]byte(strconv.FormatInt(ev.OffsetMs, 10)))
+			h.Write([]byte(ev.Opcode))
+			h.Write([]byte(ev.Type))
+			h.Write([]byte(strconv.FormatInt(ev.Size, 10)))
+			h.Write([]byte(ev.Payload))
+			h.Write([]byte(strconv.FormatBool(ev.Truncated)))
+		}
+		for _, audio := range ws.Audio {
+			h.Write([]byte(audio.SHA256))
+			h.Write([]byte(strconv.FormatInt(audio.SizeBytes, 10)))
+		}
+	}
+
+	// Include the system event if present
+	if entry.System != nil {
+		h.Write([]byte(entry.System.Type))
+		h.Write([]byte(entry.System.ConfigHash))
+		for _, change := range entry.System.Changes {
+			h.Write([]byte(change))
+		}
+		h.Write(entry.System.Config)
+		h.Write([]byte(entry.System.Version))
+		h.Write([]byte(entry.System.Host))
+	}
+
+	// Include redaction findings if present
+	for _, f := range entry.Redactions {
+		h.Write([]byte(f.Detector))
+		h.Write([]byte(f.Location))
+		h.Write([]byte(strconv.Itoa(f.Start)))
+		h.Write([]byte(strconv.Itoa(f.End)))
+		h.Write([]byte(f.Token))
+	}
+
+	// Include the policy decision if present
+	if entry.Policy != nil {
+		h.Write([]byte(entry.Policy.Action))
+		h.Write([]byte(entry.Policy.Rule))
+		for _, m := range entry.Policy.Matches {
+			h.Write([]byte(m.Rule))
+			h.Write([]byte(m.Action))
+			for _, reason := range m.Reasons {
+				h.Write([]byte(reason))
+			}
+		}
+		for _, mutation := range entry.Policy.Mutations {
+			h.Write([]byte(mutation))
+		}
+	}
+
+	// Include guardrail findings if present
+	for _, f := range entry.Findings {
+		h.Write([]byte(f.Rule))
+		h.Write([]byte(f.Action))
+		h.Write([]byte(f.Kind))
+		h.Write([]byte(f.Value))
+	}
+
 	// Include trace context if present (maintains backward compatibility)
 	if entry.Trace != nil {
 		h.Write([]byte(entry.Trace.TraceID))
@@ -187,6 +301,43 @@ func (w *Worker) computeHash(entry *models.AuditEntry) string {
 			h.Write([]byte(entry.Trace.ToolResult.ContentHash))
 			h.Write([]byte(strconv.FormatBool(entry.Trace.ToolResult.IsError)))
 		}
+
+		// Include every parallel tool call and tool result
+		for _, tc := range entry.Trace.ToolCalls {
+			h.Write([]byte(tc.ID))
+			h.Write([]byte(tc.Type))
+			h.Write([]byte(tc.Function.Name))
+			h.Write([]byte(tc.Function.ArgumentsHash))
+			h.Write([]byte(tc.SpanID))
+		}
+		for _, tr := range entry.Trace.ToolResults {
+			h.Write([]byte(tr.ToolCallID))
+			h.Write([]byte(tr.ContentHash))
+			h.Write([]byte(strconv.FormatBool(tr.IsError)))
+			h.Write([]byte(tr.LinkedSpanID))
+			if tr.InjectionRisk > 0 {
+				h.Write([]byte(strconv.Itoa(tr.InjectionRisk)))
+			}
+			for _, rule := range tr.InjectionRules {
+				h.Write([]byte(rule))
+			}
+		}
+		for _, d := range entry.Trace.Documents {
+			h.Write([]byte(strconv.Itoa(d.Index)))
+			h.Write([]byte(d.ContentHash))
+			h.Write([]byte(strconv.Itoa(d.InjectionRisk)))
+			for _, rule := range d.InjectionRules {
+				h.Write([]byte(rule))
+			}
+		}
+		for _, a := range entry.Trace.Attempts {
+			h.Write([]byte(a.SpanID))
+			h.Write([]byte(strconv.Itoa(a.Attempt)))
+			h.Write([]byte(a.Target))
+			h.Write([]byte(strconv.Itoa(a.StatusCode)))
+			h.Write([]byte(a.Error))
+			h.Write([]byte(a.Outcome))
+		}
 	}
 
 	h.Write([]byte(entry.PrevHash))
@@ -219,6 +219,371 @@ func TestHashIncludesErrorFields(t *testing.T) {
 	}
 }
 
+// TestHashIncludesAllToolCalls verifies every parallel tool call and result is covered by the hash
+func TestHashIncludesAllToolCalls(t *testing.T) {
+	worker := &Worker{}
+
+	newEntry := func(secondArgsHash, secondResultHash string) *models.AuditEntry {
+		entry := createTestEntry(0, "test")
+		entry.PrevHash = "prev"
+		entry.Trace = &models.TraceContext{
+			TraceID: "trace",
+			SpanID:  "span",
+			ToolCalls: []models.ToolCallInfo{
+				{ID: "call_a", Type: "function", Function: models.FunctionCall{Name: "a", ArgumentsHash: "hash_a"}},
+				{ID: "call_b", Type: "function", Function: models.FunctionCall{Name: "b", ArgumentsHash: secondArgsHash}, Index: 1},
+			},
+			ToolResults: []models.ToolResultInfo{
+				{ToolCallID: "call_x", ContentHash: "hash_x"},
+				{ToolCallID: "call_y", ContentHash: secondResultHash},
+			},
+		}
+		return entry
+	}
+
+	base := worker.computeHash(newEntry("hash_b", "hash_y"))
+
+	if worker.computeHash(newEntry("tampered", "hash_y")) == base {
+		t.Error("Hash should change when a non-first tool call is modified")
+	}
+
+	if worker.computeHash(newEntry("hash_b", "tampered")) == base {
+		t.Error("Hash should change when a non-first tool result is modified")
+	}
+}
+
+// TestHashIncludesUsage verifies token counts and cost are covered by the hash
+func TestHashIncludesUsage(t *testing.T) {
+	worker := &Worker{}
+
+	newEntry := func(completionTokens int64, cost float64) *models.AuditEntry {
+		entry := createTestEntry(0, "test")
+		entry.PrevHash = "prev"
+		entry.Usage = &models.TokenUsage{
+			Model:            "gpt-4o",
+			PromptTokens:     100,
+			CompletionTokens: completionTokens,
+			TotalTokens:      100 + completionTokens,
+			CostUSD:          &cost,
+			PricedAs:         "gpt-4o",
+		}
+		return entry
+	}
+
+	base := worker.computeHash(newEntry(50, 0.00075))
+
+	if worker.computeHash(newEntry(5, 0.00075)) == base {
+		t.Error("Hash should change when token counts are modified")
+	}
+
+	if worker.computeHash(newEntry(50, 0.0001)) == base {
+		t.Error("Hash should change when the cost is modified")
+	}
+
+	withoutUsage := newEntry(50, 0.00075)
+	withoutUsage.Usage = nil
+	if worker.computeHash(withoutUsage) == base {
+		t.Error("Hash should change when usage is removed")
+	}
+}
+
+// TestHashIncludesUpstream verifies the routing record is covered by the hash chain
+func TestHashIncludesUpstream(t *testing.T) {
+	worker := &Worker{}
+
+	newEntry := func(firstStatus int) *models.AuditEntry {
+		entry := createTestEntry(0, "test")
+		entry.PrevHash = "prev"
+		entry.Upstream = &models.UpstreamDetails{
+			Target: "http://b:8000",
+			Attempts: []models.UpstreamAttempt{
+				{Target: "http://a:8000", StatusCode: firstStatus},
+				{Target: "http://b:8000", StatusCode: 200},
+			},
+		}
+		return entry
+	}
+
+	base := worker.computeHash(newEntry(503))
+
+	if worker.computeHash(newEntry(500)) == base {
+		t.Error("Hash should change when an attempt status is modified")
+	}
+
+	served := newEntry(503)
+	served.Upstream.Target = "http://a:8000"
+	if worker.computeHash(served) == base {
+		t.Error("Hash should change when the serving target is modified")
+	}
+
+	rewritten := newEntry(503)
+	rewritten.Upstream.URL = "http://b:8000/v1/chat/completions?api-version=2024-02-01"
+	if worker.computeHash(rewritten) == base {
+		t.Error("Hash should change when the upstream URL is modified")
+	}
+
+	dropped := newEntry(503)
+	dropped.Upstream.Attempts = dropped.Upstream.Attempts[1:]
+	if worker.computeHash(dropped) == base {
+		t.Error("Hash should change when an attempt is removed")
+	}
+
+	retried := newEntry(503)
+	retried.Upstream.Attempts[0].Outcome = models.AttemptRetried
+	if worker.computeHash(retried) == base {
+		t.Error("Hash should change when an attempt outcome is modified")
+	}
+
+	backedOff := newEntry(503)
+	backedOff.Upstream.Attempts[1].BackoffMs = 500
+	if worker.computeHash(backedOff) == base {
+		t.Error("Hash should change when an attempt backoff is modified")
+	}
+
+	traced := newEntry(503)
+	traced.Trace = &models.TraceContext{
+		SpanID:   "00f067aa0ba902b7",
+		Attempts: []models.AttemptSpan{{SpanID: "a1", Attempt: 1, Outcome: models.AttemptRetried}},
+	}
+	tracedHash := worker.computeHash(traced)
+	traced.Trace.Attempts[0].Outcome = models.AttemptServed
+	if worker.computeHash(traced) == tracedHash {
+		t.Error("Hash should change when an attempt span is modified")
+	}
+}
+
+// TestHashIncludesPrincipal verifies the authenticated client is covered by the hash chain
+func TestHashIncludesPrincipal(t *testing.T) {
+	worker := &Worker{}
+
+	entry := createTestEntry(0, "test")
+	entry.PrevHash = "prev"
+	anonymous := worker.computeHash(entry)
+
+	entry.Principal = &models.Principal{ID: "billing-agent", Method: "api_key"}
+	base := worker.computeHash(entry)
+	if base == anonymous {
+		t.Error("Hash should change when a principal is added")
+	}
+
+	entry.Principal.ID = "admin"
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when the principal is modified")
+	}
+}
+
+// TestHashIncludesWebSocket verifies the session transcript is covered by the hash chain
+func TestHashIncludesWebSocket(t *testing.T) {
+	worker := &Worker{}
+
+	entry := createTestEntry(0, "test")
+	entry.PrevHash = "prev"
+	plain := worker.computeHash(entry)
+
+	entry.WebSocket = &models.WebSocketSession{
+		ClosedBy:  models.WebSocketClient,
+		CloseCode: 1000,
+		Events: []models.WebSocketEvent{
+			{Direction: models.WebSocketClient, OffsetMs: 5, Opcode: "text", Type: "session.update", Size: 26, Payload: `{"type":"session.update"}`},
+		},
+		Audio: []models.MediaReference{{SHA256: "abc", SizeBytes: 3}},
+	}
+	base := worker.computeHash(entry)
+	if base == plain {
+		t.Error("Hash should change when a WebSocket session is added")
+	}
+
+	entry.WebSocket.Events[0].Payload = `{"type":"session.updated"}`
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when an event payload is modified")
+	}
+	entry.WebSocket.Events[0].Payload = `{"type":"session.update"}`
+
+	entry.WebSocket.Audio[0].SHA256 = "def"
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when an audio track is replaced")
+	}
+}
+
+// TestHashIncludesSystemEvent verifies startup records and configuration changes are covered by the hash chain
+func TestHashIncludesSystemEvent(t *testing.T) {
+	worker := &Worker{}
+
+	entry := &models.AuditEntry{
+		SequenceID: 3,
+		PrevHash:   "prev",
+		System: &models.SystemEvent{
+			Type:       models.SystemEventConfigChanged,
+			ConfigHash: "abc",
+			Changes:    []string{"endpoint added: openai-eu"},
+		},
+	}
+	base := worker.computeHash(entry)
+
+	entry.System.Changes = []string{"endpoint removed: openai-eu"}
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when the change summary is modified")
+	}
+	entry.System.Changes = []string{"endpoint added: openai-eu"}
+
+	entry.System.ConfigHash = "def"
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when the config hash is modified")
+	}
+
+	startup := &models.AuditEntry{
+		PrevHash: "prev",
+		System: &models.SystemEvent{
+			Type:    models.SystemEventStartup,
+			Config:  []byte(`{"streaming":{"max_audit_body_size":1024}}`),
+			Version: "v1.2.0",
+			Host:    "proxy-1",
+		},
+	}
+	base = worker.computeHash(startup)
+
+	startup.System.Config = []byte(`{"streaming":{"max_audit_body_size":0}}`)
+	if worker.computeHash(startup) == base {
+		t.Error("Hash should change when the recorded configuration is modified")
+	}
+	startup.System.Config = []byte(`{"streaming":{"max_audit_body_size":1024}}`)
+
+	startup.System.Host = "proxy-2"
+	if worker.computeHash(startup) == base {
+		t.Error("Hash should change when the host is modified")
+	}
+}
+
+// TestHashIncludesRedactions verifies redaction findings are covered by the hash chain
+func TestHashIncludesRedactions(t *testing.T) {
+	worker := &Worker{}
+
+	entry := &models.AuditEntry{
+		SequenceID: 4,
+		PrevHash:   "prev",
+		Redactions: []models.RedactionFinding{
+			{Detector: "email", Location: "request.body", Start: 10, End: 26},
+		},
+	}
+	base := worker.computeHash(entry)
+
+	entry.Redactions[0].Detector = "ssn"
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when the detector is modified")
+	}
+	entry.Redactions[0].Detector = "email"
+
+	entry.Redactions[0].Start = 11
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when the finding offsets are modified")
+	}
+	entry.Redactions[0].Start = 10
+
+	entry.Redactions = nil
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when a finding is removed")
+	}
+}
+
+// TestHashIncludesPolicy verifies the policy decision is covered by the hash chain
+func TestHashIncludesPolicy(t *testing.T) {
+	worker := &Worker{}
+
+	entry := &models.AuditEntry{
+		SequenceID: 5,
+		PrevHash:   "prev",
+		Policy: &models.PolicyDecision{
+			Action:    models.PolicyMutate,
+			Rule:      "cap-tokens",
+			Matches:   []models.PolicyMatch{{Rule: "cap-tokens", Action: models.PolicyMutate, Reasons: []string{"max_tokens 8000 > 4096"}}},
+			Mutations: []string{"max_tokens: 8000 -> 4096"},
+		},
+	}
+	base := worker.computeHash(entry)
+
+	entry.Policy.Action = models.PolicyAllow
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when the decision is modified")
+	}
+	entry.Policy.Action = models.PolicyMutate
+
+	entry.Policy.Mutations = nil
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when a mutation is removed")
+	}
+	entry.Policy.Mutations = []string{"max_tokens: 8000 -> 4096"}
+
+	entry.Policy.Matches[0].Reasons = nil
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when the match reasons are modified")
+	}
+}
+
+// TestHashIncludesFindings verifies guardrail findings are covered by the hash chain
+func TestHashIncludesFindings(t *testing.T) {
+	worker := &Worker{}
+
+	entry := &models.AuditEntry{
+		SequenceID: 6,
+		PrevHash:   "prev",
+		Findings: []models.Finding{
+			{Rule: "no-deletes", Action: "block", Kind: models.FindingToolCall, Value: "delete_user"},
+		},
+	}
+	base := worker.computeHash(entry)
+
+	entry.Findings[0].Action = "flag"
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when the finding action is modified")
+	}
+	entry.Findings[0].Action = "block"
+
+	entry.Findings = nil
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when a finding is removed")
+	}
+}
+
+// TestHashIncludesInjection verifies the prompt-injection scores of tool results are protected by the hash chain
+func TestHashIncludesInjection(t *testing.T) {
+	worker := &Worker{}
+
+	entry := &models.AuditEntry{
+		SequenceID: 7,
+		PrevHash:   "prev",
+		Trace: &models.TraceContext{
+			TraceID: "trace",
+			SpanID:  "span",
+			ToolResults: []models.ToolResultInfo{
+				{ToolCallID: "call_1", ContentHash: "abc", InjectionRisk: 60, InjectionRules: []string{"instruction_override"}},
+			},
+		},
+	}
+	base := worker.computeHash(entry)
+
+	entry.Trace.ToolResults[0].InjectionRisk = 0
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when the injection risk is modified")
+	}
+	entry.Trace.ToolResults[0].InjectionRisk = 60
+
+	entry.Trace.ToolResults[0].InjectionRules = nil
+	if worker.computeHash(entry) == base {
+		t.Error("Hash should change when the injection rules are removed")
+	}
+	entry.Trace.ToolResults[0].InjectionRules = []string{"instruction_override"}
+
+	entry.Trace.Documents = []models.DocumentInfo{{Index: 0, ContentHash: "def", InjectionRisk: 40, InjectionRules: []string{"exfil_instruction"}}}
+	withDocument := worker.computeHash(entry)
+	if withDocument == base {
+		t.Error("Hash should change when a scored document is added")
+	}
+	entry.Trace.Documents[0].InjectionRisk = 10
+	if worker.computeHash(entry) == withDocument {
+		t.Error("Hash should change when the document risk is modified")
+	}
+}
+
 // TestGenesisHash verifies genesis hash computation
 func TestGenesisHash(t *testing.T) {
 	seed := "test-seed"
@@ -0,0 +1,329 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signToken builds a compact JWS with the given algorithm and signer
+func signToken(t *testing.T, header, claims map[string]interface{}, sign func([]byte) []byte) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	input := b64(h) + "." + b64(c)
+	return input + "." + b64(sign([]byte(input)))
+}
+
+// testKeys holds one key of each supported type and the JWKS file listing them
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	ed      ed25519.PrivateKey
+	jwksDir string
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": b64(edPub)},
+			{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		},
+	}
+	dir := t.TempDir()
+	data, _ := json.Marshal(jwks)
+	if err := os.WriteFile(filepath.Join(dir, "jwks.json"), data, 0600); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+
+	return &testKeys{rsa: rsaKey, ec: ecKey, ed: edKey, jwksDir: dir}
+}
+
+func (k *testKeys) signRS256(data []byte) []byte {
+	digest := sha256.Sum256(data)
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+	return sig
+}
+
+func (k *testKeys) signES256(data []byte) []byte {
+	digest := sha256.Sum256(data)
+	r, s, _ := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+	return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+}
+
+func (k *testKeys) signEdDSA(data []byte) []byte {
+	return ed25519.Sign(k.ed, data)
+}
+
+// TestAuthenticateAPIKey verifies hashed static keys and the endpoint allowlist
+func TestAuthenticateAPIKey(t *testing.T) {
+	a, err := New(config.AuthConfig{
+		Enabled: true,
+		Clients: []config.AuthClient{
+			{Name: "billing-agent", APIKeySHA256: hashKey("internal-key-1"), Endpoints: []string{"openai"}},
+			{Name: "admin", APIKeySHA256: hashKey("internal-key-2")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/openai/v1/chat/completions", nil)
+	req.Header.Set("Authorization", "Bearer internal-key-1")
+	id, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Expected valid key to authenticate: %v", err)
+	}
+	if id.Principal.ID != "billing-agent" || id.Principal.Method != MethodAPIKey {
+		t.Errorf("Unexpected principal: %+v", id.Principal)
+	}
+	if !id.Allows("openai") || id.Allows("local") {
+		t.Error("Client should only be allowed its listed endpoints")
+	}
+
+	req = httptest.NewRequest("POST", "/local/v1/messages", nil)
+	req.Header.Set("X-Api-Key", "internal-key-2")
+	id, err = a.Authenticate(req)
+	if err != nil || id.Principal.ID != "admin" || !id.Allows("local") {
+		t.Errorf("Expected admin with access to all endpoints, got %+v (%v)", id, err)
+	}
+
+	req.Header.Set("X-Api-Key", "wrong-key")
+	if _, err := a.Authenticate(req); err == nil {
+		t.Error("Expected error for unknown key")
+	}
+
+	req = httptest.NewRequest("POST", "/openai/v1/chat/completions", nil)
+	if _, err := a.Authenticate(req); err != ErrNoCredentials {
+		t.Errorf("Expected ErrNoCredentials, got %v", err)
+	}
+}
+
+// TestAuthenticateJWT verifies token signatures for each key type and the registered claims
+func TestAuthenticateJWT(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Now()
+
+	a, err := New(config.AuthConfig{
+		Enabled: true,
+		Clients: []config.AuthClient{{Name: "svc-restricted", Endpoints: []string{"local"}}},
+		JWT: config.JWTConfig{
+			JWKSFile:       filepath.Join(keys.jwksDir, "jwks.json"),
+			Issuer:         "https://idp.internal",
+			Audience:       "aiblackbox",
+			EndpointsClaim: "endpoints",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub": "svc-reporting",
+			"iss": "https://idp.internal",
+			"aud": []string{"aiblackbox", "other"},
+			"exp": now.Add(time.Hour).Unix(),
+			"nbf": now.Add(-time.Minute).Unix(),
+		}
+	}
+
+	authenticate := func(token string) (*Identity, error) {
+		req := httptest.NewRequest("POST", "/openai/v1/chat/completions", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return a.Authenticate(req)
+	}
+
+	signers := map[string]func([]byte) []byte{
+		"RS256": keys.signRS256,
+		"ES256": keys.signES256,
+		"EdDSA": keys.signEdDSA,
+	}
+	for alg, sign := range signers {
+		t.Run(alg, func(t *testing.T) {
+			id, err := authenticate(signToken(t, map[string]interface{}{"alg": alg, "typ": "JWT"}, validClaims(), sign))
+			if err != nil {
+				t.Fatalf("Expected valid %s token to authenticate: %v", alg, err)
+			}
+			if id.Principal.ID != "svc-reporting" || id.Principal.Method != MethodJWT || id.Principal.Issuer != "https://idp.internal" {
+				t.Errorf("Unexpected principal: %+v", id.Principal)
+			}
+			if !id.Allows("openai") {
+				t.Error("Token without allowlist should be allowed every endpoint")
+			}
+		})
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]interface{}
+		mutate func(map[string]interface{})
+		sign   func([]byte) []byte
+	}{
+		{"expired", map[string]interface{}{"alg": "RS256"}, func(c map[string]interface{}) { c["exp"] = now.Add(-time.Hour).Unix() }, keys.signRS256},
+		{"missing exp", map[string]interface{}{"alg": "RS256"}, func(c map[string]interface{}) { delete(c, "exp") }, keys.signRS256},
+		{"not yet valid", map[string]interface{}{"alg": "RS256"}, func(c map[string]interface{}) { c["nbf"] = now.Add(time.Hour).Unix() }, keys.signRS256},
+		{"wrong issuer", map[string]interface{}{"alg": "RS256"}, func(c map[string]interface{}) { c["iss"] = "https://evil" }, keys.signRS256},
+		{"wrong audience", map[string]interface{}{"alg": "RS256"}, func(c map[string]interface{}) { c["aud"] = "other" }, keys.signRS256},
+		{"missing subject", map[string]interface{}{"alg": "RS256"}, func(c map[string]interface{}) { delete(c, "sub") }, keys.signRS256},
+		{"wrong kid", map[string]interface{}{"alg": "RS256", "kid": "ec-1"}, func(map[string]interface{}) {}, keys.signRS256},
+		{"alg mismatch", map[string]interface{}{"alg": "ES256"}, func(map[string]interface{}) {}, keys.signRS256},
+		{"none", map[string]interface{}{"alg": "none"}, func(map[string]interface{}) {}, func([]byte) []byte { return nil }},
+		{"hmac", map[string]interface{}{"alg": "HS256"}, func(map[string]interface{}) {}, func([]byte) []byte { return []byte("mac") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.mutate(claims)
+			if _, err := authenticate(signToken(t, tt.header, claims, tt.sign)); err == nil {
+				t.Errorf("Expected %s token to be rejected", tt.name)
+			}
+		})
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		token := signToken(t, map[string]interface{}{"alg": "RS256"}, validClaims(), keys.signRS256)
+		claims := validClaims()
+		claims["sub"] = "admin"
+		forged, _ := json.Marshal(claims)
+		parts := splitToken(token)
+		if _, err := authenticate(parts[0] + "." + b64(forged) + "." + parts[2]); err == nil {
+			t.Error("Expected tampered token to be rejected")
+		}
+	})
+
+	t.Run("endpoints claim", func(t *testing.T) {
+		claims := validClaims()
+		claims["endpoints"] = []string{"local"}
+		id, err := authenticate(signToken(t, map[string]interface{}{"alg": "EdDSA"}, claims, keys.signEdDSA))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if id.Allows("openai") || !id.Allows("local") {
+			t.Error("Endpoints claim should restrict the token")
+		}
+
+		claims["endpoints"] = []string{}
+		id, _ = authenticate(signToken(t, map[string]interface{}{"alg": "EdDSA"}, claims, keys.signEdDSA))
+		if id.Allows("local") {
+			t.Error("An empty endpoints claim should allow nothing")
+		}
+	})
+
+	t.Run("client allowlist", func(t *testing.T) {
+		claims := validClaims()
+		claims["sub"] = "svc-restricted"
+		id, err := authenticate(signToken(t, map[string]interface{}{"alg": "ES256"}, claims, keys.signES256))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if id.Allows("openai") || !id.Allows("local") {
+			t.Error("Client entry named after the subject should set the allowlist")
+		}
+	})
+}
+
+func splitToken(token string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(token); i++ {
+		if token[i] == '.' {
+			parts = append(parts, token[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, token[start:])
+}
+
+// TestAuthenticateMTLS verifies clients are identified by a verified certificate's common name
+func TestAuthenticateMTLS(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ci.internal"},
+		Issuer:       pkix.Name{CommonName: "ci.internal"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	a, err := New(config.AuthConfig{
+		Enabled: true,
+		Clients: []config.AuthClient{{Name: "ci", CertCommonName: "ci.internal", Endpoints: []string{"local"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/local/v1/chat/completions", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	id, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Expected verified certificate to authenticate: %v", err)
+	}
+	if id.Principal.ID != "ci" || id.Principal.Method != MethodMTLS || id.Principal.Issuer != "ci.internal" {
+		t.Errorf("Unexpected principal: %+v", id.Principal)
+	}
+
+	// Presented but unverified certificates are ignored
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if _, err := a.Authenticate(req); err == nil {
+		t.Error("Unverified certificate should not authenticate")
+	}
+}
+
+// TestNewMissingJWKS verifies a missing key set is an error
+func TestNewMissingJWKS(t *testing.T) {
+	_, err := New(config.AuthConfig{Enabled: true, JWT: config.JWTConfig{JWKSFile: filepath.Join(t.TempDir(), "missing.json")}})
+	if err == nil {
+		t.Error("Expected error for missing JWKS file")
+	}
+}
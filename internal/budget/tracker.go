@@ -0,0 +1,439 @@
+package budget
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+)
+
+const (
+	// bucketsPerWindow is the resolution of the sliding windows
+	// Consumption is aggregated into window/bucketsPerWindow wide buckets, bounding memory per key
+	bucketsPerWindow = 60
+
+	// flushInterval is how often consumption is persisted to the state file
+	flushInterval = 5 * time.Second
+
+	// stateVersion identifies the format of the state file
+	stateVersion = 1
+)
+
+// Subject identifies who a request is counted against
+type Subject struct {
+	Endpoint string
+	APIKey   string // Fingerprint of the client credential, never the credential itself
+	TraceID  string // Client-supplied trace ID only
+}
+
+// Violation describes an exhausted budget
+type Violation struct {
+	Rule       string
+	Scope      string
+	Metric     string // "tokens" or "cost_usd"
+	Used       float64
+	Limit      float64
+	Window     time.Duration
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface with a message suitable for API clients
+func (v *Violation) Error() string {
+	unit := "tokens"
+	if v.Metric == "cost_usd" {
+		unit = "USD"
+	}
+	return fmt.Sprintf("budget %q exceeded for this %s: %g of %g %s used in the last %s",
+		v.Rule, v.Scope, v.Used, v.Limit, unit, v.Window)
+}
+
+// bucket aggregates consumption starting at Start (Unix seconds)
+type bucket struct {
+	Start  int64   `json:"start"`
+	Tokens int64   `json:"tokens"`
+	Cost   float64 `json:"cost_usd"`
+}
+
+// window is the consumption of one subject under one rule
+type window struct {
+	Rule    string    `json:"rule"`
+	Key     string    `json:"key"`
+	Buckets []*bucket `json:"buckets"`
+}
+
+// state is the persisted form of all windows
+type state struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"saved_at"`
+	Windows []*window `json:"windows"`
+}
+
+// Tracker enforces token and cost budgets over sliding windows
+// Budgets are soft limits: requests are checked before proxying and consumption is
+// recorded once usage is known, so concurrent requests may overshoot a budget slightly
+type Tracker struct {
+	rules     []config.BudgetRule
+	statePath string
+
+	mu       sync.Mutex
+	windows  map[string]*window
+	dirty    bool
+	flushing bool // The flush loop runs once any budget was configured
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewTracker creates a tracker for the configured budgets and restores persisted consumption
+// Without rules the tracker is inert and never touches the state file
+func NewTracker(cfg config.BudgetConfig) *Tracker {
+	t := &Tracker{
+		rules:     cfg.Rules,
+		statePath: cfg.StatePath,
+		windows:   make(map[string]*window),
+		done:      make(chan struct{}),
+	}
+
+	if len(t.rules) == 0 {
+		return t
+	}
+
+	t.start()
+	return t
+}
+
+// start restores persisted consumption and starts the flush loop
+func (t *Tracker) start() {
+	t.mu.Lock()
+	t.flushing = true
+	if err := t.load(); err != nil {
+		log.Printf("WARNING: Failed to load budget state from %s, starting empty: %v", t.statePath, err)
+	}
+	t.mu.Unlock()
+
+	t.wg.Add(1)
+	go t.flushLoop()
+}
+
+// SetRules replaces the configured budgets when the configuration is reloaded
+// Consumption recorded so far is kept; windows of removed rules are dropped on the next save.
+// The state file path only changes on restart
+func (t *Tracker) SetRules(rules []config.BudgetRule) {
+	t.mu.Lock()
+	t.rules = rules
+	t.dirty = true
+	start := len(rules) > 0 && !t.flushing
+	t.mu.Unlock()
+
+	if start {
+		t.start()
+	}
+}
+
+// Enabled reports whether any budget is configured
+func (t *Tracker) Enabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.rules) > 0
+}
+
+// Check returns the first exhausted budget that applies to the subject, or nil
+func (t *Tracker) Check(subject Subject, now time.Time) *Violation {
+	if !t.Enabled() {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, rule := range t.rules {
+		key, ok := scopeKey(rule, subject)
+		if !ok {
+			continue
+		}
+
+		w := t.windows[windowID(rule.Name, key)]
+		if w == nil {
+			continue
+		}
+
+		width := bucketWidth(rule)
+		w.prune(now, rule, width)
+		tokens, cost := w.sum()
+
+		if rule.MaxTokens > 0 && tokens >= rule.MaxTokens {
+			return &Violation{
+				Rule:       rule.Name,
+				Scope:      rule.Scope,
+				Metric:     "tokens",
+				Used:       float64(tokens),
+				Limit:      float64(rule.MaxTokens),
+				Window:     ruleWindow(rule),
+				RetryAfter: w.retryAfter(now, rule, width, func(b *bucket) float64 { return float64(b.Tokens) }, float64(tokens), float64(rule.MaxTokens)),
+			}
+		}
+		if rule.MaxCostUSD > 0 && cost >= rule.MaxCostUSD {
+			return &Violation{
+				Rule:       rule.Name,
+				Scope:      rule.Scope,
+				Metric:     "cost_usd",
+				Used:       cost,
+				Limit:      rule.MaxCostUSD,
+				Window:     ruleWindow(rule),
+				RetryAfter: w.retryAfter(now, rule, width, func(b *bucket) float64 { return b.Cost }, cost, rule.MaxCostUSD),
+			}
+		}
+	}
+
+	return nil
+}
+
+// Record adds the usage of a completed call to every budget that applies to the subject
+func (t *Tracker) Record(subject Subject, usage *models.TokenUsage, now time.Time) {
+	if !t.Enabled() || usage == nil {
+		return
+	}
+
+	var cost float64
+	if usage.CostUSD != nil {
+		cost = *usage.CostUSD
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, rule := range t.rules {
+		key, ok := scopeKey(rule, subject)
+		if !ok {
+			continue
+		}
+
+		id := windowID(rule.Name, key)
+		w := t.windows[id]
+		if w == nil {
+			w = &window{Rule: rule.Name, Key: key}
+			t.windows[id] = w
+		}
+
+		width := bucketWidth(rule)
+		start := now.Unix() - now.Unix()%int64(width/time.Second)
+		if n := len(w.Buckets); n == 0 || w.Buckets[n-1].Start != start {
+			w.Buckets = append(w.Buckets, &bucket{Start: start})
+		}
+		last := w.Buckets[len(w.Buckets)-1]
+		last.Tokens += usage.TotalTokens
+		last.Cost += cost
+	}
+
+	t.dirty = true
+}
+
+// Shutdown stops the flush loop and persists the final state
+func (t *Tracker) Shutdown() {
+	t.mu.Lock()
+	flushing := t.flushing
+	t.mu.Unlock()
+	if !flushing {
+		return
+	}
+
+	close(t.done)
+	t.wg.Wait()
+
+	if err := t.save(time.Now()); err != nil {
+		log.Printf("ERROR: Failed to save budget state: %v", err)
+	}
+}
+
+// flushLoop periodically persists changed state
+func (t *Tracker) flushLoop() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case now := <-ticker.C:
+			if err := t.save(now); err != nil {
+				log.Printf("ERROR: Failed to save budget state: %v", err)
+			}
+		}
+	}
+}
+
+// save writes the state file atomically if anything changed since the last save
+// Expired buckets and empty windows are dropped first
+func (t *Tracker) save(now time.Time) error {
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+
+	st := state{Version: stateVersion, SavedAt: now.UTC()}
+	for id, w := range t.windows {
+		rule, ok := t.rule(w.Rule)
+		if ok {
+			w.prune(now, rule, bucketWidth(rule))
+		}
+		if !ok || len(w.Buckets) == 0 {
+			delete(t.windows, id)
+			continue
+		}
+		st.Windows = append(st.Windows, w)
+	}
+	slices.SortFunc(st.Windows, func(a, b *window) int {
+		if a.Rule != b.Rule {
+			return cmp.Compare(a.Rule, b.Rule)
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+
+	data, err := json.Marshal(st)
+	t.dirty = false
+	t.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal budget state: %w", err)
+	}
+
+	dir := filepath.Dir(t.statePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(t.statePath)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close state file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), t.statePath)
+}
+
+// load restores windows from the state file, ignoring rules that are no longer configured
+func (t *Tracker) load() error {
+	data, err := os.ReadFile(t.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("failed to parse budget state: %w", err)
+	}
+	if st.Version != stateVersion {
+		return fmt.Errorf("unsupported budget state version: %d", st.Version)
+	}
+
+	now := time.Now()
+	for _, w := range st.Windows {
+		rule, ok := t.rule(w.Rule)
+		if !ok {
+			continue
+		}
+		w.prune(now, rule, bucketWidth(rule))
+		if len(w.Buckets) > 0 {
+			t.windows[windowID(w.Rule, w.Key)] = w
+		}
+	}
+
+	return nil
+}
+
+// rule looks up a configured rule by name
+func (t *Tracker) rule(name string) (config.BudgetRule, bool) {
+	for _, r := range t.rules {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return config.BudgetRule{}, false
+}
+
+// prune drops buckets that lie entirely outside the window
+func (w *window) prune(now time.Time, rule config.BudgetRule, width time.Duration) {
+	cutoff := now.Add(-ruleWindow(rule)).Unix()
+	i := 0
+	for i < len(w.Buckets) && w.Buckets[i].Start+int64(width/time.Second) <= cutoff {
+		i++
+	}
+	w.Buckets = w.Buckets[i:]
+}
+
+// sum returns the consumption within the window
+func (w *window) sum() (int64, float64) {
+	var tokens int64
+	var cost float64
+	for _, b := range w.Buckets {
+		tokens += b.Tokens
+		cost += b.Cost
+	}
+	return tokens, cost
+}
+
+// retryAfter estimates when enough old buckets expire for consumption to drop below the limit
+func (w *window) retryAfter(now time.Time, rule config.BudgetRule, width time.Duration, value func(*bucket) float64, used, limit float64) time.Duration {
+	for _, b := range w.Buckets {
+		used -= value(b)
+		if used < limit {
+			expires := time.Unix(b.Start, 0).Add(width + ruleWindow(rule))
+			return max(expires.Sub(now), time.Second)
+		}
+	}
+	return ruleWindow(rule)
+}
+
+// scopeKey returns the key a rule counts the subject under
+// False if the rule does not apply (endpoint not listed or no identity for the scope)
+func scopeKey(rule config.BudgetRule, subject Subject) (string, bool) {
+	if len(rule.Endpoints) > 0 && !slices.Contains(rule.Endpoints, subject.Endpoint) {
+		return "", false
+	}
+
+	var key string
+	switch rule.Scope {
+	case config.BudgetScopeEndpoint:
+		key = subject.Endpoint
+	case config.BudgetScopeAPIKey:
+		key = subject.APIKey
+	case config.BudgetScopeTrace:
+		key = subject.TraceID
+	}
+	return key, key != ""
+}
+
+func windowID(rule, key string) string {
+	return rule + "\x00" + key
+}
+
+func ruleWindow(rule config.BudgetRule) time.Duration {
+	return time.Duration(rule.Window) * time.Second
+}
+
+// bucketWidth is the bucket size for a rule (whole seconds, at least one)
+func bucketWidth(rule config.BudgetRule) time.Duration {
+	return max(time.Duration(rule.Window/bucketsPerWindow)*time.Second, time.Second)
+}
@@ -0,0 +1,192 @@
+package budget
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+)
+
+// testNow is aligned to a minute so bucket boundaries are predictable
+var testNow = time.Unix(1_699_999_980, 0)
+
+func usageOf(tokens int64, cost float64) *models.TokenUsage {
+	return &models.TokenUsage{TotalTokens: tokens, CostUSD: &cost}
+}
+
+// TestTrackerTokenBudget verifies a token budget is enforced once exhausted
+func TestTrackerTokenBudget(t *testing.T) {
+	tracker := NewTracker(config.BudgetConfig{
+		StatePath: filepath.Join(t.TempDir(), "budgets.json"),
+		Rules: []config.BudgetRule{
+			{Name: "daily", Scope: config.BudgetScopeEndpoint, Window: 3600, MaxTokens: 1000},
+		},
+	})
+	defer tracker.Shutdown()
+
+	now := testNow
+	subject := Subject{Endpoint: "openai"}
+
+	tracker.Record(subject, usageOf(600, 0), now)
+	if v := tracker.Check(subject, now); v != nil {
+		t.Fatalf("Budget should not be exhausted yet: %v", v)
+	}
+
+	tracker.Record(subject, usageOf(400, 0), now.Add(time.Minute))
+	v := tracker.Check(subject, now.Add(2*time.Minute))
+	if v == nil {
+		t.Fatal("Expected budget violation")
+	}
+	if v.Rule != "daily" || v.Metric != "tokens" || v.Used != 1000 || v.Limit != 1000 {
+		t.Errorf("Unexpected violation: %+v", v)
+	}
+
+	// The first 600 tokens expire an hour after they were recorded
+	expectedRetry := time.Hour - 2*time.Minute + time.Minute // bucket width is one minute
+	if v.RetryAfter != expectedRetry {
+		t.Errorf("Expected RetryAfter %v, got %v", expectedRetry, v.RetryAfter)
+	}
+
+	// Other endpoints have their own window
+	if v := tracker.Check(Subject{Endpoint: "anthropic"}, now); v != nil {
+		t.Errorf("Other endpoint should not be limited: %v", v)
+	}
+}
+
+// TestTrackerSlidingWindow verifies consumption expires after the window
+func TestTrackerSlidingWindow(t *testing.T) {
+	tracker := NewTracker(config.BudgetConfig{
+		StatePath: filepath.Join(t.TempDir(), "budgets.json"),
+		Rules: []config.BudgetRule{
+			{Name: "hourly-cost", Scope: config.BudgetScopeAPIKey, Window: 3600, MaxCostUSD: 1},
+		},
+	})
+	defer tracker.Shutdown()
+
+	now := testNow
+	subject := Subject{Endpoint: "openai", APIKey: "abc"}
+
+	tracker.Record(subject, usageOf(10, 1.5), now)
+	if v := tracker.Check(subject, now.Add(30*time.Minute)); v == nil || v.Metric != "cost_usd" {
+		t.Fatalf("Expected cost violation, got %v", v)
+	}
+
+	if v := tracker.Check(subject, now.Add(62*time.Minute)); v != nil {
+		t.Errorf("Consumption should have expired: %v", v)
+	}
+
+	// Requests without a credential are not counted by api_key budgets
+	tracker.Record(Subject{Endpoint: "openai"}, usageOf(10, 5), now)
+	if v := tracker.Check(Subject{Endpoint: "openai"}, now); v != nil {
+		t.Errorf("Anonymous subject should not match api_key budget: %v", v)
+	}
+}
+
+// TestTrackerEndpointFilter verifies rules only apply to their listed endpoints
+func TestTrackerEndpointFilter(t *testing.T) {
+	tracker := NewTracker(config.BudgetConfig{
+		StatePath: filepath.Join(t.TempDir(), "budgets.json"),
+		Rules: []config.BudgetRule{
+			{Name: "trace-cap", Scope: config.BudgetScopeTrace, Endpoints: []string{"openai"}, Window: 60, MaxTokens: 10},
+		},
+	})
+	defer tracker.Shutdown()
+
+	now := testNow
+	tracker.Record(Subject{Endpoint: "local", TraceID: "t1"}, usageOf(100, 0), now)
+	if v := tracker.Check(Subject{Endpoint: "local", TraceID: "t1"}, now); v != nil {
+		t.Errorf("Unlisted endpoint should not be limited: %v", v)
+	}
+
+	tracker.Record(Subject{Endpoint: "openai", TraceID: "t1"}, usageOf(100, 0), now)
+	if v := tracker.Check(Subject{Endpoint: "openai", TraceID: "t1"}, now); v == nil {
+		t.Error("Expected trace budget violation")
+	}
+	if v := tracker.Check(Subject{Endpoint: "openai", TraceID: "t2"}, now); v != nil {
+		t.Errorf("Other trace should not be limited: %v", v)
+	}
+}
+
+// TestTrackerPersistence verifies consumption survives a restart
+func TestTrackerPersistence(t *testing.T) {
+	cfg := config.BudgetConfig{
+		StatePath: filepath.Join(t.TempDir(), "state", "budgets.json"),
+		Rules: []config.BudgetRule{
+			{Name: "daily", Scope: config.BudgetScopeEndpoint, Window: 86400, MaxTokens: 100},
+		},
+	}
+	subject := Subject{Endpoint: "openai"}
+
+	tracker := NewTracker(cfg)
+	tracker.Record(subject, usageOf(150, 0), time.Now())
+	tracker.Shutdown()
+
+	if _, err := os.Stat(cfg.StatePath); err != nil {
+		t.Fatalf("State file should exist: %v", err)
+	}
+
+	restarted := NewTracker(cfg)
+	defer restarted.Shutdown()
+	if v := restarted.Check(subject, time.Now()); v == nil {
+		t.Error("Restored consumption should exhaust the budget")
+	}
+
+	// Rules removed from the config are dropped on load
+	cfg.Rules[0].Name = "renamed"
+	renamed := NewTracker(cfg)
+	defer renamed.Shutdown()
+	if v := renamed.Check(subject, time.Now()); v != nil {
+		t.Errorf("Consumption of removed rules should be ignored: %v", v)
+	}
+}
+
+// TestTrackerDisabled verifies a tracker without rules never limits or writes state
+func TestTrackerDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budgets.json")
+	tracker := NewTracker(config.BudgetConfig{StatePath: path})
+
+	tracker.Record(Subject{Endpoint: "openai"}, usageOf(1_000_000, 100), time.Now())
+	if v := tracker.Check(Subject{Endpoint: "openai"}, time.Now()); v != nil {
+		t.Errorf("Disabled tracker should not limit: %v", v)
+	}
+	tracker.Shutdown()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Disabled tracker should not write a state file")
+	}
+}
+
+// TestTrackerSetRules verifies reloaded rules apply at once and keep recorded consumption
+func TestTrackerSetRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budgets.json")
+	tracker := NewTracker(config.BudgetConfig{StatePath: path})
+	defer tracker.Shutdown()
+
+	subject := Subject{Endpoint: "openai"}
+	now := time.Now()
+
+	// Enabling budgets on reload starts recording
+	tracker.SetRules([]config.BudgetRule{
+		{Name: "daily", Scope: config.BudgetScopeEndpoint, Window: 86400, MaxTokens: 1000},
+	})
+	tracker.Record(subject, usageOf(600, 0), now)
+	if v := tracker.Check(subject, now); v != nil {
+		t.Fatalf("Budget should not be exhausted yet: %v", v)
+	}
+
+	// Lowering the limit applies to the consumption already recorded
+	tracker.SetRules([]config.BudgetRule{
+		{Name: "daily", Scope: config.BudgetScopeEndpoint, Window: 86400, MaxTokens: 500},
+	})
+	if v := tracker.Check(subject, now); v == nil || v.Limit != 500 {
+		t.Errorf("Expected violation of the lowered limit, got %v", v)
+	}
+
+	tracker.SetRules(nil)
+	if v := tracker.Check(subject, now); v != nil {
+		t.Errorf("Removed budgets should not limit: %v", v)
+	}
+}
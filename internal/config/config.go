@@ -1,30 +1,263 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/spf13/viper"
 )
 
 // Config represents the entire application configuration
 type Config struct {
-	Server    ServerConfig     `mapstructure:"server"`
-	Endpoints []EndpointConfig `mapstructure:"endpoints"`
-	Storage   StorageConfig    `mapstructure:"storage"`
-	Streaming StreamingConfig  `mapstructure:"streaming"`
-	Media     MediaConfig      `mapstructure:"media"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Endpoints  []EndpointConfig `mapstructure:"endpoints"`
+	Storage    StorageConfig    `mapstructure:"storage"`
+	Requests   RequestConfig    `mapstructure:"requests"`
+	Streaming  StreamingConfig  `mapstructure:"streaming"`
+	Media      MediaConfig      `mapstructure:"media"`
+	Pricing    []ModelPrice     `mapstructure:"pricing"`
+	Budgets    BudgetConfig     `mapstructure:"budgets"`
+	RateLimits RateLimitConfig  `mapstructure:"rate_limits"`
+	Secrets    SecretsConfig    `mapstructure:"secrets"`
+	Auth       AuthConfig       `mapstructure:"auth"`
+
+	ForwardProxy ForwardProxyConfig `mapstructure:"forward_proxy"`
+	Sanitization SanitizationConfig `mapstructure:"sanitization"`
+	Redaction    RedactionConfig    `mapstructure:"redaction"`
+	Policies     PolicyConfig       `mapstructure:"policies"`
+	Guardrails   GuardrailConfig    `mapstructure:"guardrails"`
+	Injection    InjectionConfig    `mapstructure:"injection"`
 }
 
 // ServerConfig contains server-level settings
 type ServerConfig struct {
 	Port        int    `mapstructure:"port"`
 	GenesisSeed string `mapstructure:"genesis_seed"`
+
+	// ReadTimeout is the maximum duration (in seconds) for reading an entire client request
+	// 0 disables the timeout
+	// Default: 30
+	ReadTimeout int `mapstructure:"read_timeout"`
+
+	// WriteTimeout is the maximum duration (in seconds) for writing a non-streaming response
+	// Streaming responses extend their own deadline to streaming.stream_timeout
+	// 0 disables the timeout
+	// Default: 30
+	WriteTimeout int `mapstructure:"write_timeout"`
+
+	// IdleTimeout is the maximum duration (in seconds) to keep idle keep-alive connections open
+	// Default: 120
+	IdleTimeout int `mapstructure:"idle_timeout"`
+
+	// UpstreamResponseHeaderTimeout is the maximum duration (in seconds) to wait for the
+	// upstream's response headers after the request was sent
+	// Non-streaming completions only send headers once generation finishes, so keep this generous
+	// 0 disables the timeout
+	// Default: 0
+	UpstreamResponseHeaderTimeout int `mapstructure:"upstream_response_header_timeout"`
+
+	// TLS serves HTTPS instead of plain HTTP when a certificate is configured
+	TLS ServerTLSConfig `mapstructure:"tls"`
+}
+
+// ServerTLSConfig defines HTTPS serving and client certificate verification
+type ServerTLSConfig struct {
+	// CertFile and KeyFile are the PEM server certificate (with chain) and private key
+	// Both files are reloaded when they change on disk, so renewed certificates need no restart
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+
+	// ClientCAFile is a PEM bundle of the CAs that issue client certificates
+	// Required for mTLS client authentication (auth clients with cert_common_name)
+	ClientCAFile string `mapstructure:"client_ca_file"`
+
+	// ClientAuth selects whether clients must present a certificate: "none", "optional"
+	// (verified when presented) or "require"
+	// Default: "require" when ClientCAFile is set, else "none"
+	ClientAuth string `mapstructure:"client_auth"`
+
+	// MinVersion is the lowest accepted TLS version: "1.0", "1.1", "1.2" or "1.3"
+	// Default: "1.2"
+	MinVersion string `mapstructure:"min_version"`
+}
+
+// Enabled reports whether the server serves HTTPS
+func (t ServerTLSConfig) Enabled() bool {
+	return t.CertFile != ""
 }
 
+// Client certificate modes
+const (
+	TLSClientAuthNone     = "none"
+	TLSClientAuthOptional = "optional"
+	TLSClientAuthRequire  = "require"
+)
+
+// TLSVersions lists the accepted min_version values
+var TLSVersions = []string{"1.0", "1.1", "1.2", "1.3"}
+
 // EndpointConfig defines a single named endpoint for proxying
 type EndpointConfig struct {
 	Name   string `mapstructure:"name"`
 	Target string `mapstructure:"target"`
+
+	// Targets lists several upstreams for the endpoint (instead of Target)
+	// Requests fail over to another target on connection errors or 5xx/429 responses
+	Targets []UpstreamTarget `mapstructure:"targets"`
+
+	// LoadBalancing selects how targets are chosen: "round_robin" (weighted) or "least_outstanding"
+	// Default: "round_robin"
+	LoadBalancing string `mapstructure:"load_balancing"`
+
+	// HealthCheck configures active health checks of the targets (disabled when Path is empty)
+	HealthCheck HealthCheckConfig `mapstructure:"health_check"`
+
+	// Retry configures retries of transient upstream failures (disabled unless MaxAttempts > 1)
+	Retry RetryConfig `mapstructure:"retry"`
+
+	// Headers are set on every upstream request, overriding client-supplied values
+	// Used to hold provider credentials in the proxy so clients never see them
+	Headers []HeaderInjection `mapstructure:"headers"`
+
+	// StripClientCredentials removes client credential headers (Authorization, api keys,
+	// cookies) and query parameters (e.g. ?key=) before the request is forwarded, so internal
+	// keys never reach the provider
+	StripClientCredentials bool `mapstructure:"strip_client_credentials"`
+
+	// TLS customizes how the endpoint's HTTPS targets are verified and authenticated
+	TLS UpstreamTLSConfig `mapstructure:"tls"`
+}
+
+// UpstreamTLSConfig defines TLS settings for connections to an endpoint's targets
+type UpstreamTLSConfig struct {
+	// CAFile is a PEM bundle of the CAs trusted for the targets' certificates
+	// It replaces the system roots, so internal CAs do not widen trust for public hosts
+	CAFile string `mapstructure:"ca_file"`
+
+	// CertFile and KeyFile are the client certificate and key presented to the targets (mTLS)
+	// Both files are reloaded when they change on disk
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+
+	// ServerName overrides the SNI and the name the target certificate is verified against
+	// Useful when targets are addressed by IP or an internal alias
+	ServerName string `mapstructure:"server_name"`
+
+	// MinVersion is the lowest accepted TLS version: "1.0", "1.1", "1.2" or "1.3"
+	// Default: "1.2"
+	MinVersion string `mapstructure:"min_version"`
+}
+
+// HeaderInjection is a header set on upstream requests
+type HeaderInjection struct {
+	Name string `mapstructure:"name"`
+
+	// Value may reference ${env:NAME} environment variables and ${secret:NAME} entries
+	// of the secrets file, e.g. "Bearer ${env:OPENAI_API_KEY}"
+	Value string `mapstructure:"value"`
+}
+
+// UpstreamTarget is one upstream of an endpoint
+type UpstreamTarget struct {
+	URL string `mapstructure:"url"`
+
+	// Weight is the relative share of requests (default 1)
+	Weight int `mapstructure:"weight"`
+}
+
+// HealthCheckConfig defines active health checks of upstream targets
+type HealthCheckConfig struct {
+	// Path is requested with GET on every target; any 2xx-3xx response is healthy
+	Path string `mapstructure:"path"`
+
+	// Interval between checks (in seconds, default 10)
+	Interval int `mapstructure:"interval"`
+
+	// Timeout of a single check (in seconds, default 5)
+	Timeout int `mapstructure:"timeout"`
+
+	// UnhealthyThreshold is the number of consecutive failed checks before a target
+	// is taken out of rotation (default 2); one successful check brings it back
+	UnhealthyThreshold int `mapstructure:"unhealthy_threshold"`
+}
+
+// RetryConfig defines how transient upstream failures are retried
+// Only failures where the upstream cannot have acted on the request are retried:
+// statuses listed in RetryOn, connection failures before the request was sent, and
+// any transport error for idempotent methods or requests carrying an Idempotency-Key header
+// A response is never retried once it has started streaming to the client
+type RetryConfig struct {
+	// MaxAttempts is the total number of upstream attempts per request, failovers included
+	// 0 or 1 disables retries
+	MaxAttempts int `mapstructure:"max_attempts"`
+
+	// InitialBackoffMs is the delay before the first retry (in milliseconds, default 500)
+	// The delay doubles with every retry and is jittered between half and the full value
+	InitialBackoffMs int `mapstructure:"initial_backoff_ms"`
+
+	// MaxBackoffMs caps the backoff delay (in milliseconds, default 10000)
+	MaxBackoffMs int `mapstructure:"max_backoff_ms"`
+
+	// MaxRetryAfter is the longest upstream Retry-After (in seconds) the proxy waits for
+	// Responses asking for a longer wait are returned to the client as is (default 30)
+	MaxRetryAfter int `mapstructure:"max_retry_after"`
+
+	// RetryOn lists the response statuses that are retried (default 429, 502, 503)
+	RetryOn []int `mapstructure:"retry_on"`
+}
+
+// SecretsConfig locates the credentials referenced by endpoint headers
+type SecretsConfig struct {
+	// File is a YAML, JSON, TOML or .env file of secret names to values (optional)
+	// Keep it outside the config file and readable only by the proxy
+	File string `mapstructure:"file"`
+}
+
+// ForwardProxyConfig defines the explicit forward-proxy mode for clients that cannot change
+// their base URL: they set HTTPS_PROXY to AIBlackBox, which intercepts CONNECT tunnels to
+// allow-listed hosts with certificates issued by a local CA and audits the requests inside
+type ForwardProxyConfig struct {
+	// Enabled accepts CONNECT requests; tunnels to hosts not listed in Hosts are refused
+	// Default: false
+	Enabled bool `mapstructure:"enabled"`
+
+	// CACertFile and CAKeyFile hold the interception CA, generated on first start if both are missing
+	// Clients must trust CACertFile; keep CAKeyFile readable only by the proxy
+	// Default: "./certs/aiblackbox-ca.crt" and "./certs/aiblackbox-ca.key"
+	CACertFile string `mapstructure:"ca_cert_file"`
+	CAKeyFile  string `mapstructure:"ca_key_file"`
+
+	// Hosts maps the intercepted host names to the endpoints their requests are audited under
+	Hosts []ForwardProxyHost `mapstructure:"hosts"`
+}
+
+// ForwardProxyHost routes tunnels to a host through an endpoint
+// Requests keep their original path, so the endpoint's target should be the host's origin
+// (e.g. "https://api.openai.com" rather than "https://api.openai.com/v1")
+type ForwardProxyHost struct {
+	// Host is the host name, with a port unless it is 443 (e.g. "api.openai.com", "models.internal:8443")
+	Host string `mapstructure:"host"`
+
+	Endpoint string `mapstructure:"endpoint"`
+}
+
+// Load balancing strategies
+const (
+	LoadBalancingRoundRobin       = "round_robin"
+	LoadBalancingLeastOutstanding = "least_outstanding"
+)
+
+// Upstreams returns the endpoint's targets, treating a single Target as one target of weight 1
+func (e EndpointConfig) Upstreams() []UpstreamTarget {
+	if len(e.Targets) > 0 {
+		return e.Targets
+	}
+	return []UpstreamTarget{{URL: e.Target, Weight: 1}}
 }
 
 // StorageConfig defines where and how audit logs are stored
@@ -32,6 +265,29 @@ type StorageConfig struct {
 	Path string `mapstructure:"path"`
 }
 
+// RequestConfig defines limits for incoming request bodies
+type RequestConfig struct {
+	// MaxBodySize is the largest request body accepted (in bytes)
+	// Larger requests are rejected with 413 Request Entity Too Large
+	// 0 disables the limit
+	// Default: 104857600 (100 MB)
+	MaxBodySize int64 `mapstructure:"max_body_size"`
+
+	// MaxAuditBodySize is the maximum request body size to capture for audit logs (in bytes)
+	// Requests exceeding this limit will be truncated in the audit log but forwarded completely to the upstream
+	// 0 captures the whole body
+	// Default: 10485760 (10 MB)
+	MaxAuditBodySize int64 `mapstructure:"max_audit_body_size"`
+
+	// MaxInspectBodySize is how much of a request body is read before proxying (in bytes)
+	// Bodies up to this size are inspected up front: "stream": true detection, request policies
+	// and retries/failover, which resend the body. Larger bodies are streamed to the upstream
+	// without inspection
+	// 0 uses the default
+	// Default: 1048576 (1 MB)
+	MaxInspectBodySize int64 `mapstructure:"max_inspect_body_size"`
+}
+
 // StreamingConfig defines settings for handling streaming (SSE) responses
 type StreamingConfig struct {
 	// MaxAuditBodySize is the maximum response body size to capture for audit logs (in bytes)
@@ -48,8 +304,30 @@ type StreamingConfig struct {
 	// When true, maintains hash chain integrity even when concurrent streams complete out of order
 	// Default: true
 	EnableSequenceTracking bool `mapstructure:"enable_sequence_tracking"`
+
+	// StallThresholdMs is the gap (in milliseconds) between output-bearing chunks reported as a stall
+	// Stalls are listed in the streaming metadata of the audit entry
+	// Default: 2000 (2 seconds)
+	StallThresholdMs int `mapstructure:"stall_threshold_ms"`
+
+	// PreserveRawStream keeps the exact SSE transcript alongside the reconstructed body
+	// The transcript is gzip-compressed and its hash is covered by the audit hash chain
+	// Ignored while redaction is enabled: the transcript would hold the unredacted response
+	// Default: false
+	PreserveRawStream bool `mapstructure:"preserve_raw_stream"`
+
+	// RawStreamStorage selects where preserved transcripts are stored
+	// "inline": Base64 in the audit entry, "sidecar": separate file under media.storage_path
+	// Default: "inline"
+	RawStreamStorage string `mapstructure:"raw_stream_storage"`
 }
 
+// Raw stream storage modes
+const (
+	RawStreamStorageInline  = "inline"
+	RawStreamStorageSidecar = "sidecar"
+)
+
 // MediaConfig defines settings for handling large media content (images, etc.)
 type MediaConfig struct {
 	// EnableExtraction enables extraction of large Base64-encoded media to separate files
@@ -68,17 +346,470 @@ type MediaConfig struct {
 	StoragePath string `mapstructure:"storage_path"`
 }
 
+// ModelPrice defines the token prices of a model in USD per million tokens
+// Model matches exactly or as a prefix, so "gpt-4o" also prices "gpt-4o-2024-08-06";
+// the longest matching entry wins
+type ModelPrice struct {
+	Model string `mapstructure:"model"`
+
+	// InputPerMillion is the price of uncached prompt tokens
+	InputPerMillion float64 `mapstructure:"input_per_million"`
+
+	// CachedInputPerMillion is the price of prompt tokens served from the cache
+	// When omitted, cached tokens are billed at InputPerMillion
+	CachedInputPerMillion *float64 `mapstructure:"cached_input_per_million"`
+
+	// OutputPerMillion is the price of completion tokens (including reasoning tokens)
+	OutputPerMillion float64 `mapstructure:"output_per_million"`
+}
+
+// BudgetConfig defines token and cost budgets enforced before requests are proxied
+type BudgetConfig struct {
+	// StatePath is the file where budget consumption is persisted across restarts
+	// Default: "./logs/budgets.json"
+	StatePath string `mapstructure:"state_path"`
+
+	// Rules lists the budgets; a request is rejected with 429 once any matching budget is exhausted
+	Rules []BudgetRule `mapstructure:"rules"`
+}
+
+// BudgetRule limits the tokens and/or cost consumed within a sliding window
+type BudgetRule struct {
+	Name string `mapstructure:"name"`
+
+	// Scope selects what the budget is counted per: "endpoint", "api_key" or "trace"
+	// api_key budgets are keyed by a fingerprint of the client credential
+	// trace budgets only apply to requests carrying an X-Trace-ID header
+	Scope string `mapstructure:"scope"`
+
+	// Endpoints restricts the rule to the named endpoints (all endpoints when empty)
+	Endpoints []string `mapstructure:"endpoints"`
+
+	// Window is the length of the sliding window (in seconds)
+	Window int `mapstructure:"window"`
+
+	// MaxTokens is the token budget within the window (0 for no token limit)
+	MaxTokens int64 `mapstructure:"max_tokens"`
+
+	// MaxCostUSD is the cost budget within the window (0 for no cost limit)
+	// Only calls priced by the pricing table count towards it
+	MaxCostUSD float64 `mapstructure:"max_cost_usd"`
+}
+
+// Budget scopes
+const (
+	BudgetScopeEndpoint = "endpoint"
+	BudgetScopeAPIKey   = "api_key"
+	BudgetScopeTrace    = "trace"
+)
+
+// AuthConfig defines how clients authenticate to the proxy
+type AuthConfig struct {
+	// Enabled requires every request to authenticate with one of the configured methods
+	// Default: false (anyone who can reach the port may use every endpoint)
+	Enabled bool `mapstructure:"enabled"`
+
+	// Clients are the known clients with their static API key and/or client certificate
+	// With JWT configured, a client entry named after a token's principal sets its endpoint allowlist
+	Clients []AuthClient `mapstructure:"clients"`
+
+	// JWT validates bearer tokens against a local JWKS file (disabled when JWKSFile is empty)
+	JWT JWTConfig `mapstructure:"jwt"`
+}
+
+// AuthClient is a client identity and the endpoints it may use
+type AuthClient struct {
+	// Name is the principal recorded in the audit log
+	Name string `mapstructure:"name"`
+
+	// APIKeySHA256 is the hex-encoded SHA-256 of the client's API key (never the key itself)
+	// Clients send the key as "Authorization: Bearer <key>", x-api-key or api-key
+	APIKeySHA256 string `mapstructure:"api_key_sha256"`
+
+	// CertCommonName matches the subject common name of a verified client certificate (mTLS)
+	CertCommonName string `mapstructure:"cert_common_name"`
+
+	// Endpoints the client may use (empty allows all)
+	Endpoints []string `mapstructure:"endpoints"`
+}
+
+// JWTConfig defines validation of JWT bearer tokens
+type JWTConfig struct {
+	// JWKSFile is a local JSON Web Key Set with the issuer's public keys (RSA, EC or Ed25519)
+	JWKSFile string `mapstructure:"jwks_file"`
+
+	// Issuer is the required "iss" claim (not checked when empty)
+	Issuer string `mapstructure:"issuer"`
+
+	// Audience must be contained in the "aud" claim (not checked when empty)
+	Audience string `mapstructure:"audience"`
+
+	// PrincipalClaim names the claim identifying the client (default "sub")
+	PrincipalClaim string `mapstructure:"principal_claim"`
+
+	// EndpointsClaim names an optional claim listing the endpoints the token may use
+	EndpointsClaim string `mapstructure:"endpoints_claim"`
+
+	// Leeway is the allowed clock skew (in seconds) for exp and nbf (default 60)
+	Leeway int `mapstructure:"leeway"`
+}
+
+// RateLimitConfig defines request rate and concurrency limits
+type RateLimitConfig struct {
+	// ClientHeader names a request header identifying the client (e.g. "X-Client-ID")
+	// When empty or absent from a request, clients are identified by a fingerprint of their API key
+	ClientHeader string `mapstructure:"client_header"`
+
+	// Rules lists the limits; a request is rejected with 429 once any matching limit is reached
+	Rules []RateLimitRule `mapstructure:"rules"`
+}
+
+// RateLimitRule is a token-bucket request rate limit and/or a concurrent stream limit
+type RateLimitRule struct {
+	Name string `mapstructure:"name"`
+
+	// Scope selects what the limit is counted per: "endpoint" or "client"
+	Scope string `mapstructure:"scope"`
+
+	// Endpoints restricts the rule to the named endpoints (all endpoints when empty)
+	Endpoints []string `mapstructure:"endpoints"`
+
+	// RequestsPerSecond is the sustained request rate (0 for no rate limit)
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+
+	// Burst is the number of requests allowed at once (defaults to RequestsPerSecond rounded up)
+	Burst int `mapstructure:"burst"`
+
+	// MaxConcurrentStreams limits simultaneously open streaming requests (0 for no limit)
+	// Applies to requests detected as streaming before proxying
+	MaxConcurrentStreams int `mapstructure:"max_concurrent_streams"`
+}
+
+// Rate limit scopes
+const (
+	RateLimitScopeEndpoint = "endpoint"
+	RateLimitScopeClient   = "client"
+)
+
+// SanitizationConfig defines how credentials in headers and query strings are hidden in audit logs
+// Built-in rules mask the usual credential headers (Authorization, cookies, API keys) and query
+// parameters (key, api_key, access_token, sig, ...); configured rules are checked first
+type SanitizationConfig struct {
+	// HeaderMode selects which headers are recorded: "denylist" records every header and hides
+	// the values matched by a rule, "allowlist" records only AllowedHeaders and drops the rest
+	// Default: "denylist"
+	HeaderMode string `mapstructure:"header_mode"`
+
+	// AllowedHeaders lists the headers recorded in allowlist mode (case-insensitive)
+	// Rules still apply to them, so an allowed Authorization header is recorded masked
+	AllowedHeaders []string `mapstructure:"allowed_headers"`
+
+	// Rules select headers and query parameters and how their values are hidden
+	// The first matching rule wins
+	Rules []SanitizationRule `mapstructure:"rules"`
+
+	// HMACKey keys the fingerprints of the "hmac" strategy, so equal credentials can be
+	// correlated without being guessable; may reference ${env:NAME} and ${secret:NAME}
+	// Required when a rule uses the "hmac" strategy
+	HMACKey string `mapstructure:"hmac_key"`
+}
+
+// SanitizationRule hides the values of matching headers and query parameters
+// Names are matched case-insensitively
+type SanitizationRule struct {
+	// Headers lists header names; HeaderPattern is a regular expression matched against header names
+	Headers       []string `mapstructure:"headers"`
+	HeaderPattern string   `mapstructure:"header_pattern"`
+
+	// QueryParams lists query parameter names; QueryPattern is a regular expression matched against them
+	QueryParams  []string `mapstructure:"query_params"`
+	QueryPattern string   `mapstructure:"query_pattern"`
+
+	// Strategy selects how values are hidden:
+	//   "mask": first 3 and last 4 characters, e.g. "Bearer sk-...mnop" (the built-in behavior)
+	//   "redact": "[REDACTED]"
+	//   "drop": the header or parameter is not recorded at all
+	//   "hmac": keyed HMAC-SHA256 fingerprint, e.g. "hmac:3f2a9c4e1b7d8a06"
+	//   "keep_last": the last KeepLast characters, e.g. "...mnop"
+	// A "Bearer " prefix is kept by every strategy except drop
+	// Default: "mask"
+	Strategy string `mapstructure:"strategy"`
+
+	// KeepLast is the number of trailing characters kept by the keep_last strategy
+	// Values too short to hide at least as many characters are redacted
+	// Default: 4
+	KeepLast int `mapstructure:"keep_last"`
+}
+
+// Header recording modes
+const (
+	HeaderModeDenylist  = "denylist"
+	HeaderModeAllowlist = "allowlist"
+)
+
+// Sanitization strategies
+const (
+	SanitizeMask     = "mask"
+	SanitizeRedact   = "redact"
+	SanitizeDrop     = "drop"
+	SanitizeHMAC     = "hmac"
+	SanitizeKeepLast = "keep_last"
+)
+
+// RedactionConfig defines the detection of personal data and secrets in request and response
+// bodies; detected values are replaced before the bodies are hashed and stored
+type RedactionConfig struct {
+	// Enabled runs the detectors over every audited body
+	// Default: false
+	Enabled bool `mapstructure:"enabled"`
+
+	// Detectors selects the built-in detectors by name (all of RedactionDetectors when empty)
+	Detectors []string `mapstructure:"detectors"`
+
+	// Patterns adds custom detectors
+	Patterns []RedactionPattern `mapstructure:"patterns"`
+
+	// Mode selects the replacement: "mask" writes "[REDACTED:email]", "tokenize" writes
+	// "[TOKEN:email:3f2a9c4e1b7d8a06]" and keeps the original value, encrypted, in the vault
+	// Equal values get equal tokens, so they can still be correlated across entries
+	// Default: "mask"
+	Mode string `mapstructure:"mode"`
+
+	// VaultPath is the file holding tokenized values; keep it apart from the audit log
+	// Default: "./vault/redaction.jsonl"
+	VaultPath string `mapstructure:"vault_path"`
+
+	// VaultKey encrypts the vault and keys the tokens; may reference ${env:NAME} and ${secret:NAME}
+	// Required in tokenize mode
+	VaultKey string `mapstructure:"vault_key"`
+}
+
+// RedactionPattern is a custom detector
+type RedactionPattern struct {
+	// Name identifies the detector in replacements and findings
+	Name string `mapstructure:"name"`
+
+	// Pattern is a regular expression matching the values to redact
+	Pattern string `mapstructure:"pattern"`
+
+	// Validator rejects matches failing a checksum: "luhn" (card numbers) or empty for none
+	Validator string `mapstructure:"validator"`
+}
+
+// Redaction modes
+const (
+	RedactionModeMask     = "mask"
+	RedactionModeTokenize = "tokenize"
+)
+
+// RedactionDetectors lists the built-in redaction detectors
+var RedactionDetectors = []string{
+	"email", "ssn", "credit_card",
+	"aws_access_key", "github_token", "anthropic_key", "openai_key", "google_api_key",
+	"slack_token", "stripe_key", "private_key", "jwt",
+}
+
+// RedactionValidators lists the checksum validators of custom redaction patterns
+var RedactionValidators = []string{"luhn"}
+
+// PolicyConfig defines the rules deciding whether requests are forwarded
+type PolicyConfig struct {
+	// Rules are evaluated in order before a request is forwarded
+	// The first matching allow or deny rule ends the evaluation; flag and mutate rules record
+	// their match and evaluation continues. Requests no rule denies are forwarded
+	Rules []PolicyRule `mapstructure:"rules"`
+
+	// RequireInspectableBody refuses requests with a body larger than requests.max_inspect_body_size
+	// when a rule applying to them looks at the body (models, max_tokens_above, body_pattern,
+	// detectors or mutate); otherwise such conditions do not match and a warning is logged
+	// Default: false
+	RequireInspectableBody bool `mapstructure:"require_inspectable_body"`
+}
+
+// PolicyRule applies an action to the requests matching all of its conditions
+type PolicyRule struct {
+	Name string `mapstructure:"name"`
+
+	// Action is taken when the rule matches:
+	//   "allow": forward the request without evaluating further rules
+	//   "deny": refuse the request with 403 before it reaches the upstream
+	//   "flag": forward the request, marking it in the audit log
+	//   "mutate": rewrite the JSON request body as described by Mutate, then forward it
+	Action string `mapstructure:"action"`
+
+	// Message is returned to clients denied by the rule (defaults to naming the rule)
+	Message string `mapstructure:"message"`
+
+	// Endpoints and Clients restrict the rule to the named endpoints and authenticated clients
+	// (all when empty)
+	Endpoints []string `mapstructure:"endpoints"`
+	Clients   []string `mapstructure:"clients"`
+
+	// Match lists the conditions; a rule without conditions matches every request it applies to
+	Match PolicyMatch `mapstructure:"match"`
+
+	// Mutate describes the rewrite of the mutate action
+	Mutate PolicyMutation `mapstructure:"mutate"`
+}
+
+// PolicyMatch holds the conditions of a policy rule; all conditions set must match
+// Body conditions only match JSON bodies small enough to be inspected before proxying (1 MB)
+type PolicyMatch struct {
+	// Models lists glob patterns matched against the "model" field of the body, e.g. "gpt-4*"
+	Models []string `mapstructure:"models"`
+
+	// Paths lists glob patterns matched against the request path below the endpoint, e.g. "/v1/images/*"
+	Paths []string `mapstructure:"paths"`
+
+	// MissingHeaders matches requests lacking any of the listed headers, e.g. a trace header
+	MissingHeaders []string `mapstructure:"missing_headers"`
+
+	// Detectors matches bodies in which any of the listed redaction detectors fires, e.g. "aws_access_key"
+	Detectors []string `mapstructure:"detectors"`
+
+	// BodyPattern is a regular expression matched against the body
+	BodyPattern string `mapstructure:"body_pattern"`
+
+	// MaxTokensAbove matches requests asking for more output tokens than this
+	// (max_tokens, max_completion_tokens or max_output_tokens); 0 to ignore
+	MaxTokensAbove int `mapstructure:"max_tokens_above"`
+}
+
+// PolicyMutation describes how a mutate rule rewrites the JSON request body
+type PolicyMutation struct {
+	// MaxTokens caps the requested output tokens (max_tokens, max_completion_tokens and max_output_tokens)
+	MaxTokens int `mapstructure:"max_tokens"`
+
+	// SetFields overwrites top-level body fields, e.g. {"temperature": 0}
+	// Field names are lower-cased by the config loader
+	SetFields map[string]interface{} `mapstructure:"set_fields"`
+}
+
+// Policy actions
+const (
+	PolicyAllow  = "allow"
+	PolicyDeny   = "deny"
+	PolicyFlag   = "flag"
+	PolicyMutate = "mutate"
+)
+
+// GuardrailConfig defines the checks run on completed (or reconstructed) responses
+type GuardrailConfig struct {
+	// Rules are all checked against every response; each check that fires is recorded as a finding
+	Rules []GuardrailRule `mapstructure:"rules"`
+}
+
+// GuardrailRule flags or blocks responses in which any of its checks fires
+type GuardrailRule struct {
+	Name string `mapstructure:"name"`
+
+	// Action is taken when a check fires:
+	//   "flag": record the findings
+	//   "block": also replace non-streaming responses with a 403 error; streamed responses have
+	//            already reached the client and are only flagged
+	Action string `mapstructure:"action"`
+
+	// Message is returned to clients whose response was blocked by the rule (defaults to naming the rule)
+	Message string `mapstructure:"message"`
+
+	// Endpoints restricts the rule to the named endpoints (all endpoints when empty)
+	Endpoints []string `mapstructure:"endpoints"`
+
+	// Detectors lists the redaction detectors to run on the output, e.g. "email" or "openai_key"
+	Detectors []string `mapstructure:"detectors"`
+
+	// DeniedDomains lists domains URLs in the output must not point to; subdomains are included
+	DeniedDomains []string `mapstructure:"denied_domains"`
+
+	// AllowedDomains, when set, makes URLs to any other domain a finding; subdomains are included
+	AllowedDomains []string `mapstructure:"allowed_domains"`
+
+	// Tools lists glob patterns of functions the model must not call, e.g. "delete_*"
+	Tools []string `mapstructure:"tools"`
+
+	// Pattern is a regular expression matched against the output
+	Pattern string `mapstructure:"pattern"`
+}
+
+// Guardrail actions
+const (
+	GuardrailFlag  = "flag"
+	GuardrailBlock = "block"
+)
+
+// InjectionConfig defines the prompt-injection heuristics run over tool results and retrieved documents
+// Matches are recorded, never blocked: they help find compromised agent runs after the fact
+type InjectionConfig struct {
+	// Enabled scores the content of tool results and retrieved documents in every request
+	// Default: false
+	Enabled bool `mapstructure:"enabled"`
+
+	// Detectors selects the built-in rules by ID (all of InjectionDetectors when empty)
+	Detectors []string `mapstructure:"detectors"`
+
+	// Patterns adds custom rules
+	Patterns []InjectionPattern `mapstructure:"patterns"`
+
+	// DocumentTags names the tags wrapping retrieved documents in user messages,
+	// e.g. "document" for <document>...</document>; user messages are not scanned when empty
+	// Default: ["document", "context", "search_results"]
+	DocumentTags []string `mapstructure:"document_tags"`
+}
+
+// InjectionPattern is a custom prompt-injection rule
+type InjectionPattern struct {
+	// ID identifies the rule in the matched rules of a tool result
+	ID string `mapstructure:"id"`
+
+	// Pattern is the regular expression to find
+	Pattern string `mapstructure:"pattern"`
+
+	// Weight is added to the risk score of content the pattern matches, from 1 to 100
+	// Default: 50
+	Weight int `mapstructure:"weight"`
+}
+
+// InjectionDetectors lists the built-in prompt-injection rules
+var InjectionDetectors = []string{
+	"instruction_override", "role_injection", "hidden_unicode", "exfil_url", "exfil_instruction",
+}
+
 // Load reads configuration from config.yaml and environment variables
 // Environment variables take precedence and must be prefixed with ABB_
 // Example: ABB_SERVER_PORT=9000
 func Load() (*Config, error) {
+	v := newViper()
+	v.AddConfigPath(".")
+	v.AddConfigPath("/app")
+
+	// Read config file
+	if err := v.ReadInConfig(); err != nil {
+		// Config file is optional if all values are provided via env vars
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+
+	return decode(v)
+}
+
+// loadFile loads the configuration from a known config file (used when reloading)
+func loadFile(path string) (*Config, error) {
+	v := newViper()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return decode(v)
+}
+
+// newViper returns a viper instance with the config file settings, env overrides and defaults
+func newViper() *viper.Viper {
 	v := viper.New()
 
 	// Set config file settings
 	v.SetConfigName("config")
 	v.SetConfigType("yaml")
-	v.AddConfigPath(".")
-	v.AddConfigPath("/app")
 
 	// Enable environment variable override with ABB_ prefix
 	v.SetEnvPrefix("ABB")
@@ -87,23 +818,34 @@ func Load() (*Config, error) {
 	// Set defaults
 	v.SetDefault("server.port", 8080)
 	v.SetDefault("server.genesis_seed", "aiblackbox-default-seed")
+	v.SetDefault("server.read_timeout", 30)
+	v.SetDefault("server.write_timeout", 30)
+	v.SetDefault("server.idle_timeout", 120)
+	v.SetDefault("server.upstream_response_header_timeout", 0)
 	v.SetDefault("storage.path", "./logs/audit.jsonl")
+	v.SetDefault("requests.max_body_size", 104857600)       // 100 MB
+	v.SetDefault("requests.max_audit_body_size", 10485760)  // 10 MB
+	v.SetDefault("requests.max_inspect_body_size", 1048576) // 1 MB
 	v.SetDefault("streaming.max_audit_body_size", 10485760) // 10 MB
 	v.SetDefault("streaming.stream_timeout", 300)           // 5 minutes
 	v.SetDefault("streaming.enable_sequence_tracking", true)
-	v.SetDefault("media.enable_extraction", true)    // Enable media extraction
-	v.SetDefault("media.min_size_kb", 100)           // 100 KB minimum
+	v.SetDefault("streaming.stall_threshold_ms", 2000) // 2 seconds
+	v.SetDefault("streaming.preserve_raw_stream", false)
+	v.SetDefault("streaming.raw_stream_storage", RawStreamStorageInline)
+	v.SetDefault("budgets.state_path", "./logs/budgets.json")
+	v.SetDefault("redaction.vault_path", "./vault/redaction.jsonl")
+	v.SetDefault("injection.document_tags", []string{"document", "context", "search_results"})
+	v.SetDefault("forward_proxy.ca_cert_file", "./certs/aiblackbox-ca.crt")
+	v.SetDefault("forward_proxy.ca_key_file", "./certs/aiblackbox-ca.key")
+	v.SetDefault("media.enable_extraction", true)      // Enable media extraction
+	v.SetDefault("media.min_size_kb", 100)             // 100 KB minimum
 	v.SetDefault("media.storage_path", "./logs/media") // Media storage directory
 
-	// Read config file
-	if err := v.ReadInConfig(); err != nil {
-		// Config file is optional if all values are provided via env vars
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("failed to read config file: %w", err)
-		}
-	}
+	return v
+}
 
-	// Unmarshal into struct
+// decode unmarshals and validates the configuration read by v
+func decode(v *viper.Viper) (*Config, error) {
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
@@ -127,6 +869,18 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("genesis_seed cannot be empty")
 	}
 
+	if c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		return fmt.Errorf("server read/write/idle timeouts cannot be negative")
+	}
+
+	if c.Server.UpstreamResponseHeaderTimeout < 0 {
+		return fmt.Errorf("server.upstream_response_header_timeout cannot be negative")
+	}
+
+	if err := c.Server.TLS.validate(); err != nil {
+		return err
+	}
+
 	if len(c.Endpoints) == 0 {
 		return fmt.Errorf("at least one endpoint must be defined")
 	}
@@ -137,9 +891,52 @@ func (c *Config) Validate() error {
 		if ep.Name == "" {
 			return fmt.Errorf("endpoint name cannot be empty")
 		}
-		if ep.Target == "" {
+		if ep.Target == "" && len(ep.Targets) == 0 {
 			return fmt.Errorf("endpoint target cannot be empty for: %s", ep.Name)
 		}
+		if ep.Target != "" && len(ep.Targets) > 0 {
+			return fmt.Errorf("endpoint %s cannot set both target and targets", ep.Name)
+		}
+		for _, t := range ep.Targets {
+			if t.URL == "" {
+				return fmt.Errorf("target url cannot be empty for endpoint: %s", ep.Name)
+			}
+			if t.Weight < 0 {
+				return fmt.Errorf("target weight cannot be negative for endpoint: %s", ep.Name)
+			}
+		}
+		switch ep.LoadBalancing {
+		case "", LoadBalancingRoundRobin, LoadBalancingLeastOutstanding:
+		default:
+			return fmt.Errorf("invalid load_balancing for endpoint %s: %s (must be round_robin or least_outstanding)", ep.Name, ep.LoadBalancing)
+		}
+		hc := ep.HealthCheck
+		if hc.Interval < 0 || hc.Timeout < 0 || hc.UnhealthyThreshold < 0 {
+			return fmt.Errorf("health_check settings cannot be negative for endpoint: %s", ep.Name)
+		}
+		rc := ep.Retry
+		if rc.MaxAttempts < 0 || rc.InitialBackoffMs < 0 || rc.MaxBackoffMs < 0 || rc.MaxRetryAfter < 0 {
+			return fmt.Errorf("retry settings cannot be negative for endpoint: %s", ep.Name)
+		}
+		for _, status := range rc.RetryOn {
+			if status < 400 || status > 599 {
+				return fmt.Errorf("invalid retry_on status for endpoint %s: %d (must be 4xx or 5xx)", ep.Name, status)
+			}
+		}
+		for _, hdr := range ep.Headers {
+			if hdr.Name == "" || hdr.Value == "" {
+				return fmt.Errorf("header name and value cannot be empty for endpoint: %s", ep.Name)
+			}
+			if strings.ContainsAny(hdr.Name, " :\r\n") || strings.ContainsAny(hdr.Value, "\r\n") {
+				return fmt.Errorf("invalid header %q for endpoint: %s", hdr.Name, ep.Name)
+			}
+		}
+		if (ep.TLS.CertFile == "") != (ep.TLS.KeyFile == "") {
+			return fmt.Errorf("tls cert_file and key_file must be set together for endpoint: %s", ep.Name)
+		}
+		if !validTLSVersion(ep.TLS.MinVersion) {
+			return fmt.Errorf("invalid tls min_version for endpoint %s: %s (must be one of %s)", ep.Name, ep.TLS.MinVersion, strings.Join(TLSVersions, ", "))
+		}
 		// Check for duplicate names
 		if endpointNames[ep.Name] {
 			return fmt.Errorf("duplicate endpoint name: %s", ep.Name)
@@ -151,6 +948,19 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("storage path cannot be empty")
 	}
 
+	// Validate request limits
+	if c.Requests.MaxBodySize < 0 {
+		return fmt.Errorf("requests.max_body_size cannot be negative")
+	}
+
+	if c.Requests.MaxAuditBodySize < 0 {
+		return fmt.Errorf("requests.max_audit_body_size cannot be negative")
+	}
+
+	if c.Requests.MaxInspectBodySize < 0 {
+		return fmt.Errorf("requests.max_inspect_body_size cannot be negative")
+	}
+
 	// Validate streaming configuration
 	if c.Streaming.MaxAuditBodySize <= 0 {
 		return fmt.Errorf("streaming.max_audit_body_size must be positive")
@@ -160,6 +970,184 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("streaming.stream_timeout must be positive")
 	}
 
+	if c.Streaming.StallThresholdMs < 0 {
+		return fmt.Errorf("streaming.stall_threshold_ms cannot be negative")
+	}
+
+	if c.Streaming.PreserveRawStream {
+		switch c.Streaming.RawStreamStorage {
+		case RawStreamStorageInline:
+		case RawStreamStorageSidecar:
+			if c.Media.StoragePath == "" {
+				return fmt.Errorf("media.storage_path cannot be empty when raw_stream_storage is sidecar")
+			}
+		default:
+			return fmt.Errorf("invalid streaming.raw_stream_storage: %s (must be inline or sidecar)", c.Streaming.RawStreamStorage)
+		}
+	}
+
+	// Validate pricing table
+	priced := make(map[string]bool)
+	for _, p := range c.Pricing {
+		if p.Model == "" {
+			return fmt.Errorf("pricing model cannot be empty")
+		}
+		if priced[p.Model] {
+			return fmt.Errorf("duplicate pricing model: %s", p.Model)
+		}
+		priced[p.Model] = true
+		if p.InputPerMillion < 0 || p.OutputPerMillion < 0 ||
+			(p.CachedInputPerMillion != nil && *p.CachedInputPerMillion < 0) {
+			return fmt.Errorf("prices cannot be negative for pricing model: %s", p.Model)
+		}
+	}
+
+	// Validate budgets
+	budgetNames := make(map[string]bool)
+	for _, b := range c.Budgets.Rules {
+		if b.Name == "" {
+			return fmt.Errorf("budget name cannot be empty")
+		}
+		if budgetNames[b.Name] {
+			return fmt.Errorf("duplicate budget name: %s", b.Name)
+		}
+		budgetNames[b.Name] = true
+
+		switch b.Scope {
+		case BudgetScopeEndpoint, BudgetScopeAPIKey, BudgetScopeTrace:
+		default:
+			return fmt.Errorf("invalid scope for budget %s: %s (must be endpoint, api_key or trace)", b.Name, b.Scope)
+		}
+		if b.Window <= 0 {
+			return fmt.Errorf("window must be positive for budget: %s", b.Name)
+		}
+		if b.MaxTokens < 0 || b.MaxCostUSD < 0 {
+			return fmt.Errorf("limits cannot be negative for budget: %s", b.Name)
+		}
+		if b.MaxTokens == 0 && b.MaxCostUSD == 0 {
+			return fmt.Errorf("budget %s must set max_tokens or max_cost_usd", b.Name)
+		}
+		for _, name := range b.Endpoints {
+			if !endpointNames[name] {
+				return fmt.Errorf("budget %s references unknown endpoint: %s", b.Name, name)
+			}
+		}
+	}
+
+	if len(c.Budgets.Rules) > 0 && c.Budgets.StatePath == "" {
+		return fmt.Errorf("budgets.state_path cannot be empty when budgets are defined")
+	}
+
+	// Validate rate limits
+	rateLimitNames := make(map[string]bool)
+	for _, rl := range c.RateLimits.Rules {
+		if rl.Name == "" {
+			return fmt.Errorf("rate limit name cannot be empty")
+		}
+		if rateLimitNames[rl.Name] {
+			return fmt.Errorf("duplicate rate limit name: %s", rl.Name)
+		}
+		rateLimitNames[rl.Name] = true
+
+		switch rl.Scope {
+		case RateLimitScopeEndpoint, RateLimitScopeClient:
+		default:
+			return fmt.Errorf("invalid scope for rate limit %s: %s (must be endpoint or client)", rl.Name, rl.Scope)
+		}
+		if rl.RequestsPerSecond < 0 || rl.Burst < 0 || rl.MaxConcurrentStreams < 0 {
+			return fmt.Errorf("limits cannot be negative for rate limit: %s", rl.Name)
+		}
+		if rl.RequestsPerSecond == 0 && rl.MaxConcurrentStreams == 0 {
+			return fmt.Errorf("rate limit %s must set requests_per_second or max_concurrent_streams", rl.Name)
+		}
+		for _, name := range rl.Endpoints {
+			if !endpointNames[name] {
+				return fmt.Errorf("rate limit %s references unknown endpoint: %s", rl.Name, name)
+			}
+		}
+	}
+
+	// Validate client authentication
+	if c.Auth.Enabled && len(c.Auth.Clients) == 0 && c.Auth.JWT.JWKSFile == "" {
+		return fmt.Errorf("auth is enabled but no clients or jwt.jwks_file are configured")
+	}
+	if c.Auth.JWT.Leeway < 0 {
+		return fmt.Errorf("auth jwt leeway cannot be negative")
+	}
+	clientNames := make(map[string]bool)
+	for _, client := range c.Auth.Clients {
+		if client.Name == "" {
+			return fmt.Errorf("auth client name cannot be empty")
+		}
+		if clientNames[client.Name] {
+			return fmt.Errorf("duplicate auth client name: %s", client.Name)
+		}
+		clientNames[client.Name] = true
+
+		if client.APIKeySHA256 == "" && client.CertCommonName == "" && c.Auth.JWT.JWKSFile == "" {
+			return fmt.Errorf("auth client %s must set api_key_sha256 or cert_common_name", client.Name)
+		}
+		if client.APIKeySHA256 != "" {
+			if key, err := hex.DecodeString(client.APIKeySHA256); err != nil || len(key) != sha256.Size {
+				return fmt.Errorf("auth client %s: api_key_sha256 must be a hex-encoded SHA-256 hash", client.Name)
+			}
+		}
+		for _, name := range client.Endpoints {
+			if !endpointNames[name] {
+				return fmt.Errorf("auth client %s references unknown endpoint: %s", client.Name, name)
+			}
+		}
+	}
+
+	// Validate forward-proxy mode
+	if c.ForwardProxy.Enabled {
+		if c.ForwardProxy.CACertFile == "" || c.ForwardProxy.CAKeyFile == "" {
+			return fmt.Errorf("forward_proxy ca_cert_file and ca_key_file cannot be empty")
+		}
+		if len(c.ForwardProxy.Hosts) == 0 {
+			return fmt.Errorf("forward_proxy is enabled but no hosts are configured")
+		}
+	}
+	forwardHosts := make(map[string]bool)
+	for _, fh := range c.ForwardProxy.Hosts {
+		if fh.Host == "" || strings.ContainsAny(fh.Host, "/ ") {
+			return fmt.Errorf("invalid forward_proxy host: %q", fh.Host)
+		}
+		host := strings.ToLower(fh.Host)
+		if forwardHosts[host] {
+			return fmt.Errorf("duplicate forward_proxy host: %s", fh.Host)
+		}
+		forwardHosts[host] = true
+		if !endpointNames[fh.Endpoint] {
+			return fmt.Errorf("forward_proxy host %s references unknown endpoint: %s", fh.Host, fh.Endpoint)
+		}
+	}
+
+	// Validate sanitization rules
+	if err := c.Sanitization.validate(); err != nil {
+		return err
+	}
+
+	// Validate redaction detectors
+	if err := c.Redaction.validate(); err != nil {
+		return err
+	}
+
+	// Validate request policies
+	if err := c.Policies.validate(endpointNames); err != nil {
+		return err
+	}
+
+	// Validate response guardrails
+	if err := c.Guardrails.validate(endpointNames); err != nil {
+		return err
+	}
+
+	// Validate prompt-injection rules
+	if err := c.Injection.validate(); err != nil {
+		return err
+	}
+
 	// Validate media configuration
 	if c.Media.MinSizeKB < 0 {
 		return fmt.Errorf("media.min_size_kb cannot be negative")
@@ -172,6 +1160,258 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// validate checks the header modes, strategies and patterns of the sanitization rules
+func (s SanitizationConfig) validate() error {
+	switch s.HeaderMode {
+	case "", HeaderModeDenylist, HeaderModeAllowlist:
+	default:
+		return fmt.Errorf("invalid sanitization.header_mode: %s (must be denylist or allowlist)", s.HeaderMode)
+	}
+
+	for i, rule := range s.Rules {
+		if len(rule.Headers) == 0 && rule.HeaderPattern == "" && len(rule.QueryParams) == 0 && rule.QueryPattern == "" {
+			return fmt.Errorf("sanitization rule %d must set headers, header_pattern, query_params or query_pattern", i+1)
+		}
+		for _, pattern := range []string{rule.HeaderPattern, rule.QueryPattern} {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("sanitization rule %d: invalid pattern %q: %w", i+1, pattern, err)
+			}
+		}
+		switch rule.Strategy {
+		case "", SanitizeMask, SanitizeRedact, SanitizeDrop, SanitizeKeepLast:
+		case SanitizeHMAC:
+			if s.HMACKey == "" {
+				return fmt.Errorf("sanitization rule %d uses the hmac strategy but sanitization.hmac_key is empty", i+1)
+			}
+		default:
+			return fmt.Errorf("invalid strategy for sanitization rule %d: %s (must be mask, redact, drop, hmac or keep_last)", i+1, rule.Strategy)
+		}
+		if rule.KeepLast < 0 {
+			return fmt.Errorf("sanitization rule %d: keep_last cannot be negative", i+1)
+		}
+	}
+	return nil
+}
+
+// validate checks the mode, detector names and patterns of the redaction settings
+func (r RedactionConfig) validate() error {
+	switch r.Mode {
+	case "", RedactionModeMask:
+	case RedactionModeTokenize:
+		if r.VaultPath == "" || r.VaultKey == "" {
+			return fmt.Errorf("redaction mode tokenize requires vault_path and vault_key")
+		}
+	default:
+		return fmt.Errorf("invalid redaction.mode: %s (must be mask or tokenize)", r.Mode)
+	}
+
+	for _, name := range r.Detectors {
+		if !slices.Contains(RedactionDetectors, name) {
+			return fmt.Errorf("unknown redaction detector: %s (must be one of %s)", name, strings.Join(RedactionDetectors, ", "))
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, p := range r.Patterns {
+		if p.Name == "" || strings.ContainsAny(p.Name, ":[] ") {
+			return fmt.Errorf("invalid redaction pattern name: %q", p.Name)
+		}
+		if names[p.Name] || slices.Contains(RedactionDetectors, p.Name) {
+			return fmt.Errorf("duplicate redaction detector name: %s", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.Pattern == "" {
+			return fmt.Errorf("redaction pattern %s: pattern cannot be empty", p.Name)
+		}
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("redaction pattern %s: invalid pattern: %w", p.Name, err)
+		}
+		if p.Validator != "" && !slices.Contains(RedactionValidators, p.Validator) {
+			return fmt.Errorf("redaction pattern %s: unknown validator %s (must be one of %s)", p.Name, p.Validator, strings.Join(RedactionValidators, ", "))
+		}
+	}
+	return nil
+}
+
+// validate checks the policy rules; endpoints are the names of the configured endpoints
+func (p PolicyConfig) validate(endpoints map[string]bool) error {
+	names := make(map[string]bool)
+	for _, rule := range p.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("policy name cannot be empty")
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate policy name: %s", rule.Name)
+		}
+		names[rule.Name] = true
+
+		switch rule.Action {
+		case PolicyAllow, PolicyDeny, PolicyFlag:
+			if rule.Mutate.MaxTokens != 0 || len(rule.Mutate.SetFields) > 0 {
+				return fmt.Errorf("policy %s: mutate is only allowed with action mutate", rule.Name)
+			}
+		case PolicyMutate:
+			if rule.Mutate.MaxTokens < 0 {
+				return fmt.Errorf("policy %s: mutate.max_tokens cannot be negative", rule.Name)
+			}
+			if rule.Mutate.MaxTokens == 0 && len(rule.Mutate.SetFields) == 0 {
+				return fmt.Errorf("policy %s must set mutate.max_tokens or mutate.set_fields", rule.Name)
+			}
+		default:
+			return fmt.Errorf("invalid action for policy %s: %s (must be allow, deny, flag or mutate)", rule.Name, rule.Action)
+		}
+
+		for _, name := range rule.Endpoints {
+			if !endpoints[name] {
+				return fmt.Errorf("policy %s references unknown endpoint: %s", rule.Name, name)
+			}
+		}
+
+		m := rule.Match
+		for _, pattern := range append(append([]string(nil), m.Models...), m.Paths...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("policy %s: invalid pattern %q", rule.Name, pattern)
+			}
+		}
+		for _, name := range m.Detectors {
+			if !slices.Contains(RedactionDetectors, name) {
+				return fmt.Errorf("policy %s: unknown detector %s (must be one of %s)", rule.Name, name, strings.Join(RedactionDetectors, ", "))
+			}
+		}
+		if _, err := regexp.Compile(m.BodyPattern); err != nil {
+			return fmt.Errorf("policy %s: invalid body_pattern: %w", rule.Name, err)
+		}
+		if m.MaxTokensAbove < 0 {
+			return fmt.Errorf("policy %s: max_tokens_above cannot be negative", rule.Name)
+		}
+	}
+	return nil
+}
+
+// validate checks the guardrail rules; endpoints are the names of the configured endpoints
+func (g GuardrailConfig) validate(endpoints map[string]bool) error {
+	names := make(map[string]bool)
+	for _, rule := range g.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("guardrail name cannot be empty")
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate guardrail name: %s", rule.Name)
+		}
+		names[rule.Name] = true
+
+		switch rule.Action {
+		case GuardrailFlag, GuardrailBlock:
+		default:
+			return fmt.Errorf("invalid action for guardrail %s: %s (must be flag or block)", rule.Name, rule.Action)
+		}
+
+		for _, name := range rule.Endpoints {
+			if !endpoints[name] {
+				return fmt.Errorf("guardrail %s references unknown endpoint: %s", rule.Name, name)
+			}
+		}
+		for _, name := range rule.Detectors {
+			if !slices.Contains(RedactionDetectors, name) {
+				return fmt.Errorf("guardrail %s: unknown detector %s (must be one of %s)", rule.Name, name, strings.Join(RedactionDetectors, ", "))
+			}
+		}
+		for _, domain := range append(append([]string(nil), rule.DeniedDomains...), rule.AllowedDomains...) {
+			if domain == "" || strings.ContainsAny(domain, "/:* ") {
+				return fmt.Errorf("guardrail %s: invalid domain %q", rule.Name, domain)
+			}
+		}
+		for _, pattern := range rule.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("guardrail %s: invalid tool pattern %q", rule.Name, pattern)
+			}
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("guardrail %s: invalid pattern: %w", rule.Name, err)
+		}
+
+		if len(rule.Detectors) == 0 && len(rule.DeniedDomains) == 0 && len(rule.AllowedDomains) == 0 &&
+			len(rule.Tools) == 0 && rule.Pattern == "" {
+			return fmt.Errorf("guardrail %s must set detectors, denied_domains, allowed_domains, tools or pattern", rule.Name)
+		}
+	}
+	return nil
+}
+
+// validate checks the prompt-injection rules
+func (i InjectionConfig) validate() error {
+	for _, id := range i.Detectors {
+		if !slices.Contains(InjectionDetectors, id) {
+			return fmt.Errorf("unknown injection detector: %s (must be one of %s)", id, strings.Join(InjectionDetectors, ", "))
+		}
+	}
+
+	ids := make(map[string]bool)
+	for _, p := range i.Patterns {
+		if p.ID == "" || strings.ContainsAny(p.ID, ", ") {
+			return fmt.Errorf("invalid injection pattern id: %q", p.ID)
+		}
+		if ids[p.ID] || slices.Contains(InjectionDetectors, p.ID) {
+			return fmt.Errorf("duplicate injection rule id: %s", p.ID)
+		}
+		ids[p.ID] = true
+
+		if p.Pattern == "" {
+			return fmt.Errorf("injection pattern %s: pattern cannot be empty", p.ID)
+		}
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("injection pattern %s: invalid pattern: %w", p.ID, err)
+		}
+		if p.Weight < 0 || p.Weight > 100 {
+			return fmt.Errorf("injection pattern %s: weight must be between 1 and 100", p.ID)
+		}
+	}
+
+	for _, tag := range i.DocumentTags {
+		if tag == "" || strings.ContainsAny(tag, "<>/ ") {
+			return fmt.Errorf("invalid injection document tag: %q", tag)
+		}
+	}
+	return nil
+}
+
+// validate checks the HTTPS settings of the server
+func (t ServerTLSConfig) validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("server.tls cert_file and key_file must be set together")
+	}
+	if !t.Enabled() && (t.ClientCAFile != "" || t.ClientAuth != "") {
+		return fmt.Errorf("server.tls client certificate settings require cert_file and key_file")
+	}
+	switch t.ClientAuth {
+	case "", TLSClientAuthNone:
+	case TLSClientAuthOptional, TLSClientAuthRequire:
+		if t.ClientCAFile == "" {
+			return fmt.Errorf("server.tls.client_auth %s requires client_ca_file", t.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("invalid server.tls.client_auth: %s (must be none, optional or require)", t.ClientAuth)
+	}
+	if !validTLSVersion(t.MinVersion) {
+		return fmt.Errorf("invalid server.tls.min_version: %s (must be one of %s)", t.MinVersion, strings.Join(TLSVersions, ", "))
+	}
+	return nil
+}
+
+// validTLSVersion reports whether v is empty (the default) or a supported min_version
+func validTLSVersion(v string) bool {
+	if v == "" {
+		return true
+	}
+	for _, known := range TLSVersions {
+		if v == known {
+			return true
+		}
+	}
+	return false
+}
+
 // GetEndpoint retrieves an endpoint configuration by name
 func (c *Config) GetEndpoint(name string) (EndpointConfig, bool) {
 	for _, ep := range c.Endpoints {
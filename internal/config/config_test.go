@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/spf13/viper"
@@ -241,3 +242,618 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+// TestServerTimeoutValidation verifies server and upstream timeouts cannot be negative
+func TestServerTimeoutValidation(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Server:    ServerConfig{Port: 8080, GenesisSeed: "test", ReadTimeout: 30, WriteTimeout: 30, IdleTimeout: 120},
+			Endpoints: []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+			Storage:   StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming: StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+		}
+	}
+
+	if err := newConfig().Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	cfg := newConfig()
+	cfg.Server.WriteTimeout = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative write timeout")
+	}
+
+	cfg = newConfig()
+	cfg.Server.UpstreamResponseHeaderTimeout = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative upstream response header timeout")
+	}
+}
+
+// TestPricingValidation verifies the per-model price table is validated
+func TestPricingValidation(t *testing.T) {
+	newConfig := func(prices ...ModelPrice) *Config {
+		return &Config{
+			Server:    ServerConfig{Port: 8080, GenesisSeed: "test"},
+			Endpoints: []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+			Storage:   StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming: StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+			Pricing:   prices,
+		}
+	}
+
+	if err := newConfig(ModelPrice{Model: "gpt-4o", InputPerMillion: 2.5, OutputPerMillion: 10}).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	if err := newConfig(ModelPrice{InputPerMillion: 1}).Validate(); err == nil {
+		t.Error("Expected error for empty pricing model")
+	}
+
+	if err := newConfig(ModelPrice{Model: "a"}, ModelPrice{Model: "a"}).Validate(); err == nil {
+		t.Error("Expected error for duplicate pricing model")
+	}
+
+	negative := -1.0
+	if err := newConfig(ModelPrice{Model: "a", CachedInputPerMillion: &negative}).Validate(); err == nil {
+		t.Error("Expected error for negative cached input price")
+	}
+}
+
+// TestBudgetValidation verifies budget rules are validated
+func TestBudgetValidation(t *testing.T) {
+	newConfig := func(rules ...BudgetRule) *Config {
+		return &Config{
+			Server:    ServerConfig{Port: 8080, GenesisSeed: "test"},
+			Endpoints: []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+			Storage:   StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming: StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+			Budgets:   BudgetConfig{StatePath: "/tmp/budgets.json", Rules: rules},
+		}
+	}
+
+	valid := BudgetRule{Name: "daily", Scope: BudgetScopeEndpoint, Endpoints: []string{"test"}, Window: 86400, MaxTokens: 1000}
+	if err := newConfig(valid).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*BudgetRule)
+	}{
+		{"empty name", func(r *BudgetRule) { r.Name = "" }},
+		{"invalid scope", func(r *BudgetRule) { r.Scope = "user" }},
+		{"zero window", func(r *BudgetRule) { r.Window = 0 }},
+		{"no limits", func(r *BudgetRule) { r.MaxTokens = 0 }},
+		{"negative cost", func(r *BudgetRule) { r.MaxCostUSD = -1 }},
+		{"unknown endpoint", func(r *BudgetRule) { r.Endpoints = []string{"missing"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := valid
+			tt.mutate(&rule)
+			if err := newConfig(rule).Validate(); err == nil {
+				t.Errorf("Expected validation error for %s", tt.name)
+			}
+		})
+	}
+
+	if err := newConfig(valid, valid).Validate(); err == nil {
+		t.Error("Expected error for duplicate budget name")
+	}
+}
+
+// TestRateLimitValidation verifies rate limit rules are validated
+func TestRateLimitValidation(t *testing.T) {
+	newConfig := func(rules ...RateLimitRule) *Config {
+		return &Config{
+			Server:     ServerConfig{Port: 8080, GenesisSeed: "test"},
+			Endpoints:  []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+			Storage:    StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming:  StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+			RateLimits: RateLimitConfig{Rules: rules},
+		}
+	}
+
+	valid := RateLimitRule{Name: "rps", Scope: RateLimitScopeClient, RequestsPerSecond: 5, Burst: 10, MaxConcurrentStreams: 2}
+	if err := newConfig(valid).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*RateLimitRule)
+	}{
+		{"empty name", func(r *RateLimitRule) { r.Name = "" }},
+		{"invalid scope", func(r *RateLimitRule) { r.Scope = "trace" }},
+		{"no limits", func(r *RateLimitRule) { r.RequestsPerSecond = 0; r.MaxConcurrentStreams = 0 }},
+		{"negative burst", func(r *RateLimitRule) { r.Burst = -1 }},
+		{"unknown endpoint", func(r *RateLimitRule) { r.Endpoints = []string{"missing"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := valid
+			tt.mutate(&rule)
+			if err := newConfig(rule).Validate(); err == nil {
+				t.Errorf("Expected validation error for %s", tt.name)
+			}
+		})
+	}
+
+	if err := newConfig(valid, valid).Validate(); err == nil {
+		t.Error("Expected error for duplicate rate limit name")
+	}
+}
+
+// TestUpstreamTargetsValidation verifies multi-target endpoints are validated
+func TestUpstreamTargetsValidation(t *testing.T) {
+	newConfig := func(ep EndpointConfig) *Config {
+		return &Config{
+			Server:    ServerConfig{Port: 8080, GenesisSeed: "test"},
+			Endpoints: []EndpointConfig{ep},
+			Storage:   StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming: StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+		}
+	}
+
+	valid := EndpointConfig{
+		Name:          "test",
+		Targets:       []UpstreamTarget{{URL: "http://a:8000", Weight: 3}, {URL: "http://b:8000"}},
+		LoadBalancing: LoadBalancingLeastOutstanding,
+		HealthCheck:   HealthCheckConfig{Path: "/health", Interval: 10, Timeout: 2, UnhealthyThreshold: 3},
+		Retry:         RetryConfig{MaxAttempts: 3, InitialBackoffMs: 200, MaxBackoffMs: 5000, MaxRetryAfter: 20, RetryOn: []int{429, 503}},
+		Headers:       []HeaderInjection{{Name: "Authorization", Value: "Bearer ${env:OPENAI_API_KEY}"}},
+		TLS:           UpstreamTLSConfig{CAFile: "ca.pem", CertFile: "client.crt", KeyFile: "client.key", ServerName: "models.internal", MinVersion: "1.3"},
+	}
+	if err := newConfig(valid).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	upstreams := valid.Upstreams()
+	if len(upstreams) != 2 || upstreams[0].Weight != 3 {
+		t.Errorf("Unexpected upstreams: %+v", upstreams)
+	}
+	single := EndpointConfig{Name: "single", Target: "http://a:8000"}.Upstreams()
+	if len(single) != 1 || single[0].URL != "http://a:8000" || single[0].Weight != 1 {
+		t.Errorf("Single target should be one upstream of weight 1, got %+v", single)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*EndpointConfig)
+	}{
+		{"target and targets", func(e *EndpointConfig) { e.Target = "http://c:8000" }},
+		{"empty target url", func(e *EndpointConfig) { e.Targets = []UpstreamTarget{{URL: ""}} }},
+		{"negative weight", func(e *EndpointConfig) { e.Targets = []UpstreamTarget{{URL: "http://a:8000", Weight: -1}} }},
+		{"invalid strategy", func(e *EndpointConfig) { e.LoadBalancing = "random" }},
+		{"negative interval", func(e *EndpointConfig) { e.HealthCheck.Interval = -1 }},
+		{"negative max attempts", func(e *EndpointConfig) { e.Retry.MaxAttempts = -1 }},
+		{"negative backoff", func(e *EndpointConfig) { e.Retry.InitialBackoffMs = -1 }},
+		{"non-error retry status", func(e *EndpointConfig) { e.Retry.RetryOn = []int{200} }},
+		{"empty header value", func(e *EndpointConfig) { e.Headers = []HeaderInjection{{Name: "Authorization"}} }},
+		{"invalid header name", func(e *EndpointConfig) { e.Headers = []HeaderInjection{{Name: "Api Key", Value: "x"}} }},
+		{"tls cert without key", func(e *EndpointConfig) { e.TLS = UpstreamTLSConfig{CertFile: "client.crt"} }},
+		{"invalid tls version", func(e *EndpointConfig) { e.TLS = UpstreamTLSConfig{MinVersion: "1.4"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := valid
+			ep.Targets = append([]UpstreamTarget(nil), valid.Targets...)
+			tt.mutate(&ep)
+			if err := newConfig(ep).Validate(); err == nil {
+				t.Errorf("Expected validation error for %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestAuthValidation(t *testing.T) {
+	newConfig := func(auth AuthConfig) *Config {
+		return &Config{
+			Server:    ServerConfig{Port: 8080, GenesisSeed: "test"},
+			Endpoints: []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+			Storage:   StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming: StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+			Auth:      auth,
+		}
+	}
+
+	keyHash := strings.Repeat("ab", 32)
+	valid := AuthConfig{
+		Enabled: true,
+		Clients: []AuthClient{
+			{Name: "billing-agent", APIKeySHA256: keyHash, Endpoints: []string{"test"}},
+			{Name: "ci", CertCommonName: "ci.internal"},
+		},
+	}
+	if err := newConfig(valid).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	jwtOnly := AuthConfig{Enabled: true, JWT: JWTConfig{JWKSFile: "/etc/aiblackbox/jwks.json"}}
+	if err := newConfig(jwtOnly).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error for JWT-only auth: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*AuthConfig)
+	}{
+		{"no clients or jwks", func(a *AuthConfig) { a.Clients = nil }},
+		{"negative leeway", func(a *AuthConfig) { a.JWT.Leeway = -1 }},
+		{"empty client name", func(a *AuthConfig) { a.Clients[0].Name = "" }},
+		{"duplicate client name", func(a *AuthConfig) { a.Clients[1].Name = "billing-agent" }},
+		{"client without credential", func(a *AuthConfig) { a.Clients[1].CertCommonName = "" }},
+		{"invalid key hash", func(a *AuthConfig) { a.Clients[0].APIKeySHA256 = "sk-plaintext" }},
+		{"unknown endpoint", func(a *AuthConfig) { a.Clients[0].Endpoints = []string{"missing"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := valid
+			auth.Clients = append([]AuthClient(nil), valid.Clients...)
+			tt.mutate(&auth)
+			if err := newConfig(auth).Validate(); err == nil {
+				t.Errorf("Expected validation error for %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestServerTLSValidation(t *testing.T) {
+	newConfig := func(tls ServerTLSConfig) *Config {
+		return &Config{
+			Server:    ServerConfig{Port: 8443, GenesisSeed: "test", TLS: tls},
+			Endpoints: []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+			Storage:   StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming: StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+		}
+	}
+
+	valid := ServerTLSConfig{CertFile: "server.crt", KeyFile: "server.key", ClientCAFile: "clients.pem", ClientAuth: TLSClientAuthOptional, MinVersion: "1.3"}
+	if err := newConfig(valid).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	if !valid.Enabled() || (ServerTLSConfig{}).Enabled() {
+		t.Error("TLS should be enabled exactly when a certificate is configured")
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*ServerTLSConfig)
+	}{
+		{"cert without key", func(c *ServerTLSConfig) { c.KeyFile = "" }},
+		{"client ca without cert", func(c *ServerTLSConfig) { c.CertFile, c.KeyFile = "", "" }},
+		{"invalid client auth", func(c *ServerTLSConfig) { c.ClientAuth = "always" }},
+		{"require without client ca", func(c *ServerTLSConfig) { c.ClientCAFile, c.ClientAuth = "", TLSClientAuthRequire }},
+		{"invalid min version", func(c *ServerTLSConfig) { c.MinVersion = "TLS1.2" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tls := valid
+			tt.mutate(&tls)
+			if err := newConfig(tls).Validate(); err == nil {
+				t.Errorf("Expected validation error for %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestForwardProxyValidation(t *testing.T) {
+	newConfig := func(fp ForwardProxyConfig) *Config {
+		return &Config{
+			Server:       ServerConfig{Port: 8080, GenesisSeed: "test"},
+			Endpoints:    []EndpointConfig{{Name: "openai", Target: "https://api.openai.com"}},
+			Storage:      StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming:    StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+			ForwardProxy: fp,
+		}
+	}
+
+	valid := ForwardProxyConfig{
+		Enabled:    true,
+		CACertFile: "./certs/ca.crt",
+		CAKeyFile:  "./certs/ca.key",
+		Hosts:      []ForwardProxyHost{{Host: "api.openai.com", Endpoint: "openai"}, {Host: "models.internal:8443", Endpoint: "openai"}},
+	}
+	if err := newConfig(valid).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*ForwardProxyConfig)
+	}{
+		{"no hosts", func(f *ForwardProxyConfig) { f.Hosts = nil }},
+		{"empty ca path", func(f *ForwardProxyConfig) { f.CAKeyFile = "" }},
+		{"empty host", func(f *ForwardProxyConfig) { f.Hosts[0].Host = "" }},
+		{"host with path", func(f *ForwardProxyConfig) { f.Hosts[0].Host = "api.openai.com/v1" }},
+		{"duplicate host", func(f *ForwardProxyConfig) { f.Hosts[1].Host = "API.openai.com" }},
+		{"unknown endpoint", func(f *ForwardProxyConfig) { f.Hosts[0].Endpoint = "missing" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := valid
+			fp.Hosts = append([]ForwardProxyHost(nil), valid.Hosts...)
+			tt.mutate(&fp)
+			if err := newConfig(fp).Validate(); err == nil {
+				t.Errorf("Expected validation error for %s", tt.name)
+			}
+		})
+	}
+}
+
+// TestSanitizationValidation verifies header modes, strategies and patterns are validated
+func TestSanitizationValidation(t *testing.T) {
+	newConfig := func(s SanitizationConfig) *Config {
+		return &Config{
+			Server:       ServerConfig{Port: 8080, GenesisSeed: "test"},
+			Endpoints:    []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+			Storage:      StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming:    StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+			Sanitization: s,
+		}
+	}
+
+	valid := SanitizationConfig{
+		HeaderMode:     HeaderModeAllowlist,
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		HMACKey:        "${env:AUDIT_HMAC_KEY}",
+		Rules: []SanitizationRule{
+			{Headers: []string{"X-Goog-Api-Key"}, Strategy: SanitizeHMAC},
+			{HeaderPattern: `^x-.*-token$`, QueryPattern: `secret`, Strategy: SanitizeKeepLast, KeepLast: 6},
+		},
+	}
+	if err := newConfig(valid).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*SanitizationConfig)
+	}{
+		{"invalid header mode", func(s *SanitizationConfig) { s.HeaderMode = "mask" }},
+		{"rule without names", func(s *SanitizationConfig) { s.Rules[0].Headers = nil }},
+		{"invalid pattern", func(s *SanitizationConfig) { s.Rules[1].QueryPattern = "(" }},
+		{"invalid strategy", func(s *SanitizationConfig) { s.Rules[1].Strategy = "hash" }},
+		{"hmac without key", func(s *SanitizationConfig) { s.HMACKey = "" }},
+		{"negative keep_last", func(s *SanitizationConfig) { s.Rules[1].KeepLast = -1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			s.Rules = append([]SanitizationRule(nil), valid.Rules...)
+			tt.mutate(&s)
+			if err := newConfig(s).Validate(); err == nil {
+				t.Errorf("Expected validation error for %s", tt.name)
+			}
+		})
+	}
+}
+
+// TestRedactionValidation verifies redaction detectors, patterns and vault settings are validated
+func TestRedactionValidation(t *testing.T) {
+	newConfig := func(r RedactionConfig) *Config {
+		return &Config{
+			Server:    ServerConfig{Port: 8080, GenesisSeed: "test"},
+			Endpoints: []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+			Storage:   StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming: StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+			Redaction: r,
+		}
+	}
+
+	valid := RedactionConfig{
+		Enabled:   true,
+		Detectors: []string{"email", "credit_card", "openai_key"},
+		Patterns: []RedactionPattern{
+			{Name: "employee_id", Pattern: `EMP-\d{6}`},
+			{Name: "account_number", Pattern: `\d{16}`, Validator: "luhn"},
+		},
+		Mode:      RedactionModeTokenize,
+		VaultPath: "/tmp/vault.jsonl",
+		VaultKey:  "${env:REDACTION_VAULT_KEY}",
+	}
+	if err := newConfig(valid).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*RedactionConfig)
+	}{
+		{"invalid mode", func(r *RedactionConfig) { r.Mode = "hash" }},
+		{"tokenize without key", func(r *RedactionConfig) { r.VaultKey = "" }},
+		{"tokenize without path", func(r *RedactionConfig) { r.VaultPath = "" }},
+		{"unknown detector", func(r *RedactionConfig) { r.Detectors = []string{"passport"} }},
+		{"pattern without name", func(r *RedactionConfig) { r.Patterns[0].Name = "" }},
+		{"pattern name with colon", func(r *RedactionConfig) { r.Patterns[0].Name = "emp:id" }},
+		{"duplicate pattern name", func(r *RedactionConfig) { r.Patterns[1].Name = "employee_id" }},
+		{"pattern shadowing detector", func(r *RedactionConfig) { r.Patterns[0].Name = "email" }},
+		{"empty pattern", func(r *RedactionConfig) { r.Patterns[0].Pattern = "" }},
+		{"invalid pattern", func(r *RedactionConfig) { r.Patterns[0].Pattern = "(" }},
+		{"unknown validator", func(r *RedactionConfig) { r.Patterns[1].Validator = "mod97" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid
+			r.Patterns = append([]RedactionPattern(nil), valid.Patterns...)
+			tt.mutate(&r)
+			if err := newConfig(r).Validate(); err == nil {
+				t.Errorf("Expected validation error for %s", tt.name)
+			}
+		})
+	}
+}
+
+// TestPolicyValidation verifies policy actions, conditions and mutations are validated
+func TestPolicyValidation(t *testing.T) {
+	newConfig := func(p PolicyConfig) *Config {
+		return &Config{
+			Server:    ServerConfig{Port: 8080, GenesisSeed: "test"},
+			Endpoints: []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+			Storage:   StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming: StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+			Policies:  p,
+		}
+	}
+
+	valid := PolicyConfig{Rules: []PolicyRule{
+		{Name: "no-secrets", Action: PolicyDeny, Endpoints: []string{"test"}, Match: PolicyMatch{Detectors: []string{"aws_access_key"}}},
+		{Name: "large-models", Action: PolicyFlag, Match: PolicyMatch{Models: []string{"gpt-4*"}, Paths: []string{"/v1/*"}, BodyPattern: `"tools"`}},
+		{Name: "cap-tokens", Action: PolicyMutate, Match: PolicyMatch{MaxTokensAbove: 4096}, Mutate: PolicyMutation{MaxTokens: 4096}},
+	}}
+	if err := newConfig(valid).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*PolicyConfig)
+	}{
+		{"empty name", func(p *PolicyConfig) { p.Rules[0].Name = "" }},
+		{"duplicate name", func(p *PolicyConfig) { p.Rules[1].Name = "no-secrets" }},
+		{"invalid action", func(p *PolicyConfig) { p.Rules[0].Action = "block" }},
+		{"unknown endpoint", func(p *PolicyConfig) { p.Rules[0].Endpoints = []string{"other"} }},
+		{"unknown detector", func(p *PolicyConfig) { p.Rules[0].Match.Detectors = []string{"passport"} }},
+		{"invalid model pattern", func(p *PolicyConfig) { p.Rules[1].Match.Models = []string{"gpt-["} }},
+		{"invalid body pattern", func(p *PolicyConfig) { p.Rules[1].Match.BodyPattern = "(" }},
+		{"negative max_tokens_above", func(p *PolicyConfig) { p.Rules[2].Match.MaxTokensAbove = -1 }},
+		{"mutate without changes", func(p *PolicyConfig) { p.Rules[2].Mutate = PolicyMutation{} }},
+		{"mutation on deny rule", func(p *PolicyConfig) { p.Rules[0].Mutate.MaxTokens = 100 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := PolicyConfig{Rules: append([]PolicyRule(nil), valid.Rules...)}
+			tt.mutate(&p)
+			if err := newConfig(p).Validate(); err == nil {
+				t.Errorf("Expected validation error for %s", tt.name)
+			}
+		})
+	}
+}
+
+// TestGuardrailValidation verifies guardrail actions and checks are validated
+func TestGuardrailValidation(t *testing.T) {
+	newConfig := func(g GuardrailConfig) *Config {
+		return &Config{
+			Server:     ServerConfig{Port: 8080, GenesisSeed: "test"},
+			Endpoints:  []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+			Storage:    StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming:  StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+			Guardrails: g,
+		}
+	}
+
+	valid := GuardrailConfig{Rules: []GuardrailRule{
+		{Name: "no-leaks", Action: GuardrailFlag, Detectors: []string{"email", "openai_key"}},
+		{Name: "no-deletes", Action: GuardrailBlock, Endpoints: []string{"test"}, Tools: []string{"delete_*"}, DeniedDomains: []string{"evil.test"}},
+		{Name: "internal", Action: GuardrailFlag, AllowedDomains: []string{"example.com"}, Pattern: `(?i)confidential`},
+	}}
+	if err := newConfig(valid).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*GuardrailConfig)
+	}{
+		{"empty name", func(g *GuardrailConfig) { g.Rules[0].Name = "" }},
+		{"duplicate name", func(g *GuardrailConfig) { g.Rules[1].Name = "no-leaks" }},
+		{"invalid action", func(g *GuardrailConfig) { g.Rules[0].Action = "deny" }},
+		{"unknown endpoint", func(g *GuardrailConfig) { g.Rules[1].Endpoints = []string{"other"} }},
+		{"unknown detector", func(g *GuardrailConfig) { g.Rules[0].Detectors = []string{"passport"} }},
+		{"domain with scheme", func(g *GuardrailConfig) { g.Rules[1].DeniedDomains = []string{"https://evil.test"} }},
+		{"invalid tool pattern", func(g *GuardrailConfig) { g.Rules[1].Tools = []string{"delete_["} }},
+		{"invalid pattern", func(g *GuardrailConfig) { g.Rules[2].Pattern = "(" }},
+		{"no checks", func(g *GuardrailConfig) { g.Rules[0].Detectors = nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := GuardrailConfig{Rules: append([]GuardrailRule(nil), valid.Rules...)}
+			tt.mutate(&g)
+			if err := newConfig(g).Validate(); err == nil {
+				t.Errorf("Expected validation error for %s", tt.name)
+			}
+		})
+	}
+}
+
+// TestInjectionValidation verifies the prompt-injection rules are checked
+func TestInjectionValidation(t *testing.T) {
+	newConfig := func(i InjectionConfig) *Config {
+		return &Config{
+			Server:    ServerConfig{Port: 8080, GenesisSeed: "test"},
+			Endpoints: []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+			Storage:   StorageConfig{Path: "/tmp/test.jsonl"},
+			Streaming: StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+			Injection: i,
+		}
+	}
+
+	newValid := func() InjectionConfig {
+		return InjectionConfig{
+			Enabled:      true,
+			Detectors:    []string{"instruction_override", "hidden_unicode"},
+			Patterns:     []InjectionPattern{{ID: "canary", Pattern: `CANARY-[0-9a-f]{8}`, Weight: 100}},
+			DocumentTags: []string{"document", "search_results"},
+		}
+	}
+	if err := newConfig(newValid()).Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*InjectionConfig)
+	}{
+		{"unknown detector", func(i *InjectionConfig) { i.Detectors = []string{"jailbreak"} }},
+		{"empty id", func(i *InjectionConfig) { i.Patterns[0].ID = "" }},
+		{"id with comma", func(i *InjectionConfig) { i.Patterns[0].ID = "a,b" }},
+		{"id of built-in rule", func(i *InjectionConfig) { i.Patterns[0].ID = "exfil_url" }},
+		{"empty pattern", func(i *InjectionConfig) { i.Patterns[0].Pattern = "" }},
+		{"invalid pattern", func(i *InjectionConfig) { i.Patterns[0].Pattern = "(" }},
+		{"weight too high", func(i *InjectionConfig) { i.Patterns[0].Weight = 101 }},
+		{"negative weight", func(i *InjectionConfig) { i.Patterns[0].Weight = -1 }},
+		{"tag with brackets", func(i *InjectionConfig) { i.DocumentTags = []string{"<document>"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newValid()
+			tt.mutate(&i)
+			if err := newConfig(i).Validate(); err == nil {
+				t.Errorf("Expected validation error for %s", tt.name)
+			}
+		})
+	}
+}
+
+// TestRequestInspectSizeValidation verifies a negative inspection size is rejected
+func TestRequestInspectSizeValidation(t *testing.T) {
+	cfg := &Config{
+		Server:    ServerConfig{Port: 8080, GenesisSeed: "test"},
+		Endpoints: []EndpointConfig{{Name: "test", Target: "http://localhost:8000"}},
+		Storage:   StorageConfig{Path: "/tmp/test.jsonl"},
+		Streaming: StreamingConfig{MaxAuditBodySize: 1024, StreamTimeout: 300},
+		Requests:  RequestConfig{MaxInspectBodySize: 4 << 20},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	cfg.Requests.MaxInspectBodySize = -1
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "max_inspect_body_size") {
+		t.Errorf("Expected max_inspect_body_size error, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// reloadDebounce waits for a burst of file events (editors often write a file in several steps)
+// to settle before the configuration is reloaded
+const reloadDebounce = 200 * time.Millisecond
+
+// restartOnlySections are applied when the process starts; a reload only records their change
+var restartOnlySections = map[string]bool{
+	"server":  true,
+	"storage": true,
+}
+
+// Hash returns the SHA-256 of the sanitized configuration, identifying the configuration in effect
+// Secrets are redacted before hashing so they cannot be recovered by guessing against the hash;
+// the hash can be recomputed from the sanitized configuration recorded in system events
+func (c *Config) Hash() string {
+	data, err := json.Marshal(c.Sanitized())
+	if err != nil {
+		// Config only holds plain data; this cannot happen
+		panic(fmt.Sprintf("config: failed to marshal configuration: %v", err))
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// Diff summarizes the changes from old to c, one line per added, removed or changed endpoint
+// and per changed section, e.g. "endpoint added: openai-eu" or "rate_limits changed"
+// Values are never included, so the summary is safe to log and audit
+func (c *Config) Diff(old *Config) []string {
+	var changes []string
+
+	oldEndpoints := make(map[string]EndpointConfig, len(old.Endpoints))
+	for _, ep := range old.Endpoints {
+		oldEndpoints[ep.Name] = ep
+	}
+	newEndpoints := make(map[string]bool, len(c.Endpoints))
+	for _, ep := range c.Endpoints {
+		newEndpoints[ep.Name] = true
+		prev, ok := oldEndpoints[ep.Name]
+		switch {
+		case !ok:
+			changes = append(changes, "endpoint added: "+ep.Name)
+		case !reflect.DeepEqual(prev, ep):
+			changes = append(changes, "endpoint changed: "+ep.Name)
+		}
+	}
+	for _, ep := range old.Endpoints {
+		if !newEndpoints[ep.Name] {
+			changes = append(changes, "endpoint removed: "+ep.Name)
+		}
+	}
+
+	oldValue, newValue := reflect.ValueOf(*old), reflect.ValueOf(*c)
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		if field.Name == "Endpoints" || reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			continue
+		}
+		section := field.Tag.Get("mapstructure")
+		if restartOnlySections[section] {
+			changes = append(changes, section+" changed (takes effect after restart)")
+		} else {
+			changes = append(changes, section+" changed")
+		}
+	}
+
+	return changes
+}
+
+// Watcher reloads the configuration when the config file changes
+// Reload can also be triggered directly (e.g. on SIGHUP); invalid configurations are logged
+// and never passed on, so the running configuration stays in effect
+type Watcher struct {
+	path     string
+	onChange func(*Config)
+
+	mu       sync.Mutex // Serializes reloads so onChange sees configurations in order
+	fsWatch  *fsnotify.Watcher
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Watch starts watching the config file found by Load and calls onChange with every valid
+// new configuration. Without a config file only explicit Reload calls are possible
+func Watch(onChange func(*Config)) (*Watcher, error) {
+	v := newViper()
+	v.AddConfigPath(".")
+	v.AddConfigPath("/app")
+	if err := v.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		return &Watcher{onChange: onChange, done: make(chan struct{})}, nil
+	}
+	return watchFile(v.ConfigFileUsed(), onChange)
+}
+
+// watchFile watches the directory of path, since editors and config management tools
+// often replace the file instead of writing it in place
+func watchFile(path string, onChange func(*Config)) (*Watcher, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	fsWatch, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch config file: %w", err)
+	}
+	if err := fsWatch.Add(filepath.Dir(path)); err != nil {
+		fsWatch.Close()
+		return nil, fmt.Errorf("failed to watch config file: %w", err)
+	}
+
+	w := &Watcher{path: path, onChange: onChange, fsWatch: fsWatch, done: make(chan struct{})}
+	go w.run()
+	return w, nil
+}
+
+// Path returns the watched config file, or "" if configuration comes from the environment only
+func (w *Watcher) Path() string {
+	return w.path
+}
+
+// run reloads once file events for the config file have settled
+func (w *Watcher) run() {
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			debounce.Stop()
+			return
+		case event, ok := <-w.fsWatch.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == w.path && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				debounce.Reset(reloadDebounce)
+			}
+		case err, ok := <-w.fsWatch.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("WARNING: Config file watch error: %v", err)
+		case <-debounce.C:
+			w.Reload("config file changed")
+		}
+	}
+}
+
+// Reload reads and validates the configuration, passing it to onChange if it is valid
+func (w *Watcher) Reload(reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+
+	var cfg *Config
+	var err error
+	if w.path != "" {
+		cfg, err = loadFile(w.path)
+	} else {
+		cfg, err = Load()
+	}
+	if err != nil {
+		log.Printf("ERROR: Configuration reload (%s) rejected, keeping the running configuration: %v", reason, err)
+		return
+	}
+
+	w.onChange(cfg)
+}
+
+// Close stops watching the config file
+// Returns once a reload in progress has finished; no reload happens afterwards
+func (w *Watcher) Close() {
+	w.stopOnce.Do(func() {
+		close(w.done)
+		if w.fsWatch != nil {
+			w.fsWatch.Close()
+		}
+	})
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDiff verifies the change summary names endpoints and sections without their values
+func TestDiff(t *testing.T) {
+	old := &Config{
+		Server: ServerConfig{Port: 8080},
+		Endpoints: []EndpointConfig{
+			{Name: "openai", Target: "https://api.openai.com"},
+			{Name: "legacy", Target: "http://legacy.internal"},
+		},
+		RateLimits: RateLimitConfig{Rules: []RateLimitRule{{Name: "default", Scope: RateLimitScopeEndpoint, RequestsPerSecond: 5}}},
+	}
+	updated := &Config{
+		Server: ServerConfig{Port: 9090},
+		Endpoints: []EndpointConfig{
+			{Name: "openai", Target: "https://eu.api.openai.com"},
+			{Name: "anthropic", Target: "https://api.anthropic.com"},
+		},
+		RateLimits: RateLimitConfig{Rules: []RateLimitRule{{Name: "default", Scope: RateLimitScopeEndpoint, RequestsPerSecond: 10}}},
+	}
+
+	got := updated.Diff(old)
+	want := []string{
+		"endpoint changed: openai",
+		"endpoint added: anthropic",
+		"endpoint removed: legacy",
+		"server changed (takes effect after restart)",
+		"rate_limits changed",
+	}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("Unexpected diff:\n got %v\nwant %v", got, want)
+	}
+	for _, change := range got {
+		if strings.Contains(change, "eu.api") || strings.Contains(change, "9090") {
+			t.Errorf("Diff should not include values: %s", change)
+		}
+	}
+
+	if changes := old.Diff(old); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+}
+
+// TestHash verifies the hash identifies the configuration
+func TestHash(t *testing.T) {
+	a := &Config{Endpoints: []EndpointConfig{{Name: "test", Target: "http://a"}}}
+	b := &Config{Endpoints: []EndpointConfig{{Name: "test", Target: "http://a"}}}
+	if a.Hash() != b.Hash() || len(a.Hash()) != 64 {
+		t.Errorf("Equal configurations should have the same hash: %s %s", a.Hash(), b.Hash())
+	}
+	b.Endpoints[0].Target = "http://b"
+	if a.Hash() == b.Hash() {
+		t.Error("Hash should change with the configuration")
+	}
+
+	// Secrets are redacted before hashing
+	c := &Config{Server: ServerConfig{GenesisSeed: "seed-one"}, Endpoints: a.Endpoints}
+	d := &Config{Server: ServerConfig{GenesisSeed: "seed-two"}, Endpoints: a.Endpoints}
+	if c.Hash() != d.Hash() {
+		t.Error("Hash should not depend on secret values")
+	}
+}
+
+// TestWatcher verifies valid config file changes are passed on and invalid ones rejected
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	write := func(target string) {
+		t.Helper()
+		content := "endpoints:\n  - name: \"test\"\n    target: \"" + target + "\"\n"
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+	write("http://first.internal")
+
+	reloaded := make(chan *Config, 10)
+	w, err := watchFile(path, func(cfg *Config) { reloaded <- cfg })
+	if err != nil {
+		t.Fatalf("Failed to watch config: %v", err)
+	}
+	defer w.Close()
+
+	next := func() *Config {
+		t.Helper()
+		select {
+		case cfg := <-reloaded:
+			return cfg
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for reload")
+			return nil
+		}
+	}
+
+	write("http://second.internal")
+	if cfg := next(); cfg.Endpoints[0].Target != "http://second.internal" {
+		t.Errorf("Expected reloaded target, got %s", cfg.Endpoints[0].Target)
+	}
+
+	// Invalid configurations are never passed on
+	write("")
+	time.Sleep(2 * reloadDebounce)
+	select {
+	case cfg := <-reloaded:
+		t.Errorf("Invalid config should be rejected, got %+v", cfg.Endpoints)
+	default:
+	}
+
+	// Explicit reloads (SIGHUP) read the file again, defaults included
+	write("http://third.internal")
+	w.Reload("SIGHUP")
+	if cfg := next(); cfg.Endpoints[0].Target != "http://third.internal" || cfg.Streaming.MaxAuditBodySize != 10485760 {
+		t.Errorf("Unexpected reloaded config: %+v", cfg)
+	}
+
+	w.Close()
+	for len(reloaded) > 0 {
+		<-reloaded
+	}
+	w.Reload("SIGHUP")
+	if len(reloaded) != 0 {
+		t.Error("No reload should happen after Close")
+	}
+}
@@ -0,0 +1,189 @@
+package guardrail
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+	"github.com/jnd-labs/aiblackbox/internal/redact"
+	"github.com/jnd-labs/aiblackbox/internal/trace"
+)
+
+// urlPattern finds http(s) URLs in model output, including inside JSON strings
+var urlPattern = regexp.MustCompile(`https?://[^\s"'<>\\)\]}]+`)
+
+// Engine checks completed responses against the guardrail rules
+// A nil Engine (no rules configured) finds nothing
+type Engine struct {
+	rules []rule
+}
+
+// rule is a compiled config.GuardrailRule
+type rule struct {
+	config.GuardrailRule
+	detectors *redact.Redactor
+	pattern   *regexp.Regexp
+}
+
+// New compiles the guardrail rules, or returns nil if there are none
+func New(cfg config.GuardrailConfig) (*Engine, error) {
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+
+	e := &Engine{}
+	for _, r := range cfg.Rules {
+		compiled := rule{GuardrailRule: r}
+		if len(r.Detectors) > 0 {
+			detectors, err := redact.New(config.RedactionConfig{Enabled: true, Detectors: r.Detectors}, "")
+			if err != nil {
+				return nil, fmt.Errorf("invalid detectors for guardrail %s: %w", r.Name, err)
+			}
+			compiled.detectors = detectors
+		}
+		if r.Pattern != "" {
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern for guardrail %s: %w", r.Name, err)
+			}
+			compiled.pattern = re
+		}
+		e.rules = append(e.rules, compiled)
+	}
+	return e, nil
+}
+
+// Blocks reports whether any block rule applies to the endpoint
+// Responses of such endpoints are buffered so they can be withheld from the client
+func (e *Engine) Blocks(endpoint string) bool {
+	if e == nil {
+		return false
+	}
+	for _, r := range e.rules {
+		if r.Action == config.GuardrailBlock && r.appliesTo(endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// Message returns what clients whose response was blocked by the named rule are told
+func (e *Engine) Message(ruleName string) string {
+	if e != nil {
+		for _, r := range e.rules {
+			if r.Name == ruleName && r.Message != "" {
+				return r.Message
+			}
+		}
+	}
+	return fmt.Sprintf("Response blocked by guardrail %q", ruleName)
+}
+
+// Check runs the rules of the endpoint over a response body
+// Findings are returned in rule order; each distinct value is reported once per rule
+func (e *Engine) Check(endpoint, body string) []models.Finding {
+	if e == nil || body == "" {
+		return nil
+	}
+
+	var urls []*url.URL
+	var toolCalls []models.ToolCallInfo
+	var findings []models.Finding
+	for _, r := range e.rules {
+		if !r.appliesTo(endpoint) {
+			continue
+		}
+		add := func(kind, value string) {
+			finding := models.Finding{Rule: r.Name, Action: r.Action, Kind: kind, Value: value}
+			if !slices.Contains(findings, finding) {
+				findings = append(findings, finding)
+			}
+		}
+
+		for _, name := range r.detectors.Detect(body) {
+			add(models.FindingDetector, name)
+		}
+
+		if len(r.DeniedDomains) > 0 || len(r.AllowedDomains) > 0 {
+			if urls == nil {
+				urls = findURLs(body)
+			}
+			for _, u := range urls {
+				host := strings.ToLower(u.Hostname())
+				if matchDomain(r.DeniedDomains, host) || (len(r.AllowedDomains) > 0 && !matchDomain(r.AllowedDomains, host)) {
+					add(models.FindingURL, host)
+				}
+			}
+		}
+
+		if len(r.Tools) > 0 {
+			if toolCalls == nil {
+				toolCalls = trace.DetectAllToolCalls(body)
+			}
+			for _, call := range toolCalls {
+				if matchAny(r.Tools, call.Function.Name) {
+					add(models.FindingToolCall, call.Function.Name)
+				}
+			}
+		}
+
+		if r.pattern != nil && r.pattern.MatchString(body) {
+			add(models.FindingPattern, "")
+		}
+	}
+	return findings
+}
+
+// Blocking returns the rule of the first blocking finding, or "" if no finding blocks
+func Blocking(findings []models.Finding) string {
+	for _, f := range findings {
+		if f.Action == config.GuardrailBlock {
+			return f.Rule
+		}
+	}
+	return ""
+}
+
+// appliesTo reports whether the rule checks responses of the endpoint
+func (r *rule) appliesTo(endpoint string) bool {
+	return len(r.Endpoints) == 0 || slices.Contains(r.Endpoints, endpoint)
+}
+
+// findURLs returns the URLs in body that have a host
+func findURLs(body string) []*url.URL {
+	urls := []*url.URL{}
+	for _, raw := range urlPattern.FindAllString(body, -1) {
+		// Trailing punctuation belongs to the sentence, not the URL
+		raw = strings.TrimRight(raw, ".,;:!?")
+		if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// matchDomain reports whether host is one of the domains or a subdomain of one
+func matchDomain(domains []string, host string) bool {
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether value matches any of the glob patterns
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
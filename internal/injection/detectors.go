@@ -0,0 +1,67 @@
+package injection
+
+import "regexp"
+
+// rule is a built-in or custom prompt-injection rule
+type rule struct {
+	id     string
+	weight int
+	match  func(string) bool
+}
+
+func (r rule) ID() string             { return r.id }
+func (r rule) Weight() int            { return r.weight }
+func (r rule) Match(text string) bool { return r.match(text) }
+
+// patternRule returns a rule matching text in which re finds a match
+func patternRule(id string, weight int, re *regexp.Regexp) rule {
+	return rule{id: id, weight: weight, match: re.MatchString}
+}
+
+// builtinRules are the rules listed in config.InjectionDetectors
+var builtinRules = []rule{
+	// Attempts to replace the instructions the agent was given
+	patternRule("instruction_override", 60, regexp.MustCompile(`(?i)`+
+		`\b(?:ignore|disregard|forget|override|bypass)\s+(?:(?:all|any|the|your|these|of)\s+)*(?:previous|prior|above|earlier|preceding|original|system)\s+(?:instructions?|prompts?|rules|directions|guidelines|messages|context)\b`+
+		`|\bnew\s+(?:system\s+)?instructions?\s*:`+
+		`|\byou\s+are\s+now\s+(?:in\s+)?(?:developer\s+mode|dan\b|jailbroken|unrestricted)`+
+		`|\bdo\s+not\s+(?:tell|inform|alert)\s+the\s+user\b`)),
+
+	// Fake conversation turns or chat template markers smuggled into content
+	patternRule("role_injection", 40, regexp.MustCompile(`(?im)`+
+		`^\s*(?:system|assistant)\s*:\s*\S`+
+		`|<\|im_(?:start|end)\|>|\[/?INST\]|<</?SYS>>|</?system>`)),
+
+	// Characters that are invisible to a human reviewer but read by the model
+	{id: "hidden_unicode", weight: 40, match: hasHiddenUnicode},
+
+	// URLs that carry data out when fetched, e.g. markdown images rendered by the client
+	patternRule("exfil_url", 50, regexp.MustCompile(`(?i)`+
+		`!\[[^\]]*\]\(\s*https?://[^\s)]+\?[^\s)]*=`+
+		`|https?://[^\s"'<>]+[?&][\w.-]+=(?:\{[^}\s]*\}|\$\{?[A-Za-z_]+\}?|<[A-Za-z_]+>|\[[A-Za-z_ ]+\])`+
+		`|https?://[^\s"'<>]+[?&][\w.-]+=[A-Za-z0-9+/_%=-]{64,}`)),
+
+	// Requests to hand over secrets or the conversation
+	patternRule("exfil_instruction", 40, regexp.MustCompile(`(?i)`+
+		`\b(?:send|post|forward|upload|leak|exfiltrate|transmit)\b[^.\n]{0,60}\b(?:api[\s_-]?keys?|passwords?|credentials|secrets?|access\s+tokens?|system\s+prompt|conversation(?:\s+history)?|chat\s+history)\b`+
+		`|\b(?:reveal|print|repeat|output)\s+(?:your\s+|the\s+)?(?:system\s+prompt|hidden\s+instructions)\b`)),
+}
+
+// hasHiddenUnicode reports whether text contains zero-width, bidirectional override or tag characters
+// A byte order mark at the very start is ignored
+func hasHiddenUnicode(text string) bool {
+	for i, r := range text {
+		switch {
+		case r >= 0x200B && r <= 0x200D, // Zero-width space, non-joiner, joiner
+			r >= 0x2060 && r <= 0x2064,   // Word joiner and invisible operators
+			r >= 0x202A && r <= 0x202E,   // Bidirectional embeddings and overrides
+			r >= 0x2066 && r <= 0x2069,   // Bidirectional isolates
+			r >= 0xE0000 && r <= 0xE007F, // Tag characters (ASCII smuggling)
+			r == 0x180E:                  // Mongolian vowel separator
+			return true
+		case r == 0xFEFF && i > 0:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package injection
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+	"github.com/jnd-labs/aiblackbox/internal/trace"
+)
+
+// defaultWeight is the weight of custom patterns that do not set one
+const defaultWeight = 50
+
+// Detector is a prompt-injection heuristic
+// The built-in rules and custom patterns implement it; further detectors can be added with Scanner.Add
+type Detector interface {
+	// ID identifies the rule in ToolResultInfo.InjectionRules
+	ID() string
+
+	// Weight is added to the risk score of content the detector matches, from 1 to 100
+	Weight() int
+
+	// Match reports whether text shows the injection pattern
+	Match(text string) bool
+}
+
+// Scanner scores tool results and retrieved documents for prompt-injection patterns
+// A nil Scanner (detection disabled) scores nothing
+type Scanner struct {
+	detectors []Detector
+	documents []*regexp.Regexp // One per document tag, capturing the document
+}
+
+// New builds the scanner for cfg, or returns nil if detection is disabled
+func New(cfg config.InjectionConfig) (*Scanner, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	s := &Scanner{}
+	for _, r := range builtinRules {
+		if len(cfg.Detectors) == 0 || slices.Contains(cfg.Detectors, r.id) {
+			s.detectors = append(s.detectors, r)
+		}
+	}
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid injection pattern %s: %w", p.ID, err)
+		}
+		weight := p.Weight
+		if weight == 0 {
+			weight = defaultWeight
+		}
+		s.detectors = append(s.detectors, patternRule(p.ID, weight, re))
+	}
+	for _, tag := range cfg.DocumentTags {
+		tag = regexp.QuoteMeta(tag)
+		s.documents = append(s.documents, regexp.MustCompile(`(?is)<`+tag+`(?:\s[^>]*)?>(.*?)</`+tag+`\s*>`))
+	}
+
+	return s, nil
+}
+
+// Add appends a detector to the scanner
+func (s *Scanner) Add(d Detector) {
+	s.detectors = append(s.detectors, d)
+}
+
+// Scan returns the risk score of text and the IDs of the detectors matching it, in detector order
+// The score is the sum of the weights of the matching detectors, capped at 100
+func (s *Scanner) Scan(text string) (int, []string) {
+	if s == nil || text == "" {
+		return 0, nil
+	}
+
+	score := 0
+	var ids []string
+	for _, d := range s.detectors {
+		if d.Match(text) {
+			score += d.Weight()
+			ids = append(ids, d.ID())
+		}
+	}
+	return min(score, 100), ids
+}
+
+// Documents returns the retrieved documents wrapped in the document tags of the user messages
+func (s *Scanner) Documents(requestBody string) []string {
+	if s == nil || len(s.documents) == 0 {
+		return nil
+	}
+
+	var documents []string
+	for _, text := range trace.UserMessageTexts(requestBody) {
+		for _, re := range s.documents {
+			for _, m := range re.FindAllStringSubmatch(text, -1) {
+				documents = append(documents, m[1])
+			}
+		}
+	}
+	return documents
+}
+
+// Inspect scores the tool results and retrieved documents of a request and records the matches
+// Each tool result on the trace gets its own score and rules, and matching documents are added to
+// the trace documents (both covered by the hash chain); the highest score, all matched rules and
+// where they were found are added to the trace attributes
+// Must run after trace.EnrichTraceContext, which records the tool results of the request
+func (s *Scanner) Inspect(traceContext *models.TraceContext, requestBody string) {
+	if s == nil || traceContext == nil {
+		return
+	}
+
+	risk := 0
+	var rules, sources []string
+	record := func(source string, score int, ids []string) {
+		if score == 0 {
+			return
+		}
+		risk = max(risk, score)
+		for _, id := range ids {
+			if !slices.Contains(rules, id) {
+				rules = append(rules, id)
+			}
+		}
+		if !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+
+	for i := range traceContext.ToolResults {
+		tr := &traceContext.ToolResults[i]
+		tr.InjectionRisk, tr.InjectionRules = s.Scan(tr.Content)
+		record("tool_result", tr.InjectionRisk, tr.InjectionRules)
+	}
+	for i, document := range s.Documents(requestBody) {
+		score, ids := s.Scan(document)
+		if score == 0 {
+			continue
+		}
+		hash := sha256.Sum256([]byte(document))
+		traceContext.Documents = append(traceContext.Documents, models.DocumentInfo{
+			Index:          i,
+			ContentHash:    hex.EncodeToString(hash[:]),
+			InjectionRisk:  score,
+			InjectionRules: ids,
+		})
+		record("document", score, ids)
+	}
+
+	if risk == 0 {
+		return
+	}
+
+	if traceContext.Attributes == nil {
+		traceContext.Attributes = make(map[string]string)
+	}
+	traceContext.Attributes["injection_risk"] = strconv.Itoa(risk)
+	traceContext.Attributes["injection_rules"] = strings.Join(rules, ",")
+	traceContext.Attributes["injection_sources"] = strings.Join(sources, ",")
+
+	log.Printf("WARNING: Possible prompt injection: trace=%s, span=%s, risk=%d, rules=%s, sources=%s",
+		traceContext.TraceID, traceContext.SpanID, risk, strings.Join(rules, ","), strings.Join(sources, ","))
+}
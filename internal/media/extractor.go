@@ -128,6 +128,53 @@ func (e *Extractor) saveMedia(data []byte, sequenceID uint64, bodyType string, i
 	return relativePath, nil
 }
 
+// SaveBlob stores an opaque sidecar blob (e.g. a compressed raw stream) next to extracted media
+// Unlike image extraction this does not depend on enable_extraction
+// Returns the path relative to the media storage directory
+func (e *Extractor) SaveBlob(data []byte, sequenceID uint64, name string, ext string) (string, error) {
+	now := time.Now()
+	dateDir := now.Format("2006-01-02")
+	fullDir := filepath.Join(e.storagePath, dateDir)
+
+	if err := os.MkdirAll(fullDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create media directory: %w", err)
+	}
+
+	// Generate filename: seq_{N}_{name}.{ext}
+	filename := fmt.Sprintf("seq_%d_%s.%s", sequenceID, name, ext)
+	if err := os.WriteFile(filepath.Join(fullDir, filename), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write blob file: %w", err)
+	}
+
+	return filepath.Join(dateDir, filename), nil
+}
+
+// ApplyReferences replaces inline Base64 images with the placeholders of matching references
+// Mirrors ExtractFromBody without writing files, so a body rebuilt from a raw source can be
+// compared against a stored body whose images were extracted
+func ApplyReferences(body string, references []models.MediaReference) string {
+	if len(references) == 0 {
+		return body
+	}
+
+	placeholders := make(map[string]string, len(references))
+	for _, ref := range references {
+		placeholders[ref.SHA256] = ref.Placeholder
+	}
+
+	return base64ImagePattern.ReplaceAllStringFunc(body, func(match string) string {
+		parts := base64ImagePattern.FindStringSubmatch(match)
+		if len(parts) < 3 {
+			return match
+		}
+		hash := sha256.Sum256([]byte(parts[2]))
+		if placeholder, ok := placeholders[hex.EncodeToString(hash[:])]; ok {
+			return placeholder
+		}
+		return match
+	})
+}
+
 // DetectBase64Images checks if body contains Base64 images
 // Returns true if at least one Base64 image is detected
 func DetectBase64Images(body string) bool {
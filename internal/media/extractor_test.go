@@ -1,6 +1,8 @@
 package media
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"path/filepath"
 	"strings"
@@ -450,3 +452,89 @@ func TestExtractFromBody_RealBase64PNG(t *testing.T) {
 		}
 	}
 }
+
+// TestApplyReferences verifies placeholders are re-applied to a body rebuilt from its raw source
+func TestApplyReferences(t *testing.T) {
+	tempDir := t.TempDir()
+	extractor := NewExtractor(true, 10, tempDir)
+
+	largeData := strings.Repeat("ABCD", 5000)
+	smallData := "iVBORw0KGgo="
+	body := `{"a": "data:image/png;base64,` + largeData + `", "b": "data:image/png;base64,` + smallData + `"}`
+
+	extractedBody, refs, err := extractor.ExtractFromBody(body, 7, "response")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := ApplyReferences(body, refs); got != extractedBody {
+		t.Errorf("ApplyReferences should reproduce the extracted body:\nexpected: %s\ngot:      %s", extractedBody, got)
+	}
+
+	if got := ApplyReferences(body, nil); got != body {
+		t.Error("Body without references should be returned unchanged")
+	}
+}
+
+// TestSaveBlob verifies sidecar blobs are written regardless of extraction settings
+func TestSaveBlob(t *testing.T) {
+	tempDir := t.TempDir()
+	extractor := NewExtractor(false, 100, tempDir)
+
+	path, err := extractor.SaveBlob([]byte("blob"), 42, "raw_stream", "sse.gz")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.HasSuffix(path, "seq_42_raw_stream.sse.gz") {
+		t.Errorf("Unexpected blob path: %s", path)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tempDir, path))
+	if err != nil || string(data) != "blob" {
+		t.Errorf("Blob not written correctly: %v", err)
+	}
+}
+
+func TestSaveTrack(t *testing.T) {
+	tempDir := t.TempDir()
+	extractor := NewExtractor(true, 100, tempDir)
+
+	track, err := extractor.NewTrack("ws_client_audio", "audio/pcm", "pcm")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if start, end, _ := track.Append([]byte("abc")); start != 0 || end != 3 {
+		t.Errorf("Expected range 0-3, got %d-%d", start, end)
+	}
+	if start, end, _ := track.Append([]byte("de")); start != 3 || end != 5 {
+		t.Errorf("Expected range 3-5, got %d-%d", start, end)
+	}
+
+	ref, err := extractor.SaveTrack(track, 7, "[AUDIO_EXTRACTED:client]")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(ref.FilePath, "seq_7_ws_client_audio.pcm") || ref.Type != "audio/pcm" || ref.SizeBytes != 5 {
+		t.Errorf("Unexpected reference: %+v", ref)
+	}
+	hash := sha256.Sum256([]byte("abcde"))
+	if ref.SHA256 != hex.EncodeToString(hash[:]) {
+		t.Errorf("SHA256 should cover the track bytes, got %s", ref.SHA256)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tempDir, ref.FilePath))
+	if err != nil || string(data) != "abcde" {
+		t.Errorf("Track not written correctly: %v", err)
+	}
+
+	// Temporary files are gone once the track is saved
+	temps, _ := filepath.Glob(filepath.Join(tempDir, ".track-*"))
+	if len(temps) != 0 {
+		t.Errorf("Temporary track files left behind: %v", temps)
+	}
+
+	if track, err := NewExtractor(false, 100, tempDir).NewTrack("x", "audio/pcm", "pcm"); track != nil || err != nil {
+		t.Error("Disabled extractor should not start tracks")
+	}
+}
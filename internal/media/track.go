@@ -0,0 +1,96 @@
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/models"
+)
+
+// Track accumulates a media stream that arrives in pieces (e.g. the audio of a realtime session)
+// Pieces are written to a temporary file under the storage path until the audit sequence ID is
+// known, so long sessions are not held in memory
+type Track struct {
+	file      *os.File
+	mediaType string
+	name      string
+	ext       string
+	size      int64
+	hash      hash.Hash
+	err       error
+}
+
+// NewTrack starts a track stored as seq_{N}_{name}.{ext} once saved
+// Returns nil if extraction is disabled, in which case the caller keeps the media inline
+func (e *Extractor) NewTrack(name, mediaType, ext string) (*Track, error) {
+	if !e.enabled {
+		return nil, nil
+	}
+	if err := os.MkdirAll(e.storagePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create media directory: %w", err)
+	}
+	file, err := os.CreateTemp(e.storagePath, ".track-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create track file: %w", err)
+	}
+	return &Track{file: file, mediaType: mediaType, name: name, ext: ext, hash: sha256.New()}, nil
+}
+
+// Append adds decoded media to the track and returns the byte range it occupies
+func (t *Track) Append(data []byte) (int64, int64, error) {
+	if t.err != nil {
+		return 0, 0, t.err
+	}
+	if _, err := t.file.Write(data); err != nil {
+		t.err = fmt.Errorf("failed to write track: %w", err)
+		return 0, 0, t.err
+	}
+	t.hash.Write(data)
+	start := t.size
+	t.size += int64(len(data))
+	return start, t.size, nil
+}
+
+// Size returns the number of bytes appended so far
+func (t *Track) Size() int64 {
+	return t.size
+}
+
+// SaveTrack moves a finished track next to the other media of the audit entry
+// The reference's SHA256 covers the decoded track bytes
+func (e *Extractor) SaveTrack(t *Track, sequenceID uint64, placeholder string) (*models.MediaReference, error) {
+	if err := t.file.Close(); err != nil && t.err == nil {
+		t.err = err
+	}
+	if t.err != nil {
+		os.Remove(t.file.Name())
+		return nil, t.err
+	}
+
+	dateDir := time.Now().Format("2006-01-02")
+	fullDir := filepath.Join(e.storagePath, dateDir)
+	if err := os.MkdirAll(fullDir, 0755); err != nil {
+		os.Remove(t.file.Name())
+		return nil, fmt.Errorf("failed to create media directory: %w", err)
+	}
+
+	filename := fmt.Sprintf("seq_%d_%s.%s", sequenceID, t.name, t.ext)
+	if err := os.Rename(t.file.Name(), filepath.Join(fullDir, filename)); err != nil {
+		os.Remove(t.file.Name())
+		return nil, fmt.Errorf("failed to store track: %w", err)
+	}
+	os.Chmod(filepath.Join(fullDir, filename), 0644)
+
+	return &models.MediaReference{
+		Type:        t.mediaType,
+		FilePath:    filepath.Join(dateDir, filename),
+		SHA256:      hex.EncodeToString(t.hash.Sum(nil)),
+		SizeBytes:   t.size,
+		Placeholder: placeholder,
+	}, nil
+}
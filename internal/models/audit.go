@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // SpanType represents the type of span in an agentic workflow
 type SpanType string
@@ -50,11 +53,28 @@ type TraceContext struct {
 	SpanName string `json:"span_name,omitempty"`
 
 	// ToolCall contains structured tool calling information (OpenAI format)
+	// Always the first entry of ToolCalls, kept for backward compatibility
 	ToolCall *ToolCallInfo `json:"tool_call,omitempty"`
 
 	// ToolResult contains structured tool result information
+	// Always the first entry of ToolResults, kept for backward compatibility
 	ToolResult *ToolResultInfo `json:"tool_result,omitempty"`
 
+	// ToolCalls contains every tool call in the response (parallel tool calling)
+	// Each call carries its own child SpanID
+	ToolCalls []ToolCallInfo `json:"tool_calls,omitempty"`
+
+	// ToolResults contains every tool result in the request
+	// Each result links to the child span of the tool call that produced it
+	ToolResults []ToolResultInfo `json:"tool_results,omitempty"`
+
+	// Documents lists the retrieved documents in the request matching prompt-injection rules
+	Documents []DocumentInfo `json:"documents,omitempty"`
+
+	// Attempts contains a child span for every upstream attempt (retries and failovers)
+	// Only set when the request took more than one attempt
+	Attempts []AttemptSpan `json:"attempts,omitempty"`
+
 	// Attributes contains additional span metadata
 	Attributes map[string]string `json:"attributes,omitempty"`
 }
@@ -73,6 +93,10 @@ type ToolCallInfo struct {
 
 	// Index is the position in the tool_calls array (for multiple parallel calls)
 	Index int `json:"index,omitempty"`
+
+	// SpanID is the child span ID for this tool call, derived from ID
+	// Child of the TraceContext.SpanID of the entry that requested the call
+	SpanID string `json:"span_id,omitempty"`
 }
 
 // FunctionCall represents a function invocation
@@ -106,8 +130,69 @@ type ToolResultInfo struct {
 
 	// ErrorMessage contains error details if IsError is true
 	ErrorMessage string `json:"error_message,omitempty"`
+
+	// LinkedSpanID is the child span ID of the tool call this result answers
+	// Matches ToolCallInfo.SpanID on the TOOL_CALL entry (span link)
+	LinkedSpanID string `json:"linked_span_id,omitempty"`
+
+	// InjectionRisk is the prompt-injection risk score of Content, from 0 (nothing matched) to 100
+	InjectionRisk int `json:"injection_risk,omitempty"`
+
+	// InjectionRules lists the IDs of the prompt-injection rules matching Content
+	InjectionRules []string `json:"injection_rules,omitempty"`
 }
 
+// DocumentInfo is a retrieved document in the user messages of a request (see injection.document_tags)
+type DocumentInfo struct {
+	// Index is the 0-based position of the document among the documents of the request
+	Index int `json:"index"`
+
+	// ContentHash is SHA256(content of the document) for integrity verification
+	ContentHash string `json:"content_hash"`
+
+	// InjectionRisk is the prompt-injection risk score of the document, from 0 (nothing matched) to 100
+	InjectionRisk int `json:"injection_risk,omitempty"`
+
+	// InjectionRules lists the IDs of the prompt-injection rules matching the document
+	InjectionRules []string `json:"injection_rules,omitempty"`
+}
+
+// AttemptSpan is the child span of a single upstream attempt
+type AttemptSpan struct {
+	// SpanID is the child span ID, derived from the parent SpanID and the attempt number
+	// Matches UpstreamAttempt.SpanID in the entry's upstream details
+	SpanID string `json:"span_id"`
+
+	// Attempt is the 1-based position of the attempt
+	Attempt int `json:"attempt"`
+
+	// Target is the URL of the upstream tried
+	Target string `json:"target"`
+
+	// StatusCode is the upstream response status (0 if no response was received)
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Error describes a connection-level failure
+	Error string `json:"error,omitempty"`
+
+	// Outcome is what the proxy did with the attempt's result
+	Outcome AttemptOutcome `json:"outcome"`
+}
+
+// AttemptOutcome describes what happened to the result of an upstream attempt
+type AttemptOutcome string
+
+const (
+	// AttemptServed means the result was returned to the client
+	AttemptServed AttemptOutcome = "served"
+
+	// AttemptFailedOver means the result was discarded in favour of another target
+	AttemptFailedOver AttemptOutcome = "failed_over"
+
+	// AttemptRetried means the result was discarded and the request retried after a backoff
+	AttemptRetried AttemptOutcome = "retried"
+)
+
 // MediaReference represents an extracted media file that was offloaded from the audit log
 type MediaReference struct {
 	// Type is the media type (e.g., "image/png", "image/jpeg")
@@ -159,6 +244,273 @@ type AuditEntry struct {
 	// Trace contains distributed tracing metadata for agentic workflows
 	// Optional field - maintains backward compatibility when omitted
 	Trace *TraceContext `json:"trace,omitempty"`
+
+	// Upstream records which upstream target served the request and every attempt made
+	// Omitted for requests rejected before reaching an upstream
+	Upstream *UpstreamDetails `json:"upstream,omitempty"`
+
+	// Usage contains the token counts reported by the provider and the computed cost
+	// Omitted when the response carries no usage block
+	Usage *TokenUsage `json:"usage,omitempty"`
+
+	// Principal is the authenticated client that made the call
+	// Omitted when client authentication is disabled or the request failed to authenticate
+	Principal *Principal `json:"principal,omitempty"`
+
+	// WebSocket is the transcript of a proxied WebSocket session (e.g. a realtime API session)
+	// One entry is written per session when it ends; nil for regular HTTP requests
+	WebSocket *WebSocketSession `json:"websocket,omitempty"`
+
+	// Redactions lists the personal data and secrets replaced in the bodies before they were hashed and stored
+	Redactions []RedactionFinding `json:"redactions,omitempty"`
+
+	// Policy is the outcome of the request policies, including for requests they denied
+	// Omitted when no policies are configured
+	Policy *PolicyDecision `json:"policy,omitempty"`
+
+	// Findings lists what the response guardrails found in the completion
+	Findings []Finding `json:"findings,omitempty"`
+
+	// System records an event of the proxy itself (e.g. a configuration reload) rather than a request
+	// System entries have no endpoint, request or response
+	System *SystemEvent `json:"system,omitempty"`
+}
+
+// RedactionFinding is a sensitive value replaced in an audited body
+type RedactionFinding struct {
+	// Detector names the detector that fired, e.g. "email" or "aws_access_key"
+	Detector string `json:"detector"`
+
+	// Location is the body the value was found in, e.g. "request.body", "response.body"
+	// or "websocket.events[3].payload"
+	Location string `json:"location"`
+
+	// Start and End are the byte offsets of the replacement within the stored body
+	Start int `json:"start"`
+	End   int `json:"end"`
+
+	// Token identifies the vault record holding the original value (tokenize mode only)
+	Token string `json:"token,omitempty"`
+}
+
+// PolicyDecision records how the request policies treated a request
+type PolicyDecision struct {
+	// Action is the outcome: "deny" (refused), "mutate" (forwarded rewritten), "flag" (forwarded
+	// and flagged) or "allow"; deny wins over mutate, mutate over flag
+	Action string `json:"action"`
+
+	// Rule names the rule that decided the outcome; empty when no rule matched
+	Rule string `json:"rule,omitempty"`
+
+	// Matches lists every rule that matched, in evaluation order
+	Matches []PolicyMatch `json:"matches,omitempty"`
+
+	// Mutations describes the changes made to the forwarded body, e.g. "max_tokens: 8000 -> 1024"
+	Mutations []string `json:"mutations,omitempty"`
+}
+
+// PolicyMatch is a policy rule that matched a request
+type PolicyMatch struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+
+	// Reasons lists the conditions that matched, e.g. "model gpt-4-32k" or "missing header X-Trace-ID"
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Policy decision actions
+const (
+	PolicyAllow  = "allow"
+	PolicyDeny   = "deny"
+	PolicyFlag   = "flag"
+	PolicyMutate = "mutate"
+)
+
+// Finding is a response guardrail check that fired
+type Finding struct {
+	// Rule names the guardrail rule and Action its action ("flag" or "block")
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+
+	// Kind is the check that fired: "detector", "url", "tool_call" or "pattern"
+	Kind string `json:"kind"`
+
+	// Value identifies what was found without repeating sensitive content: the detector name,
+	// the URL's host or the function name; empty for patterns
+	Value string `json:"value,omitempty"`
+}
+
+// Finding kinds
+const (
+	FindingDetector = "detector"
+	FindingURL      = "url"
+	FindingToolCall = "tool_call"
+	FindingPattern  = "pattern"
+)
+
+// SystemEvent is a change to the proxy recorded in the hash chain
+type SystemEvent struct {
+	// Type identifies the event, e.g. "startup" or "config_changed"
+	Type string `json:"type"`
+
+	// ConfigHash is the SHA-256 of the configuration in effect after the event, computed over
+	// the sanitized configuration recorded in Config
+	ConfigHash string `json:"config_hash,omitempty"`
+
+	// Changes summarizes what changed, e.g. "endpoint added: openai-eu"; values are never included
+	Changes []string `json:"changes,omitempty"`
+
+	// Config is the configuration in effect after the event, with secrets redacted
+	Config json.RawMessage `json:"config,omitempty"`
+
+	// Version is the build version of the proxy (startup only)
+	Version string `json:"version,omitempty"`
+
+	// Host is the host name of the machine or container running the proxy (startup only)
+	Host string `json:"host,omitempty"`
+}
+
+// System event types
+const (
+	SystemEventStartup       = "startup"
+	SystemEventConfigChanged = "config_changed"
+)
+
+// WebSocketSession records the messages exchanged over a WebSocket session
+type WebSocketSession struct {
+	// Subprotocol is the Sec-WebSocket-Protocol selected by the upstream
+	Subprotocol string `json:"subprotocol,omitempty"`
+
+	// ClientMessages and ServerMessages count the messages sent in each direction
+	ClientMessages int `json:"client_messages"`
+	ServerMessages int `json:"server_messages"`
+
+	// CloseCode and CloseReason come from the first close frame; ClosedBy is "client" or "server",
+	// or empty when the connection dropped without a close handshake
+	CloseCode   int    `json:"close_code,omitempty"`
+	CloseReason string `json:"close_reason,omitempty"`
+	ClosedBy    string `json:"closed_by,omitempty"`
+
+	// Events lists every message in the order it was relayed
+	Events []WebSocketEvent `json:"events"`
+
+	// Truncated is true when payloads were dropped after the session reached the audit size limit
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Audio references the audio tracks extracted from the events, one per direction
+	// Event payloads reference byte ranges of a track as [AUDIO_EXTRACTED:{direction}:{start}-{end}]
+	Audio []MediaReference `json:"audio,omitempty"`
+}
+
+// WebSocketEvent is a single message relayed over a WebSocket session
+type WebSocketEvent struct {
+	// Direction is "client" (client to upstream) or "server" (upstream to client)
+	Direction string `json:"direction"`
+
+	// OffsetMs is the time since the session was opened, in milliseconds
+	OffsetMs int64 `json:"offset_ms"`
+
+	// Opcode is "text", "binary", "close", "ping" or "pong"
+	Opcode string `json:"opcode"`
+
+	// Type is the "type" field of JSON text messages (realtime API event type)
+	Type string `json:"type,omitempty"`
+
+	// Size is the payload size on the wire, in bytes
+	Size int64 `json:"size"`
+
+	// Payload is the text payload with audio extracted, or the Base64 binary payload
+	Payload string `json:"payload,omitempty"`
+
+	// Truncated is true when the payload was cut off or dropped for the audit log
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// WebSocket message directions
+const (
+	WebSocketClient = "client"
+	WebSocketServer = "server"
+)
+
+// Principal identifies an authenticated client
+type Principal struct {
+	// ID is the client name, the JWT principal claim or the certificate common name
+	ID string `json:"id"`
+
+	// Method is how the client authenticated: "api_key", "jwt" or "mtls"
+	Method string `json:"method"`
+
+	// Issuer is the JWT issuer or the common name of the client certificate's issuer
+	Issuer string `json:"issuer,omitempty"`
+}
+
+// UpstreamDetails records the upstream routing of a request
+type UpstreamDetails struct {
+	// Target is the URL of the upstream whose response was returned to the client
+	Target string `json:"target"`
+
+	// URL is the full URL of the request sent to that upstream (target, path and query)
+	// Credentials in the query string are masked by the sanitization rules
+	URL string `json:"url,omitempty"`
+
+	// Attempts lists every upstream request in order, including failed-over ones
+	Attempts []UpstreamAttempt `json:"attempts"`
+}
+
+// UpstreamAttempt is a single request to an upstream target
+type UpstreamAttempt struct {
+	// Target is the URL of the upstream tried
+	Target string `json:"target"`
+
+	// StartTime is when the attempt was sent
+	StartTime time.Time `json:"start_time"`
+
+	// DurationMs is the time until the response headers arrived or the attempt failed, in milliseconds
+	DurationMs int64 `json:"duration_ms"`
+
+	// StatusCode is the upstream response status (0 if no response was received)
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Error describes a connection-level failure
+	Error string `json:"error,omitempty"`
+
+	// BackoffMs is the delay in milliseconds waited before this attempt was sent (retries only)
+	BackoffMs int64 `json:"backoff_ms,omitempty"`
+
+	// Outcome is what the proxy did with the attempt's result
+	Outcome AttemptOutcome `json:"outcome,omitempty"`
+
+	// SpanID links the attempt to its child span in the trace context
+	SpanID string `json:"span_id,omitempty"`
+}
+
+// TokenUsage captures the token accounting of a single call
+// Counts are normalized across OpenAI Chat Completions, OpenAI Responses and Anthropic formats
+type TokenUsage struct {
+	// Model is the model that served the request (from the response, else the request)
+	Model string `json:"model,omitempty"`
+
+	// PromptTokens is the total number of input tokens, including cached tokens
+	PromptTokens int64 `json:"prompt_tokens"`
+
+	// CompletionTokens is the number of output tokens, including reasoning tokens
+	CompletionTokens int64 `json:"completion_tokens"`
+
+	// TotalTokens is PromptTokens + CompletionTokens
+	TotalTokens int64 `json:"total_tokens"`
+
+	// CachedTokens is the portion of PromptTokens served from the provider's prompt cache
+	CachedTokens int64 `json:"cached_tokens,omitempty"`
+
+	// ReasoningTokens is the portion of CompletionTokens spent on hidden reasoning
+	ReasoningTokens int64 `json:"reasoning_tokens,omitempty"`
+
+	// CostUSD is the cost computed from the configured price table
+	// Nil when no price is configured for the model
+	CostUSD *float64 `json:"cost_usd,omitempty"`
+
+	// PricedAs is the price table entry used to compute CostUSD
+	PricedAs string `json:"priced_as,omitempty"`
 }
 
 // RequestDetails captures all relevant information about the incoming request
@@ -169,6 +521,10 @@ type RequestDetails struct {
 	// Path is the URL path after stripping the endpoint name
 	Path string `json:"path"`
 
+	// URL is the full URL requested by the client (scheme, host, path and query)
+	// Credentials in the query string are masked by the sanitization rules
+	URL string `json:"url,omitempty"`
+
 	// Headers contains all HTTP headers (sensitive headers like Authorization are masked for security)
 	Headers map[string][]string `json:"headers"`
 
@@ -179,6 +535,14 @@ type RequestDetails struct {
 	// ContentLength is the size of the request body in bytes
 	ContentLength int64 `json:"content_length"`
 
+	// Truncated indicates if the request body was truncated due to requests.max_audit_body_size
+	// The full body is still forwarded to the upstream
+	Truncated bool `json:"truncated,omitempty"`
+
+	// TruncatedAtBytes indicates the original size before truncation
+	// Only set when Truncated is true
+	TruncatedAtBytes int64 `json:"truncated_at_bytes,omitempty"`
+
 	// MediaReferences contains information about extracted media files
 	// Populated when large Base64 images are detected and offloaded to separate storage
 	MediaReferences []MediaReference `json:"media_references,omitempty"`
@@ -228,6 +592,35 @@ type ResponseDetails struct {
 	// StreamingMetadata contains additional metadata for streaming responses
 	// Only populated when IsStreaming is true
 	StreamingMetadata *StreamingMetadata `json:"streaming_metadata,omitempty"`
+
+	// RawStream preserves the exact SSE transcript the body was reconstructed from
+	// Only populated when streaming.preserve_raw_stream is enabled, redaction is disabled
+	// and reconstruction succeeded
+	RawStream *RawStreamReference `json:"raw_stream,omitempty"`
+}
+
+// RawStreamReference stores or points to the gzip-compressed raw SSE transcript of a response
+type RawStreamReference struct {
+	// Encoding describes how Data or the sidecar file is encoded
+	// "gzip+base64" for inline storage, "gzip" for sidecar files
+	Encoding string `json:"encoding"`
+
+	// Data is the compressed transcript, Base64-encoded (inline storage only)
+	Data string `json:"data,omitempty"`
+
+	// FilePath is the path of the sidecar file relative to the media storage directory (sidecar storage only)
+	// Example: "2026-01-24/seq_0_raw_stream.sse.gz"
+	FilePath string `json:"file_path,omitempty"`
+
+	// SHA256 is the SHA-256 hash of the uncompressed transcript
+	// Covered by the audit hash chain
+	SHA256 string `json:"sha256"`
+
+	// SizeBytes is the size of the uncompressed transcript
+	SizeBytes int64 `json:"size_bytes"`
+
+	// CompressedBytes is the size of the compressed transcript
+	CompressedBytes int64 `json:"compressed_bytes"`
 }
 
 // StreamingMetadata contains metadata about streaming (SSE) responses
@@ -244,4 +637,35 @@ type StreamingMetadata struct {
 
 	// LastChunkTime is when the last data chunk arrived (relative to request start)
 	LastChunkTime time.Duration `json:"last_chunk_ms,omitempty"`
+
+	// TimeToFirstTokenMs is when the first chunk carrying generated output arrived, in milliseconds
+	// since the request started; role-only preamble chunks are not counted
+	TimeToFirstTokenMs int64 `json:"time_to_first_token_ms,omitempty"`
+
+	// InterTokenLatency summarizes the gaps between consecutive output-bearing chunks
+	InterTokenLatency *LatencyPercentiles `json:"inter_token_latency,omitempty"`
+
+	// TokensPerSecond is the generation rate between the first and last output-bearing chunk
+	// Uses usage.completion_tokens when the provider reports it, otherwise the chunk count
+	TokensPerSecond float64 `json:"tokens_per_second,omitempty"`
+
+	// Stalls lists gaps between output-bearing chunks that exceeded streaming.stall_threshold_ms
+	Stalls []StreamStall `json:"stalls,omitempty"`
+}
+
+// LatencyPercentiles summarizes a latency distribution, in milliseconds
+type LatencyPercentiles struct {
+	P50Ms int64 `json:"p50_ms"`
+	P90Ms int64 `json:"p90_ms"`
+	P99Ms int64 `json:"p99_ms"`
+	MaxMs int64 `json:"max_ms"`
+}
+
+// StreamStall is a period during which the stream produced no output
+type StreamStall struct {
+	// StartMs is when the stall began, in milliseconds since the request started
+	StartMs int64 `json:"start_ms"`
+
+	// DurationMs is how long the stream produced no output, in milliseconds
+	DurationMs int64 `json:"duration_ms"`
 }
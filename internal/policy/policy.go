@@ -0,0 +1,355 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+	"github.com/jnd-labs/aiblackbox/internal/redact"
+)
+
+// maxTokensFields are the body fields limiting the output tokens of a request
+// (Chat Completions and Anthropic Messages, newer OpenAI models, Responses API)
+var maxTokensFields = []string{"max_tokens", "max_completion_tokens", "max_output_tokens"}
+
+// Request is what the policies are evaluated against
+type Request struct {
+	Endpoint string
+	Client   string // Authenticated client name; empty when authentication is disabled
+	Path     string // Path below the endpoint, e.g. "/v1/chat/completions"
+	Header   http.Header
+
+	// Body is the complete request body, or nil when it was too large to inspect
+	Body []byte
+}
+
+// Engine evaluates the policy rules
+// A nil Engine (no rules configured) allows every request without recording a decision
+type Engine struct {
+	rules []rule
+}
+
+// rule is a compiled config.PolicyRule
+type rule struct {
+	config.PolicyRule
+	bodyPattern *regexp.Regexp
+	detectors   *redact.Redactor
+}
+
+// New compiles the policy rules, or returns nil if there are none
+func New(cfg config.PolicyConfig) (*Engine, error) {
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+
+	e := &Engine{}
+	for _, r := range cfg.Rules {
+		compiled := rule{PolicyRule: r}
+		if r.Match.BodyPattern != "" {
+			re, err := regexp.Compile(r.Match.BodyPattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid body_pattern for policy %s: %w", r.Name, err)
+			}
+			compiled.bodyPattern = re
+		}
+		if len(r.Match.Detectors) > 0 {
+			detectors, err := redact.New(config.RedactionConfig{Enabled: true, Detectors: r.Match.Detectors}, "")
+			if err != nil {
+				return nil, fmt.Errorf("invalid detectors for policy %s: %w", r.Name, err)
+			}
+			compiled.detectors = detectors
+		}
+		e.rules = append(e.rules, compiled)
+	}
+	return e, nil
+}
+
+// Message returns what clients denied by the named rule are told
+func (e *Engine) Message(ruleName string) string {
+	if e != nil {
+		for _, r := range e.rules {
+			if r.Name == ruleName && r.Message != "" {
+				return r.Message
+			}
+		}
+	}
+	return fmt.Sprintf("Request denied by policy %q", ruleName)
+}
+
+// NeedsBody reports whether any rule applying to the endpoint and client looks at the request body
+// Such rules cannot match requests whose body was too large to inspect
+func (e *Engine) NeedsBody(endpoint, client string) bool {
+	if e == nil {
+		return false
+	}
+	for _, r := range e.rules {
+		if len(r.Endpoints) > 0 && !slices.Contains(r.Endpoints, endpoint) {
+			continue
+		}
+		if len(r.Clients) > 0 && !slices.Contains(r.Clients, client) {
+			continue
+		}
+		m := r.Match
+		if len(m.Models) > 0 || m.MaxTokensAbove > 0 || r.bodyPattern != nil || r.detectors != nil || r.Action == config.PolicyMutate {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate applies the rules to req
+// Returns the decision (nil for a nil Engine) and the rewritten body when a mutate rule changed it
+func (e *Engine) Evaluate(req *Request) (*models.PolicyDecision, []byte) {
+	if e == nil {
+		return nil, nil
+	}
+
+	body := parseBody(req.Body)
+	decision := &models.PolicyDecision{Action: models.PolicyAllow}
+	var flagged, mutated *rule
+
+	for i := range e.rules {
+		r := &e.rules[i]
+		reasons, ok := r.matches(req, body)
+		if !ok {
+			continue
+		}
+		// Mutations only apply to JSON object bodies
+		rewritable := r.Action != config.PolicyMutate || body != nil
+		if !rewritable {
+			reasons = append(reasons, "body not rewritable")
+		}
+		decision.Matches = append(decision.Matches, models.PolicyMatch{Rule: r.Name, Action: r.Action, Reasons: reasons})
+
+		switch r.Action {
+		case config.PolicyDeny:
+			decision.Action, decision.Rule = models.PolicyDeny, r.Name
+			return decision, nil
+		case config.PolicyAllow:
+			decision.Rule = r.Name
+			return finish(decision, flagged, mutated, body)
+		case config.PolicyFlag:
+			if flagged == nil {
+				flagged = r
+			}
+		case config.PolicyMutate:
+			if !rewritable {
+				continue
+			}
+			if changes := r.mutate(body); len(changes) > 0 {
+				decision.Mutations = append(decision.Mutations, changes...)
+				if mutated == nil {
+					mutated = r
+				}
+			}
+		}
+	}
+	return finish(decision, flagged, mutated, body)
+}
+
+// finish settles the outcome of a request no rule denied and re-encodes a mutated body
+func finish(decision *models.PolicyDecision, flagged, mutated *rule, body map[string]json.RawMessage) (*models.PolicyDecision, []byte) {
+	switch {
+	case mutated != nil:
+		decision.Action, decision.Rule = models.PolicyMutate, mutated.Name
+	case flagged != nil:
+		decision.Action, decision.Rule = models.PolicyFlag, flagged.Name
+	}
+	if mutated == nil {
+		return decision, nil
+	}
+
+	rewritten, err := json.Marshal(body)
+	if err != nil {
+		// Cannot happen for values decoded from JSON; forward the original body
+		decision.Mutations = nil
+		return decision, nil
+	}
+	return decision, rewritten
+}
+
+// matches reports whether the rule applies to req and all of its conditions hold,
+// with a description of each matching condition
+func (r *rule) matches(req *Request, body map[string]json.RawMessage) ([]string, bool) {
+	if len(r.Endpoints) > 0 && !slices.Contains(r.Endpoints, req.Endpoint) {
+		return nil, false
+	}
+	if len(r.Clients) > 0 && !slices.Contains(r.Clients, req.Client) {
+		return nil, false
+	}
+
+	m := r.Match
+	var reasons []string
+
+	if len(m.Paths) > 0 {
+		if !matchAny(m.Paths, req.Path) {
+			return nil, false
+		}
+		reasons = append(reasons, "path "+req.Path)
+	}
+
+	if len(m.MissingHeaders) > 0 {
+		var missing []string
+		for _, name := range m.MissingHeaders {
+			if req.Header.Get(name) == "" {
+				missing = append(missing, "missing header "+name)
+			}
+		}
+		if len(missing) == 0 {
+			return nil, false
+		}
+		reasons = append(reasons, missing...)
+	}
+
+	if len(m.Models) > 0 {
+		model := stringField(body, "model")
+		if model == "" || !matchAny(m.Models, model) {
+			return nil, false
+		}
+		reasons = append(reasons, "model "+model)
+	}
+
+	if m.MaxTokensAbove > 0 {
+		requested, field := maxTokens(body)
+		if requested <= m.MaxTokensAbove {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("%s %d > %d", field, requested, m.MaxTokensAbove))
+	}
+
+	if r.bodyPattern != nil {
+		if req.Body == nil || !r.bodyPattern.Match(req.Body) {
+			return nil, false
+		}
+		reasons = append(reasons, "body_pattern")
+	}
+
+	if r.detectors != nil {
+		if req.Body == nil {
+			return nil, false
+		}
+		found := r.detectors.Detect(string(req.Body))
+		if len(found) == 0 {
+			return nil, false
+		}
+		for _, name := range found {
+			reasons = append(reasons, "detector "+name)
+		}
+	}
+
+	return reasons, true
+}
+
+// mutate rewrites body as configured, returning a description of each change
+func (r *rule) mutate(body map[string]json.RawMessage) []string {
+	var changes []string
+
+	// Only limits present in the body are capped; field names differ between APIs
+	if limit := r.Mutate.MaxTokens; limit > 0 {
+		for _, field := range maxTokensFields {
+			if n, ok := intField(body, field); ok && n > limit {
+				body[field] = json.RawMessage(strconv.Itoa(limit))
+				changes = append(changes, fmt.Sprintf("%s: %d -> %d", field, n, limit))
+			}
+		}
+	}
+
+	// Sorted so the recorded mutations are deterministic
+	fields := make([]string, 0, len(r.Mutate.SetFields))
+	for field := range r.Mutate.SetFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		value, err := json.Marshal(r.Mutate.SetFields[field])
+		if err != nil {
+			continue
+		}
+		if previous, ok := body[field]; ok && bytes.Equal(previous, value) {
+			continue
+		}
+		// The previous value is not recorded: it could carry what redaction removes from the body
+		body[field] = value
+		changes = append(changes, fmt.Sprintf("%s: set to %s", field, value))
+	}
+
+	return changes
+}
+
+// parseBody decodes the top-level fields of a JSON object body, or returns nil
+func parseBody(body []byte) map[string]json.RawMessage {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// stringField returns a string field of the body, or "" if absent
+func stringField(body map[string]json.RawMessage, name string) string {
+	var value string
+	if raw, ok := body[name]; ok {
+		json.Unmarshal(raw, &value)
+	}
+	return value
+}
+
+// intField returns an integer field of the body
+func intField(body map[string]json.RawMessage, name string) (int, bool) {
+	raw, ok := body[name]
+	if !ok {
+		return 0, false
+	}
+	var value int
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// maxTokens returns the largest output token limit requested and the field it was set in
+func maxTokens(body map[string]json.RawMessage) (int, string) {
+	requested, field := 0, ""
+	for _, name := range maxTokensFields {
+		if n, ok := intField(body, name); ok && n > requested {
+			requested, field = n, name
+		}
+	}
+	return requested, field
+}
+
+// matchAny reports whether value matches any of the glob patterns
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the policy decision of a request
+func NewContext(ctx context.Context, decision *models.PolicyDecision) context.Context {
+	return context.WithValue(ctx, contextKey{}, decision)
+}
+
+// FromContext returns the policy decision of a request, or nil
+func FromContext(ctx context.Context) *models.PolicyDecision {
+	decision, _ := ctx.Value(contextKey{}).(*models.PolicyDecision)
+	return decision
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/audit"
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+// TestHandlerClientAuthentication verifies unauthenticated and disallowed requests are refused and audited
+func TestHandlerClientAuthentication(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message": "success"}`))
+	}))
+	defer backend.Close()
+
+	keyHash := sha256.Sum256([]byte("internal-key-1"))
+	cfg := createTestConfig(backend.URL)
+	cfg.Endpoints = append(cfg.Endpoints, config.EndpointConfig{Name: "restricted", Target: backend.URL})
+	cfg.Auth = config.AuthConfig{
+		Enabled: true,
+		Clients: []config.AuthClient{
+			{Name: "billing-agent", APIKeySHA256: hex.EncodeToString(keyHash[:]), Endpoints: []string{"test"}},
+		},
+	}
+
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	send := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{}`))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("/test/v1/chat/completions", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401, got %d", w.Code)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, "Bearer") {
+		t.Errorf("Expected WWW-Authenticate challenge, got %q", got)
+	}
+
+	if w := send("/test/v1/chat/completions", "wrong-key"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for wrong key, got %d", w.Code)
+	}
+
+	w = send("/restricted/v1/chat/completions", "internal-key-1")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"permission_error"`) {
+		t.Errorf("Unexpected error body: %s", w.Body.String())
+	}
+
+	if w := send("/test/v1/chat/completions", "internal-key-1"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if len(storage.Entries()) != 4 {
+		t.Fatalf("Expected 4 audit entries, got %d", len(storage.Entries()))
+	}
+	if e := storage.Entries()[0]; e.Response.Error != "AUTHENTICATION_ERROR" || e.Principal != nil {
+		t.Errorf("Expected anonymous authentication error, got error %q principal %+v", e.Response.Error, e.Principal)
+	}
+	if e := storage.Entries()[2]; e.Response.Error != "PERMISSION_ERROR" || e.Principal == nil || e.Principal.ID != "billing-agent" {
+		t.Errorf("Expected permission error attributed to the client, got error %q principal %+v", e.Response.Error, e.Principal)
+	}
+	if e := storage.Entries()[3]; e.Principal == nil || e.Principal.ID != "billing-agent" || e.Principal.Method != "api_key" {
+		t.Errorf("Expected principal on proxied request, got %+v", e.Principal)
+	}
+}
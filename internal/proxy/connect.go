@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/auth"
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+// tunnelHandshakeTimeout bounds the TLS handshake inside an intercepted tunnel
+const tunnelHandshakeTimeout = 10 * time.Second
+
+// forwardHosts maps intercepted hosts (lower-case, with a port unless it is 443) to endpoint names
+type forwardHosts map[string]string
+
+func newForwardHosts(hosts []config.ForwardProxyHost) forwardHosts {
+	m := make(forwardHosts, len(hosts))
+	for _, fh := range hosts {
+		m[strings.ToLower(strings.TrimSuffix(fh.Host, ":443"))] = fh.Endpoint
+	}
+	return m
+}
+
+// lookup returns the endpoint for a CONNECT authority ("host:port")
+func (f forwardHosts) lookup(authority string) (string, bool) {
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil {
+		host, port = authority, "443"
+	}
+	key := strings.ToLower(host)
+	if port != "443" {
+		key = net.JoinHostPort(key, port)
+	}
+	endpoint, ok := f[key]
+	return endpoint, ok
+}
+
+// tunnelIdentityKey carries the client authenticated on the CONNECT request to the requests in the tunnel
+type tunnelIdentityKey struct{}
+
+// tunnelIdentity returns the client authenticated for the tunnel a request arrived through, or nil
+func tunnelIdentity(ctx context.Context) *auth.Identity {
+	id, _ := ctx.Value(tunnelIdentityKey{}).(*auth.Identity)
+	return id
+}
+
+// serveConnect intercepts a CONNECT tunnel to an allow-listed host
+// TLS inside the tunnel is terminated with a certificate issued by the local CA, and every
+// request in it is served by ServeHTTP as a request to the host's endpoint
+func (h *Handler) serveConnect(w http.ResponseWriter, r *http.Request) {
+	if !h.config.ForwardProxy.Enabled {
+		http.Error(w, "CONNECT is not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	endpointName, ok := h.forwardHosts.lookup(r.Host)
+	if !ok {
+		log.Printf("WARNING: Refused CONNECT to host not in forward_proxy.hosts: %s", r.Host)
+		http.Error(w, "Forbidden: host is not allowed", http.StatusForbidden)
+		return
+	}
+
+	if h.forwardErr != nil {
+		log.Printf("ERROR: Refusing CONNECT to %s: interception CA unavailable", r.Host)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var identity *auth.Identity
+	if h.authenticator.Enabled() {
+		var err error
+		identity, err = h.authenticator.AuthenticateProxy(r)
+		if err != nil {
+			log.Printf("WARNING: Refused CONNECT to %s: authentication failed: %v", r.Host, err)
+			w.Header().Set("Proxy-Authenticate", `Basic realm="aiblackbox"`)
+			http.Error(w, "Proxy authentication required", http.StatusProxyAuthRequired)
+			return
+		}
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "CONNECT is not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		log.Printf("ERROR: Failed to hijack CONNECT connection: %v", err)
+		return
+	}
+
+	// Drop the outer server's deadlines; the tunnel's own server sets them per request
+	conn.SetDeadline(time.Time{})
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		return
+	}
+
+	// The certificate is always issued for the CONNECT host; requests can only reach its endpoint
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return h.forwardCA.Certificate(host)
+		},
+		NextProtos: []string{"http/1.1"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), tunnelHandshakeTimeout)
+	err = tlsConn.HandshakeContext(ctx)
+	cancel()
+	if err != nil {
+		log.Printf("WARNING: TLS handshake failed in CONNECT tunnel to %s (does the client trust the AIBlackBox CA?): %v", r.Host, err)
+		tlsConn.Close()
+		return
+	}
+
+	listener := newTunnelListener(tlsConn)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req.URL.Path = "/" + endpointName + req.URL.Path
+			if req.URL.RawPath != "" {
+				req.URL.RawPath = "/" + endpointName + req.URL.RawPath
+			}
+			if identity != nil {
+				req = req.WithContext(context.WithValue(req.Context(), tunnelIdentityKey{}, identity))
+			}
+			h.ServeHTTP(w, req)
+		}),
+		ReadTimeout:  time.Duration(h.config.Server.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(h.config.Server.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(h.config.Server.IdleTimeout) * time.Second,
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				listener.Close()
+			}
+		},
+	}
+	server.Serve(listener)
+}
+
+// tunnelListener hands a single intercepted connection to an http.Server
+// Accept blocks after the first call until the connection is closed, which ends Serve
+type tunnelListener struct {
+	conn     net.Conn
+	accepted bool
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newTunnelListener(conn net.Conn) *tunnelListener {
+	return &tunnelListener{conn: conn, done: make(chan struct{})}
+}
+
+func (l *tunnelListener) Accept() (net.Conn, error) {
+	if !l.accepted {
+		l.accepted = true
+		return l.conn, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *tunnelListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *tunnelListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
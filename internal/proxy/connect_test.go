@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/audit"
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/tlsutil"
+)
+
+// forwardProxyClient returns a client that tunnels through proxyURL and trusts the interception CA
+func forwardProxyClient(t *testing.T, proxyURL *url.URL, caFile string) *http.Client {
+	t.Helper()
+	roots, err := tlsutil.LoadCertPool(caFile)
+	if err != nil {
+		t.Fatalf("Failed to load interception CA: %v", err)
+	}
+	return &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+}
+
+// newForwardProxyConfig maps api.openai.test to an endpoint targeting a TLS backend
+func newForwardProxyConfig(t *testing.T, backend *httptest.Server) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+
+	backendCA := filepath.Join(dir, "backend.pem")
+	os.WriteFile(backendCA, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw}), 0600)
+
+	cfg := createTestConfig(backend.URL)
+	cfg.Endpoints[0].TLS = config.UpstreamTLSConfig{CAFile: backendCA}
+	cfg.ForwardProxy = config.ForwardProxyConfig{
+		Enabled:    true,
+		CACertFile: filepath.Join(dir, "ca", "aiblackbox-ca.crt"),
+		CAKeyFile:  filepath.Join(dir, "ca", "aiblackbox-ca.key"),
+		Hosts:      []config.ForwardProxyHost{{Host: "api.openai.test", Endpoint: "test"}},
+	}
+	return cfg
+}
+
+// TestHandlerForwardProxy verifies CONNECT tunnels to allow-listed hosts are intercepted and audited
+func TestHandlerForwardProxy(t *testing.T) {
+	var receivedPath, receivedAuth string
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedPath = r.URL.Path
+		receivedAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message": "success"}`))
+	}))
+	defer backend.Close()
+
+	cfg := newForwardProxyConfig(t, backend)
+
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	front := httptest.NewServer(handler)
+	defer front.Close()
+	proxyURL, _ := url.Parse(front.URL)
+	client := forwardProxyClient(t, proxyURL, cfg.ForwardProxy.CACertFile)
+
+	req, _ := http.NewRequest("POST", "https://api.openai.test/v1/chat/completions?key=AIzaSyExample12345", strings.NewReader(`{"model":"gpt-4o"}`))
+	req.Header.Set("Authorization", "Bearer sk-provider-key")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request through forward proxy failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if receivedPath != "/v1/chat/completions" {
+		t.Errorf("Expected original path upstream, got %q", receivedPath)
+	}
+	if receivedAuth != "Bearer sk-provider-key" {
+		t.Errorf("Expected client credentials to be forwarded, got %q", receivedAuth)
+	}
+
+	// Hosts outside the allowlist are refused before any TLS is intercepted
+	if _, err := client.Get("https://example.test/"); err == nil {
+		t.Error("Expected CONNECT to unlisted host to fail")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
+	}
+	entry := storage.Entries()[0]
+	if entry.Endpoint != "test" || entry.Request.Path != "/v1/chat/completions" {
+		t.Errorf("Unexpected audit entry: endpoint=%s path=%s", entry.Endpoint, entry.Request.Path)
+	}
+	if entry.Request.Body != `{"model":"gpt-4o"}` {
+		t.Errorf("Expected intercepted body in audit entry, got %q", entry.Request.Body)
+	}
+	if entry.Request.URL != "https://api.openai.test/v1/chat/completions?key=AIz...2345" {
+		t.Errorf("Expected the URL requested by the client, got %q", entry.Request.URL)
+	}
+}
+
+// TestHandlerForwardProxyAuthentication verifies tunnels authenticate with Proxy-Authorization
+func TestHandlerForwardProxyAuthentication(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	keyHash := sha256.Sum256([]byte("internal-key-1"))
+	cfg := newForwardProxyConfig(t, backend)
+	cfg.Auth = config.AuthConfig{
+		Enabled: true,
+		Clients: []config.AuthClient{{Name: "legacy-tool", APIKeySHA256: hex.EncodeToString(keyHash[:])}},
+	}
+
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	front := httptest.NewServer(handler)
+	defer front.Close()
+
+	anonymous, _ := url.Parse(front.URL)
+	if _, err := forwardProxyClient(t, anonymous, cfg.ForwardProxy.CACertFile).Get("https://api.openai.test/v1/models"); err == nil {
+		t.Error("Expected unauthenticated CONNECT to fail")
+	}
+
+	authenticated, _ := url.Parse(front.URL)
+	authenticated.User = url.UserPassword("legacy-tool", "internal-key-1")
+	client := forwardProxyClient(t, authenticated, cfg.ForwardProxy.CACertFile)
+
+	// The provider key inside the tunnel is not checked against the client keys
+	req, _ := http.NewRequest("GET", "https://api.openai.test/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer sk-provider-key")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request through forward proxy failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
+	}
+	if p := storage.Entries()[0].Principal; p == nil || p.ID != "legacy-tool" {
+		t.Errorf("Expected tunnel principal on audit entry, got %+v", p)
+	}
+}
+
+// TestForwardHostsLookup verifies host and port matching of CONNECT authorities
+func TestForwardHostsLookup(t *testing.T) {
+	hosts := newForwardHosts([]config.ForwardProxyHost{
+		{Host: "API.OpenAI.com", Endpoint: "openai"},
+		{Host: "models.internal:8443", Endpoint: "internal"},
+	})
+
+	tests := []struct {
+		authority string
+		endpoint  string
+	}{
+		{"api.openai.com:443", "openai"},
+		{"api.openai.com", "openai"},
+		{"api.openai.com:8443", ""},
+		{"models.internal:8443", "internal"},
+		{"models.internal:443", ""},
+		{"evil.com:443", ""},
+	}
+	for _, tt := range tests {
+		endpoint, _ := hosts.lookup(tt.authority)
+		if endpoint != tt.endpoint {
+			t.Errorf("lookup(%q) = %q, want %q", tt.authority, endpoint, tt.endpoint)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/secrets"
+)
+
+// clientCredentialHeaders are removed from upstream requests of endpoints that strip client credentials
+var clientCredentialHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Api-Key",
+	"X-Api-Key",
+	"X-Goog-Api-Key",
+	"Cookie",
+}
+
+// upstreamCredentials holds the resolved upstream headers of an endpoint
+// The values are provider secrets: they are only ever set on outgoing requests, never on
+// the client request the audit entry is built from
+type upstreamCredentials struct {
+	headers http.Header
+	strip   bool
+
+	// err is set if a referenced secret could not be resolved; requests to the endpoint are refused
+	err error
+}
+
+// resolveCredentials expands the header rules of an endpoint
+// Returns nil if the endpoint neither injects nor strips headers
+func resolveCredentials(endpoint config.EndpointConfig, store *secrets.Store) *upstreamCredentials {
+	if len(endpoint.Headers) == 0 && !endpoint.StripClientCredentials {
+		return nil
+	}
+
+	creds := &upstreamCredentials{
+		headers: make(http.Header),
+		strip:   endpoint.StripClientCredentials,
+	}
+	for _, hdr := range endpoint.Headers {
+		value, err := store.Expand(hdr.Value)
+		if err != nil {
+			// The error names the reference, never a resolved value
+			creds.err = fmt.Errorf("header %s: %w", hdr.Name, err)
+			return creds
+		}
+		creds.headers.Set(hdr.Name, value)
+	}
+	return creds
+}
+
+// apply strips client credentials if configured and sets the injected headers
+// Credentials are stripped from the headers and from the query string (the sensitiveQueryParams,
+// e.g. Gemini's ?key=); must be called before the target's own query is merged in
+func (c *upstreamCredentials) apply(req *http.Request) {
+	if c == nil {
+		return
+	}
+	if c.strip {
+		for _, name := range clientCredentialHeaders {
+			req.Header.Del(name)
+		}
+		stripCredentialParams(req)
+	}
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+}
+
+// stripCredentialParams removes credential query parameters from the request URL
+// The query is only re-encoded when a parameter was removed
+func stripCredentialParams(req *http.Request) {
+	if req.URL.RawQuery == "" {
+		return
+	}
+	query := req.URL.Query()
+	stripped := false
+	for name := range query {
+		if sensitiveQueryParams[strings.ToLower(name)] {
+			query.Del(name)
+			stripped = true
+		}
+	}
+	if stripped {
+		req.URL.RawQuery = query.Encode()
+	}
+}
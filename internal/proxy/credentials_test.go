@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/audit"
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+// TestHandlerInjectsCredentials verifies provider credentials replace client credentials upstream
+func TestHandlerInjectsCredentials(t *testing.T) {
+	t.Setenv("ABB_TEST_PROVIDER_KEY", "sk-provider-secret")
+
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	cfg := createTestConfig(upstream.URL)
+	cfg.Endpoints[0].Headers = []config.HeaderInjection{
+		{Name: "Authorization", Value: "Bearer ${env:ABB_TEST_PROVIDER_KEY}"},
+		{Name: "anthropic-version", Value: "2023-06-01"},
+	}
+	cfg.Endpoints[0].StripClientCredentials = true
+
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	req := httptest.NewRequest("POST", "/test/v1/messages", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer internal-client-key")
+	req.Header.Set("X-Api-Key", "internal-client-key")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if got := received.Get("Authorization"); got != "Bearer sk-provider-secret" {
+		t.Errorf("Expected injected provider key, got %q", got)
+	}
+	if got := received.Get("Anthropic-Version"); got != "2023-06-01" {
+		t.Errorf("Expected injected anthropic-version, got %q", got)
+	}
+	if got := received.Get("X-Api-Key"); got != "" {
+		t.Errorf("Client API key should be stripped, got %q", got)
+	}
+	if got := received.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Other headers should be forwarded, got %q", got)
+	}
+
+	// The provider secret must never reach the audit trail
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
+	}
+	for name, values := range storage.Entries()[0].Request.Headers {
+		for _, v := range values {
+			if strings.Contains(v, "provider") {
+				t.Errorf("Provider secret leaked into audited header %s: %q", name, v)
+			}
+		}
+	}
+}
+
+// TestHandlerInjectsWithoutStripping verifies injected headers override but other client headers stay
+func TestHandlerInjectsWithoutStripping(t *testing.T) {
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	cfg := createTestConfig(upstream.URL)
+	cfg.Endpoints[0].Headers = []config.HeaderInjection{{Name: "OpenAI-Organization", Value: "org-proxy"}}
+
+	worker := audit.NewWorker(&mockAuditStorage{}, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer client-key")
+	req.Header.Set("OpenAI-Organization", "org-client")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := received.Get("OpenAI-Organization"); got != "org-proxy" {
+		t.Errorf("Injected header should override the client's, got %q", got)
+	}
+	if got := received.Get("Authorization"); got != "Bearer client-key" {
+		t.Errorf("Client credentials should pass through without stripping, got %q", got)
+	}
+}
+
+// TestHandlerStripsQueryCredentials verifies client credentials in the query string are not forwarded
+func TestHandlerStripsQueryCredentials(t *testing.T) {
+	var received url.Values
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.Query()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	// The provider key is part of the target; only the client's query is stripped
+	cfg := createTestConfig(upstream.URL + "?key=provider-key")
+	cfg.Endpoints[0].StripClientCredentials = true
+
+	worker := audit.NewWorker(&mockAuditStorage{}, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	req := httptest.NewRequest("POST", "/test/v1beta/models/gemini-pro:generateContent?alt=sse&KEY=client-key&api_key=client-key", strings.NewReader(`{}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := received["key"]; len(got) != 1 || got[0] != "provider-key" {
+		t.Errorf("Expected only the provider key upstream, got %v", got)
+	}
+	if received.Has("KEY") || received.Has("api_key") {
+		t.Errorf("Client credentials should be stripped from the query, got %v", received)
+	}
+	if received.Get("alt") != "sse" {
+		t.Errorf("Other query parameters should be forwarded, got %v", received)
+	}
+}
+
+// TestHandlerRefusesUnresolvedCredentials verifies requests are not forwarded without their credentials
+func TestHandlerRefusesUnresolvedCredentials(t *testing.T) {
+	called := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer upstream.Close()
+
+	cfg := createTestConfig(upstream.URL)
+	cfg.Endpoints[0].Headers = []config.HeaderInjection{{Name: "Authorization", Value: "Bearer ${env:ABB_TEST_UNSET_PROVIDER_KEY}"}}
+
+	worker := audit.NewWorker(&mockAuditStorage{}, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+	if called {
+		t.Error("Request should not be forwarded without its credentials")
+	}
+}
@@ -40,11 +40,11 @@ func TestErrorHandling_UpstreamError(t *testing.T) {
 	}
 
 	// Verify audit entry captures error
-	if len(storage.entries) != 1 {
-		t.Fatalf("Expected 1 audit entry, got %d", len(storage.entries))
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
 	}
 
-	entry := storage.entries[0]
+	entry := storage.Entries()[0]
 	if entry.Response.StatusCode != http.StatusInternalServerError {
 		t.Errorf("Audit should capture error status code")
 	}
@@ -81,8 +81,8 @@ func TestErrorHandling_InvalidEndpoint(t *testing.T) {
 	}
 
 	// No audit entry should be created for invalid endpoints
-	if len(storage.entries) != 0 {
-		t.Errorf("Expected 0 audit entries for invalid endpoint, got %d", len(storage.entries))
+	if len(storage.Entries()) != 0 {
+		t.Errorf("Expected 0 audit entries for invalid endpoint, got %d", len(storage.Entries()))
 	}
 }
 
@@ -113,8 +113,8 @@ func TestErrorHandling_MalformedRequest(t *testing.T) {
 	}
 
 	// No audit entry for malformed requests
-	if len(storage.entries) != 0 {
-		t.Errorf("Expected 0 audit entries, got %d", len(storage.entries))
+	if len(storage.Entries()) != 0 {
+		t.Errorf("Expected 0 audit entries, got %d", len(storage.Entries()))
 	}
 }
 
@@ -146,8 +146,8 @@ func TestErrorHandling_StreamingWriteError(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Verify audit entry was created
-	if len(storage.entries) != 1 {
-		t.Fatalf("Expected 1 audit entry, got %d", len(storage.entries))
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
 	}
 }
 
@@ -196,11 +196,11 @@ func TestErrorHandling_ContextCancellation(t *testing.T) {
 	time.Sleep(200 * time.Millisecond)
 
 	// Verify audit entry shows incomplete
-	if len(storage.entries) != 1 {
-		t.Fatalf("Expected 1 audit entry, got %d", len(storage.entries))
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
 	}
 
-	entry := storage.entries[0]
+	entry := storage.Entries()[0]
 	if entry.Response.IsComplete {
 		t.Error("Response should not be marked as complete after cancellation")
 	}
@@ -269,20 +269,20 @@ func TestErrorHandling_MultipleErrors(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Verify all errors were captured
-	if len(storage.entries) != 5 {
-		t.Fatalf("Expected 5 audit entries, got %d", len(storage.entries))
+	if len(storage.Entries()) != 5 {
+		t.Fatalf("Expected 5 audit entries, got %d", len(storage.Entries()))
 	}
 
 	// Verify sequence ordering maintained despite errors
-	for i, entry := range storage.entries {
+	for i, entry := range storage.Entries() {
 		if entry.SequenceID != uint64(i) {
 			t.Errorf("Entry %d has wrong sequence ID: expected %d, got %d", i, i, entry.SequenceID)
 		}
 	}
 
 	// Verify hash chain integrity even with errors
-	for i := 1; i < len(storage.entries); i++ {
-		if storage.entries[i].PrevHash != storage.entries[i-1].Hash {
+	for i := 1; i < len(storage.Entries()); i++ {
+		if storage.Entries()[i].PrevHash != storage.Entries()[i-1].Hash {
 			t.Errorf("Entry %d: Hash chain broken despite errors", i)
 		}
 	}
@@ -310,11 +310,11 @@ func TestErrorHandling_EmptyResponse(t *testing.T) {
 	time.Sleep(50 * time.Millisecond)
 
 	// Verify empty response is handled
-	if len(storage.entries) != 1 {
-		t.Fatalf("Expected 1 audit entry, got %d", len(storage.entries))
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
 	}
 
-	entry := storage.entries[0]
+	entry := storage.Entries()[0]
 	if entry.Response.StatusCode != http.StatusNoContent {
 		t.Errorf("Expected status 204, got %d", entry.Response.StatusCode)
 	}
@@ -369,29 +369,29 @@ func TestErrorHandling_ChainIntegrityWithErrors(t *testing.T) {
 	time.Sleep(200 * time.Millisecond)
 
 	// Verify all entries processed
-	if len(storage.entries) != numRequests {
-		t.Fatalf("Expected %d audit entries, got %d", numRequests, len(storage.entries))
+	if len(storage.Entries()) != numRequests {
+		t.Fatalf("Expected %d audit entries, got %d", numRequests, len(storage.Entries()))
 	}
 
 	// Verify complete hash chain integrity
-	for i := 1; i < len(storage.entries); i++ {
-		if storage.entries[i].PrevHash != storage.entries[i-1].Hash {
+	for i := 1; i < len(storage.Entries()); i++ {
+		if storage.Entries()[i].PrevHash != storage.Entries()[i-1].Hash {
 			t.Errorf("Entry %d: Hash chain broken at sequence=%d, status=%d",
-				i, storage.entries[i].SequenceID, storage.entries[i].Response.StatusCode)
+				i, storage.Entries()[i].SequenceID, storage.Entries()[i].Response.StatusCode)
 		}
 
-		if storage.entries[i].Hash == "" {
+		if storage.Entries()[i].Hash == "" {
 			t.Errorf("Entry %d: Hash is empty", i)
 		}
 
-		if storage.entries[i].PrevHash == "" {
+		if storage.Entries()[i].PrevHash == "" {
 			t.Errorf("Entry %d: PrevHash is empty", i)
 		}
 	}
 
 	// Verify no duplicate hashes
 	hashSet := make(map[string]bool)
-	for i, entry := range storage.entries {
+	for i, entry := range storage.Entries() {
 		if hashSet[entry.Hash] {
 			t.Errorf("Entry %d: Duplicate hash detected", i)
 		}
@@ -429,8 +429,8 @@ func TestErrorHandling_LargeErrorResponse(t *testing.T) {
 
 	// For regular requests, truncation doesn't apply (only for streaming)
 	// But verify entry was created
-	if len(storage.entries) != 1 {
-		t.Fatalf("Expected 1 audit entry, got %d", len(storage.entries))
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
 	}
 }
 
@@ -484,20 +484,20 @@ func TestErrorHandling_ConcurrentErrors(t *testing.T) {
 	time.Sleep(200 * time.Millisecond)
 
 	// Verify all entries processed
-	if len(storage.entries) != numRequests {
-		t.Fatalf("Expected %d audit entries, got %d", numRequests, len(storage.entries))
+	if len(storage.Entries()) != numRequests {
+		t.Fatalf("Expected %d audit entries, got %d", numRequests, len(storage.Entries()))
 	}
 
 	// Verify sequence ordering
-	for i, entry := range storage.entries {
+	for i, entry := range storage.Entries() {
 		if entry.SequenceID != uint64(i) {
 			t.Errorf("Entry at index %d has wrong sequence ID: expected %d, got %d", i, i, entry.SequenceID)
 		}
 	}
 
 	// Verify hash chain integrity with mixed errors
-	for i := 1; i < len(storage.entries); i++ {
-		if storage.entries[i].PrevHash != storage.entries[i-1].Hash {
+	for i := 1; i < len(storage.Entries()); i++ {
+		if storage.Entries()[i].PrevHash != storage.Entries()[i-1].Hash {
 			t.Errorf("Entry %d: Hash chain broken with concurrent errors", i)
 		}
 	}
@@ -538,14 +538,14 @@ func TestErrorHandling_RecoveryFromFailures(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Verify all entries processed
-	if len(storage.entries) != 10 {
-		t.Fatalf("Expected 10 audit entries, got %d", len(storage.entries))
+	if len(storage.Entries()) != 10 {
+		t.Fatalf("Expected 10 audit entries, got %d", len(storage.Entries()))
 	}
 
 	// Verify system recovered (last 5 should be successful)
 	successCount := 0
 	for i := 5; i < 10; i++ {
-		if storage.entries[i].Response.StatusCode == http.StatusOK {
+		if storage.Entries()[i].Response.StatusCode == http.StatusOK {
 			successCount++
 		}
 	}
@@ -555,8 +555,8 @@ func TestErrorHandling_RecoveryFromFailures(t *testing.T) {
 	}
 
 	// Verify hash chain integrity throughout failures and recovery
-	for i := 1; i < len(storage.entries); i++ {
-		if storage.entries[i].PrevHash != storage.entries[i-1].Hash {
+	for i := 1; i < len(storage.Entries()); i++ {
+		if storage.Entries()[i].PrevHash != storage.Entries()[i-1].Hash {
 			t.Errorf("Entry %d: Hash chain broken during failure/recovery", i)
 		}
 	}
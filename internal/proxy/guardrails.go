@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/guardrail"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+)
+
+// blockedResponse is an upstream response withheld from the client by a blocking guardrail
+// The audit entry records it in place of the error the client received
+type blockedResponse struct {
+	statusCode int
+	header     http.Header
+	body       string // As received from the upstream, possibly compressed
+	rule       string
+}
+
+// enforceGuardrails reads a non-streaming response and replaces it with a JSON error
+// if a blocking guardrail fires; returns the withheld response, or nil if it was passed on
+func (h *Handler) enforceGuardrails(resp *http.Response, endpointName string) (*blockedResponse, error) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	findings := h.guardrails.Check(endpointName, decompressBody(string(body), resp.Header))
+	rule := guardrail.Blocking(findings)
+	if rule == "" {
+		return nil, nil
+	}
+
+	blocked := &blockedResponse{
+		statusCode: resp.StatusCode,
+		header:     resp.Header.Clone(),
+		body:       string(body),
+		rule:       rule,
+	}
+
+	errorBody, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message":   h.guardrails.Message(rule),
+			"type":      "guardrail_violation",
+			"code":      "guardrail_violation",
+			"guardrail": rule,
+		},
+	})
+	resp.StatusCode = http.StatusForbidden
+	resp.Status = strconv.Itoa(http.StatusForbidden) + " " + http.StatusText(http.StatusForbidden)
+	resp.Header = http.Header{"Content-Type": []string{"application/json"}}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(errorBody)))
+	resp.ContentLength = int64(len(errorBody))
+	resp.Body = io.NopCloser(bytes.NewReader(errorBody))
+
+	log.Printf("WARNING: Response blocked by guardrail %s: endpoint=%s, status=%d", rule, endpointName, blocked.statusCode)
+	return blocked, nil
+}
+
+// checkGuardrails runs the guardrails over a completed response body and marks the findings
+// in the trace attributes so they can be searched alongside the span
+func (h *Handler) checkGuardrails(endpointName, responseBody string, traceContext *models.TraceContext) []models.Finding {
+	findings := h.guardrails.Check(endpointName, responseBody)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	var rules []string
+	action := config.GuardrailFlag
+	for _, f := range findings {
+		if !slices.Contains(rules, f.Rule) {
+			rules = append(rules, f.Rule)
+		}
+		if f.Action == config.GuardrailBlock {
+			action = config.GuardrailBlock
+		}
+	}
+
+	if traceContext != nil {
+		if traceContext.Attributes == nil {
+			traceContext.Attributes = make(map[string]string)
+		}
+		traceContext.Attributes["guardrail_findings"] = strconv.Itoa(len(findings))
+		traceContext.Attributes["guardrail_rules"] = strings.Join(rules, ",")
+		traceContext.Attributes["guardrail_action"] = action
+	}
+
+	log.Printf("WARNING: Guardrail findings: endpoint=%s, rules=%s, count=%d", endpointName, strings.Join(rules, ","), len(findings))
+	return findings
+}
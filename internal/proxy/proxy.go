@@ -5,51 +5,319 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/jnd-labs/aiblackbox/internal/audit"
+	"github.com/jnd-labs/aiblackbox/internal/auth"
+	"github.com/jnd-labs/aiblackbox/internal/budget"
 	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/guardrail"
+	"github.com/jnd-labs/aiblackbox/internal/injection"
 	"github.com/jnd-labs/aiblackbox/internal/media"
 	"github.com/jnd-labs/aiblackbox/internal/models"
+	"github.com/jnd-labs/aiblackbox/internal/policy"
+	"github.com/jnd-labs/aiblackbox/internal/ratelimit"
+	"github.com/jnd-labs/aiblackbox/internal/redact"
+	"github.com/jnd-labs/aiblackbox/internal/secrets"
+	"github.com/jnd-labs/aiblackbox/internal/tlsutil"
 	"github.com/jnd-labs/aiblackbox/internal/trace"
+	"github.com/jnd-labs/aiblackbox/internal/usage"
 )
 
+// streamDeadlineGrace is added to the stream timeout when extending connection deadlines
+// so the stream timeout fires first and is recorded as STREAM_TIMEOUT rather than a write error
+const streamDeadlineGrace = 5 * time.Second
+
 // Handler implements the reverse proxy with named endpoint routing and audit logging
+// A Handler is one generation of the configuration: Reload builds a new generation and swaps it
+// in atomically, while requests already in flight finish on the generation they started with
 type Handler struct {
 	config         *config.Config
-	auditWorker    *audit.Worker
 	mediaExtractor *media.Extractor
+	priceTable     *usage.PriceTable
+
+	// Resolved upstream headers by endpoint name (read-only after construction)
+	credentials map[string]*upstreamCredentials
+
+	// Client authentication; authErr is set if it could not be initialized and refuses all requests
+	authenticator *auth.Authenticator
+	authErr       error
+
+	// Forward-proxy mode; forwardErr is set if the interception CA could not be loaded and refuses all tunnels
+	forwardHosts forwardHosts
+	forwardCA    *tlsutil.CA
+	forwardErr   error
+
+	// Sanitization of audited headers; sanitizerErr is set if the rules could not be initialized and refuses all requests
+	sanitizer    *sanitizer
+	sanitizerErr error
+
+	// Request policies (nil when none are configured); policiesErr refuses all requests
+	policies    *policy.Engine
+	policiesErr error
+
+	// Response guardrails (nil when none are configured); guardrailsErr refuses all requests
+	guardrails    *guardrail.Engine
+	guardrailsErr error
+
+	// Prompt-injection detection on tool results (nil when disabled); injectionErr refuses all requests
+	injection    *injection.Scanner
+	injectionErr error
+
+	// Body redaction (nil when disabled); redactorErr is set if the vault could not be opened and refuses all requests
+	redactor    *redact.Redactor
+	redactorErr error
+
+	*handlerState
+}
+
+// handlerState is shared by all generations of a Handler and survives configuration reloads
+type handlerState struct {
 	nextSequenceID uint64 // Atomic counter for sequence IDs
+
+	auditWorker *audit.Worker
+	budgets     *budget.Tracker
+	rateLimiter *ratelimit.Limiter
+	transport   *http.Transport // Shared by endpoints without upstream TLS settings
+
+	// Upstream pools by endpoint name, rebuilt when an endpoint's targets change
+	pools   map[string]*upstreamPool
+	poolsMu sync.Mutex
+
+	// live is the generation serving new requests; reloadMu serializes reloads
+	live     atomic.Pointer[Handler]
+	reloadMu sync.Mutex
 }
 
 // NewHandler creates a new proxy handler
 func NewHandler(cfg *config.Config, auditWorker *audit.Worker) *Handler {
-	// Initialize media extractor
-	mediaExtractor := media.NewExtractor(
-		cfg.Media.EnableExtraction,
-		cfg.Media.MinSizeKB,
-		cfg.Media.StoragePath,
-	)
+	// Shared upstream transport (connection pooling across requests)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = time.Duration(cfg.Server.UpstreamResponseHeaderTimeout) * time.Second
+
+	state := &handlerState{
+		auditWorker: auditWorker,
+		budgets:     budget.NewTracker(cfg.Budgets),
+		rateLimiter: ratelimit.NewLimiter(cfg.RateLimits.Rules),
+		transport:   transport,
+		pools:       make(map[string]*upstreamPool),
+	}
+
+	h := newGeneration(cfg, state)
+	state.live.Store(h)
+	return h
+}
 
-	return &Handler{
-		config:         cfg,
-		auditWorker:    auditWorker,
-		mediaExtractor: mediaExtractor,
+// newGeneration builds the configuration-derived state of a Handler
+func newGeneration(cfg *config.Config, state *handlerState) *Handler {
+	h := &Handler{
+		config: cfg,
+		mediaExtractor: media.NewExtractor(
+			cfg.Media.EnableExtraction,
+			cfg.Media.MinSizeKB,
+			cfg.Media.StoragePath,
+		),
+		priceTable:   usage.NewPriceTable(cfg.Pricing),
+		credentials:  make(map[string]*upstreamCredentials),
+		handlerState: state,
+	}
+
+	// Resolve injected upstream headers; failures are logged once and refuse the endpoint's requests
+	store, err := secrets.Load(cfg.Secrets.File)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		store, _ = secrets.Load("")
+	}
+	for _, ep := range cfg.Endpoints {
+		creds := resolveCredentials(ep, store)
+		if creds == nil {
+			continue
+		}
+		if creds.err != nil {
+			log.Printf("ERROR: Failed to resolve credentials for endpoint %s: %v", ep.Name, creds.err)
+		}
+		h.credentials[ep.Name] = creds
 	}
+
+	// Audit sanitization fails closed: credentials must never be recorded unmasked
+	h.sanitizer, h.sanitizerErr = newSanitizer(cfg.Sanitization, store)
+	if h.sanitizerErr != nil {
+		log.Printf("ERROR: Failed to initialize sanitization rules: %v", h.sanitizerErr)
+	}
+
+	// Policies fail closed: requests they should deny must never be forwarded
+	h.policies, h.policiesErr = policy.New(cfg.Policies)
+	if h.policiesErr != nil {
+		log.Printf("ERROR: Failed to initialize request policies: %v", h.policiesErr)
+	}
+
+	h.guardrails, h.guardrailsErr = guardrail.New(cfg.Guardrails)
+	if h.guardrailsErr != nil {
+		log.Printf("ERROR: Failed to initialize response guardrails: %v", h.guardrailsErr)
+	}
+
+	h.injection, h.injectionErr = injection.New(cfg.Injection)
+	if h.injectionErr != nil {
+		log.Printf("ERROR: Failed to initialize prompt-injection detection: %v", h.injectionErr)
+	}
+
+	// Body redaction fails closed as well: bodies must never be stored unredacted by mistake
+	vaultKey := ""
+	if cfg.Redaction.Enabled && cfg.Redaction.Mode == config.RedactionModeTokenize {
+		vaultKey, h.redactorErr = store.Expand(cfg.Redaction.VaultKey)
+	}
+	if h.redactorErr == nil {
+		h.redactor, h.redactorErr = redact.New(cfg.Redaction, vaultKey)
+	}
+	if h.redactorErr != nil {
+		log.Printf("ERROR: Failed to initialize body redaction: %v", h.redactorErr)
+	}
+	if h.redactor != nil && cfg.Streaming.PreserveRawStream {
+		log.Printf("WARNING: streaming.preserve_raw_stream is ignored while redaction is enabled")
+	}
+
+	// Client authentication fails closed: without a usable key set no request is let through
+	h.authenticator, h.authErr = auth.New(cfg.Auth)
+	if h.authErr != nil {
+		log.Printf("ERROR: Failed to initialize client authentication: %v", h.authErr)
+	}
+
+	if cfg.ForwardProxy.Enabled {
+		h.forwardHosts = newForwardHosts(cfg.ForwardProxy.Hosts)
+		h.forwardCA, h.forwardErr = tlsutil.LoadOrCreateCA(cfg.ForwardProxy.CACertFile, cfg.ForwardProxy.CAKeyFile)
+		if h.forwardErr != nil {
+			log.Printf("ERROR: Failed to initialize forward proxy: %v", h.forwardErr)
+		}
+	}
+
+	// Build upstream pools up front so health checks start before the first request
+	for _, ep := range cfg.Endpoints {
+		if _, err := h.upstreamPool(ep); err != nil {
+			log.Printf("ERROR: Invalid upstream for endpoint %s: %v", ep.Name, err)
+		}
+	}
+
+	return h
+}
+
+// Shutdown stops upstream health checks and persists handler state that must survive
+// restarts (budget consumption). Call after the HTTP server has stopped accepting requests
+func (h *Handler) Shutdown() {
+	h.poolsMu.Lock()
+	for name, pool := range h.pools {
+		pool.stop()
+		delete(h.pools, name)
+	}
+	h.poolsMu.Unlock()
+
+	h.budgets.Shutdown()
+}
+
+// Reload applies a new configuration to requests arriving from now on
+// Sequence IDs, budget consumption, rate limit buckets and upstream pools whose targets are
+// unchanged carry over. A chained "config_changed" audit entry records the new configuration's
+// hash and a summary of the changes; reloads without changes are ignored
+func (h *Handler) Reload(cfg *config.Config) {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	current := h.live.Load()
+	changes := cfg.Diff(current.config)
+	if len(changes) == 0 {
+		log.Println("Configuration reloaded: no changes")
+		return
+	}
+
+	h.budgets.SetRules(cfg.Budgets.Rules)
+	h.rateLimiter.SetRules(cfg.RateLimits.Rules)
+	h.live.Store(newGeneration(cfg, h.handlerState))
+
+	// Stop health checks of removed endpoints; requests in flight keep their pool
+	h.poolsMu.Lock()
+	for name, pool := range h.pools {
+		if _, found := cfg.GetEndpoint(name); !found {
+			pool.stop()
+			delete(h.pools, name)
+		}
+	}
+	h.poolsMu.Unlock()
+
+	configHash := cfg.Hash()
+	h.auditWorker.Log(&models.AuditEntry{
+		Timestamp:  time.Now(),
+		SequenceID: h.getNextSequenceID(),
+		System: &models.SystemEvent{
+			Type:       models.SystemEventConfigChanged,
+			ConfigHash: configHash,
+			Changes:    changes,
+			Config:     sanitizedConfig(cfg),
+		},
+	})
+
+	log.Printf("Configuration reloaded: %d changes, config_hash=%s", len(changes), configHash)
+	for _, change := range changes {
+		log.Printf("  - %s", change)
+		if strings.HasSuffix(change, "(takes effect after restart)") {
+			log.Printf("WARNING: Configuration change needs a restart to take effect: %s", change)
+		}
+	}
+}
+
+// RecordStartup writes the startup record with the effective configuration, build version and host
+// Called before the server accepts requests, so the record opens the hash chain of the run
+// and every later entry is governed by the recorded configuration (until a config_changed record)
+func (h *Handler) RecordStartup(version string) {
+	host, err := os.Hostname()
+	if err != nil {
+		log.Printf("WARNING: Failed to determine host name for the startup record: %v", err)
+	}
+
+	cfg := h.live.Load().config
+	configHash := cfg.Hash()
+	h.auditWorker.Log(&models.AuditEntry{
+		Timestamp:  time.Now(),
+		SequenceID: h.getNextSequenceID(),
+		System: &models.SystemEvent{
+			Type:       models.SystemEventStartup,
+			ConfigHash: configHash,
+			Config:     sanitizedConfig(cfg),
+			Version:    version,
+			Host:       host,
+		},
+	})
+
+	log.Printf("Startup recorded: version=%s, host=%s, config_hash=%s", version, host, configHash)
+}
+
+// sanitizedConfig returns the configuration with secrets redacted as recorded in system events
+func sanitizedConfig(cfg *config.Config) json.RawMessage {
+	data, err := json.Marshal(cfg.Sanitized())
+	if err != nil {
+		// The sanitized configuration only holds plain data; this cannot happen
+		log.Printf("ERROR: Failed to marshal sanitized configuration: %v", err)
+		return nil
+	}
+	return data
 }
 
 // ServeHTTP implements http.Handler interface
-// Routes requests based on the first path segment (endpoint name)
-// Format: /{endpoint_name}/{actual_path}
+// Requests are served by the current configuration generation
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.live.Load().serve(w, r)
+}
+
+// serve routes requests based on the first path segment (endpoint name)
+// Format: /{endpoint_name}/{actual_path}
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request) {
 	// Panic recovery to ensure proxy remains operational
 	defer func() {
 		if rec := recover(); rec != nil {
@@ -58,6 +326,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	// Forward-proxy tunnels carry their requests back into ServeHTTP
+	if r.Method == http.MethodConnect {
+		h.serveConnect(w, r)
+		return
+	}
+
 	startTime := time.Now()
 
 	// Parse the endpoint name from the URL path
@@ -74,49 +348,164 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse target URL
-	targetURL, err := url.Parse(endpoint.Target)
+	// Resolve the endpoint's upstream targets
+	pool, err := h.upstreamPool(endpoint)
 	if err != nil {
-		log.Printf("ERROR: Invalid target URL for endpoint %s: %v", endpointName, err)
+		log.Printf("ERROR: Invalid upstream for endpoint %s: %v", endpointName, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	credentials := h.credentials[endpointName]
+	if credentials != nil && credentials.err != nil {
+		log.Printf("ERROR: Refusing request to endpoint %s: %v", endpointName, credentials.err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if h.authErr != nil {
+		log.Printf("ERROR: Refusing request to endpoint %s: client authentication unavailable", endpointName)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if h.sanitizerErr != nil {
+		log.Printf("ERROR: Refusing request to endpoint %s: sanitization rules unavailable", endpointName)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if h.redactorErr != nil {
+		log.Printf("ERROR: Refusing request to endpoint %s: body redaction unavailable", endpointName)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Read and capture request body
-	requestBody, err := io.ReadAll(r.Body)
+	if h.policiesErr != nil {
+		log.Printf("ERROR: Refusing request to endpoint %s: request policies unavailable", endpointName)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if h.guardrailsErr != nil {
+		log.Printf("ERROR: Refusing request to endpoint %s: response guardrails unavailable", endpointName)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if h.injectionErr != nil {
+		log.Printf("ERROR: Refusing request to endpoint %s: prompt-injection detection unavailable", endpointName)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Enforce the hard request size limit; bodies without a Content-Length are cut off while streaming
+	if maxBody := h.config.Requests.MaxBodySize; maxBody > 0 {
+		if r.ContentLength > maxBody {
+			log.Printf("WARNING: Request body too large for endpoint %s: %d bytes (limit %d)", endpointName, r.ContentLength, maxBody)
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+	}
+
+	// Capture the request body while it is streamed to the upstream
+	// Small bodies are read up front so they can be inspected before proxying
+	requestCapturer := NewRequestCapturer(r.Body, h.config.Requests.MaxAuditBodySize)
+	peeked, bodyComplete, err := requestCapturer.Peek(h.inspectBodySize())
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			log.Printf("WARNING: Request body too large for endpoint %s (limit %d)", endpointName, maxBytesErr.Limit)
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		log.Printf("ERROR: Failed to read request body for endpoint %s: %v", endpointName, err)
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
-	r.Body.Close()
+	r.Body = requestCapturer
 
-	// Replace body with a new reader for the proxy
-	r.Body = io.NopCloser(bytes.NewReader(requestBody))
+	// Check if this is a streaming request (SSE)
+	// Bodies too large to peek whole are only checked by headers; SSE responses are still
+	// detected from the response headers
+	var requestBody []byte
+	if bodyComplete {
+		requestBody = peeked
+	} else {
+		log.Printf("INFO: Request body for endpoint %s exceeds %d bytes and is forwarded uninspected: no stream detection, body policies or retries",
+			endpointName, h.inspectBodySize())
+	}
+	isStreaming := isStreamingRequest(r, requestBody)
+	isWebSocket := isWebSocketUpgrade(r)
 
-	// Create reverse proxy
-	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	// Identify the client and check it may use the endpoint
+	r, rej := h.authenticate(r, endpointName)
+	if rej != nil {
+		h.rejectRequest(w, r, startTime, endpointName, actualPath, requestCapturer, rej)
+		return
+	}
 
-	// Customize the director to modify the request
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-		// Combine target's base path with the actual request path
-		req.URL.Path = singleJoiningSlash(targetURL.Path, actualPath)
-		req.Host = targetURL.Host
+	// Apply the request policies; denied requests never reach the upstream
+	r, requestBody, rej = h.applyPolicies(r, endpointName, actualPath, requestBody, requestCapturer)
+	if rej != nil {
+		h.rejectRequest(w, r, startTime, endpointName, actualPath, requestCapturer, rej)
+		return
+	}
+	if decision := policy.FromContext(r.Context()); decision != nil && decision.Action == models.PolicyMutate {
+		// The rewritten body may have changed the stream flag
+		isStreaming = isStreamingRequest(r, requestBody)
 	}
 
-	// Check if this is a streaming request (SSE)
-	isStreaming := strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
-		strings.Contains(r.Header.Get("Content-Type"), "text/event-stream")
+	// Throttle clients exceeding their request rate or concurrent stream limits
+	// WebSocket sessions hold a stream slot for as long as they are open
+	releaseStream, rej := h.checkRateLimits(r, endpointName, isStreaming || isWebSocket)
+	if rej != nil {
+		h.rejectRequest(w, r, startTime, endpointName, actualPath, requestCapturer, rej)
+		return
+	}
+	defer releaseStream()
+
+	// Refuse requests whose token or cost budget is exhausted
+	if rej := h.checkBudgets(r, endpointName); rej != nil {
+		h.rejectRequest(w, r, startTime, endpointName, actualPath, requestCapturer, rej)
+		return
+	}
 
-	if isStreaming && h.config.Streaming.EnableSequenceTracking {
+	// Route through the upstream pool; failover needs the whole body to resend it
+	route := &upstreamRoute{
+		pool:        pool,
+		actualPath:  actualPath,
+		body:        requestBody,
+		replayable:  bodyComplete,
+		retry:       newRetryPolicy(endpoint.Retry),
+		credentials: credentials,
+	}
+
+	switch {
+	case isWebSocket:
+		// Relay the WebSocket session and audit it once it ends
+		h.handleWebSocket(w, r, route, startTime, endpointName, actualPath, requestCapturer)
+	case isStreaming && h.config.Streaming.EnableSequenceTracking:
 		// Handle streaming response with deferred audit finalization
-		h.handleStreamingResponse(w, r, proxy, startTime, endpointName, actualPath, requestBody)
-	} else {
+		h.handleStreamingResponse(w, r, route, startTime, endpointName, actualPath, requestCapturer)
+	default:
 		// Handle regular response with immediate audit finalization
-		h.handleRegularResponse(w, r, proxy, startTime, endpointName, actualPath, requestBody, isStreaming)
+		h.handleRegularResponse(w, r, route, startTime, endpointName, actualPath, requestCapturer, isStreaming)
+	}
+}
+
+// proxyErrorHandler replies to upstream failures
+// A request body cut off by the size limit is reported as 413 instead of a bad gateway
+func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		log.Printf("WARNING: Request body exceeded limit of %d bytes while proxying %s", maxBytesErr.Limit, r.URL.Path)
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
 	}
+	log.Printf("ERROR: Upstream request failed for %s: %v", r.URL.Path, err)
+	w.WriteHeader(http.StatusBadGateway)
 }
 
 // parseEndpoint extracts the endpoint name and actual path from the request path
@@ -140,6 +529,49 @@ func (h *Handler) parseEndpoint(path string) (string, string) {
 	return endpointName, actualPath
 }
 
+// isStreamingRequest reports whether the client asked for a Server-Sent Events response
+// Checks the Accept/Content-Type headers as well as the "stream": true flag in the JSON body,
+// which is how the official OpenAI and Anthropic SDKs request streaming
+func isStreamingRequest(r *http.Request, body []byte) bool {
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+		strings.Contains(r.Header.Get("Content-Type"), "text/event-stream") {
+		return true
+	}
+
+	// Only JSON object bodies can carry the stream flag
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return false
+	}
+
+	var payload struct {
+		Stream bool `json:"stream"`
+	}
+	if err := json.Unmarshal(trimmed, &payload); err != nil {
+		return false
+	}
+	return payload.Stream
+}
+
+// isEventStream reports whether the headers declare a Server-Sent Events body
+func isEventStream(headers http.Header) bool {
+	return strings.Contains(headers.Get("Content-Type"), "text/event-stream")
+}
+
+// extendConnDeadlines moves the connection's read and write deadlines for a single request
+// The server-wide timeouts would otherwise cut long SSE streams off (and cancel the request
+// context, which looks like a client disconnect). Must only be called after the request body was read.
+// Writers that do not support deadlines (e.g. httptest.ResponseRecorder) are left untouched
+func extendConnDeadlines(w http.ResponseWriter, deadline time.Time) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("WARNING: Failed to extend write deadline: %v", err)
+	}
+	if err := rc.SetReadDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("WARNING: Failed to extend read deadline: %v", err)
+	}
+}
+
 // singleJoiningSlash joins two URL paths with a single slash
 // Handles cases where either path has or doesn't have trailing/leading slashes
 func singleJoiningSlash(a, b string) string {
@@ -154,18 +586,6 @@ func singleJoiningSlash(a, b string) string {
 	return a + b
 }
 
-// sensitiveHeaders lists headers that should be masked in audit logs
-var sensitiveHeaders = map[string]bool{
-	"authorization":       true,
-	"cookie":              true,
-	"set-cookie":          true,
-	"x-api-key":           true,
-	"api-key":             true,
-	"x-auth-token":        true,
-	"x-csrf-token":        true,
-	"proxy-authorization": true,
-}
-
 // cloneHeaders creates a copy of HTTP headers
 func (h *Handler) cloneHeaders(headers http.Header) map[string][]string {
 	clone := make(map[string][]string, len(headers))
@@ -175,25 +595,42 @@ func (h *Handler) cloneHeaders(headers http.Header) map[string][]string {
 	return clone
 }
 
-// sanitizeHeaders masks sensitive header values for audit logging
-// Preserves header structure but redacts sensitive data like bearer tokens
+// sanitizeHeaders hides sensitive header values for audit logging
+// Preserves header structure but hides sensitive data like bearer tokens, as configured
+// by the sanitization rules
 func (h *Handler) sanitizeHeaders(headers map[string][]string) map[string][]string {
-	sanitized := make(map[string][]string, len(headers))
-	for k, values := range headers {
-		lowerKey := strings.ToLower(k)
-		if sensitiveHeaders[lowerKey] {
-			// Mask sensitive headers but preserve structure
-			masked := make([]string, len(values))
-			for i, v := range values {
-				masked[i] = h.maskSensitiveValue(v)
-			}
-			sanitized[k] = masked
-		} else {
-			// Copy non-sensitive headers as-is
-			sanitized[k] = append([]string(nil), values...)
-		}
+	if h.sanitizer == nil {
+		return defaultSanitizer.headers(headers)
 	}
-	return sanitized
+	return h.sanitizer.headers(headers)
+}
+
+// sanitizeURL masks credentials in the query string of rawURL for audit logging
+func (h *Handler) sanitizeURL(rawURL string) string {
+	if h.sanitizer == nil {
+		return defaultSanitizer.url(rawURL)
+	}
+	return h.sanitizer.url(rawURL)
+}
+
+// requestURL returns the sanitized URL the client requested
+// RequestURI is the request target as sent, so requests arriving through a forward-proxy
+// tunnel keep their original path rather than the endpoint-prefixed one they are routed by
+func (h *Handler) requestURL(r *http.Request) string {
+	target := r.RequestURI
+	if target == "" {
+		target = r.URL.RequestURI()
+	}
+	if !strings.HasPrefix(target, "/") {
+		// Absolute-form request target (plain HTTP forward proxying)
+		return h.sanitizeURL(target)
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return h.sanitizeURL(scheme + "://" + r.Host + target)
 }
 
 // sanitizeResponseHeaders sanitizes response headers and removes Content-Encoding
@@ -210,30 +647,20 @@ func (h *Handler) sanitizeResponseHeaders(headers map[string][]string, bodyWasDe
 	return sanitized
 }
 
-// maskSensitiveValue masks a sensitive header value
-// Shows prefix and last 4 characters for debugging while hiding the secret
-func (h *Handler) maskSensitiveValue(value string) string {
-	if len(value) == 0 {
-		return "[EMPTY]"
-	}
-
-	// For Bearer tokens, mask the token but keep the "Bearer" prefix
-	if strings.HasPrefix(value, "Bearer ") || strings.HasPrefix(value, "bearer ") {
-		token := value[7:] // Remove "Bearer " prefix
-		if len(token) <= 8 {
-			return "Bearer [REDACTED]"
-		}
-		// Show prefix and last 4 chars: "Bearer sk-...abc123"
-		return fmt.Sprintf("Bearer %s...%s", token[:3], token[len(token)-4:])
+// inspectBodySize returns how much of a request body is read before proxying
+func (h *Handler) inspectBodySize() int {
+	if h.config.Requests.MaxInspectBodySize <= 0 {
+		return requestPeekSize
 	}
+	return int(h.config.Requests.MaxInspectBodySize)
+}
 
-	// For other sensitive values, show only length
-	if len(value) <= 8 {
-		return "[REDACTED]"
+// stallThreshold returns the configured gap after which a stream is considered stalled
+func (h *Handler) stallThreshold() time.Duration {
+	if h.config.Streaming.StallThresholdMs <= 0 {
+		return defaultStallThreshold
 	}
-
-	// Show first 3 and last 4 characters
-	return fmt.Sprintf("%s...%s", value[:3], value[len(value)-4:])
+	return time.Duration(h.config.Streaming.StallThresholdMs) * time.Millisecond
 }
 
 // getNextSequenceID atomically increments and returns the next sequence ID
@@ -241,6 +668,14 @@ func (h *Handler) getNextSequenceID() uint64 {
 	return atomic.AddUint64(&h.nextSequenceID, 1) - 1
 }
 
+// redact replaces personal data and secrets in an audited body, appending what was replaced to findings
+// location names the body in the findings, e.g. "request.body"
+func (h *Handler) redact(body, location string, findings *[]models.RedactionFinding) string {
+	redacted, found := h.redactor.Redact(body, location)
+	*findings = append(*findings, found...)
+	return redacted
+}
+
 // extractMediaFromBodies extracts Base64 images from request and response bodies
 // Returns modified bodies and media references
 func (h *Handler) extractMediaFromBodies(requestBody, responseBody string, sequenceID uint64) (
@@ -325,18 +760,52 @@ func generateSpanID() string {
 func (h *Handler) handleRegularResponse(
 	w http.ResponseWriter,
 	r *http.Request,
-	proxy *httputil.ReverseProxy,
+	route *upstreamRoute,
 	startTime time.Time,
 	endpointName string,
 	actualPath string,
-	requestBody []byte,
+	requestCapturer *RequestCapturer,
 	isStreaming bool,
 ) {
 	// Create response capturer
 	capturer := NewResponseCapturer(w)
 
+	// The upstream may answer with SSE even though the request gave no hint
+	// Switch the capturer to streaming mode so the stream timeout and buffer limit still apply
+	ctx, cancel := context.WithCancelCause(r.Context())
+	defer cancel(nil)
+
+	var streamTimer *time.Timer
+	var blocked *blockedResponse
+	route.onResponse = func(resp *http.Response) error {
+		if isEventStream(resp.Header) {
+			capturer.EnableStreaming(ctx, h.config.Streaming.MaxAuditBodySize)
+			streamTimeout := time.Duration(h.config.Streaming.StreamTimeout) * time.Second
+			streamTimer = time.AfterFunc(streamTimeout-time.Since(startTime), func() {
+				cancel(context.DeadlineExceeded)
+			})
+			extendConnDeadlines(w, startTime.Add(streamTimeout+streamDeadlineGrace))
+			return nil
+		}
+
+		// Buffer the response so it can be withheld if a blocking guardrail fires
+		if h.guardrails.Blocks(endpointName) {
+			var err error
+			blocked, err = h.enforceGuardrails(resp, endpointName)
+			return err
+		}
+		return nil
+	}
+
 	// Proxy the request
-	proxy.ServeHTTP(capturer, r)
+	h.forward(capturer, r.WithContext(ctx), route)
+
+	if streamTimer != nil {
+		streamTimer.Stop()
+	}
+
+	// Record interruptions of upgraded streams (no-op for regular responses)
+	capturer.Complete()
 
 	// Calculate duration
 	duration := time.Since(startTime)
@@ -344,64 +813,100 @@ func (h *Handler) handleRegularResponse(
 	// Assign sequence ID
 	sequenceID := h.getNextSequenceID()
 
+	// A blocked response is audited as the upstream sent it; the client received the guardrail error
+	statusCode, responseHeaders, rawBody, responseError := capturer.StatusCode(), capturer.Headers(), capturer.Body(), capturer.Error()
+	if blocked != nil {
+		statusCode, responseHeaders, rawBody, responseError = blocked.statusCode, blocked.header, blocked.body, "GUARDRAIL_BLOCKED"
+	}
+
 	// Get decompressed response body for audit logging
-	responseBody := capturer.DecompressedBody()
-	bodyWasDecompressed := responseBody != capturer.Body()
+	responseBody := decompressBody(rawBody, responseHeaders)
+	bodyWasDecompressed := responseBody != rawBody
 
 	// Detect and reconstruct streaming responses (SSE format)
-	// This handles cases where streaming wasn't detected from request headers
+	// This handles cases where streaming wasn't detected from the request
 	var streamingMetadata *models.StreamingMetadata
-	contentType := capturer.Headers().Get("Content-Type")
-	if strings.Contains(contentType, "text/event-stream") {
-		reconstructedBody, metadata := reconstructStreamResponse(responseBody, startTime)
+	var rawStream *models.RawStreamReference
+	var redactions []models.RedactionFinding
+	if isEventStream(responseHeaders) {
+		isStreaming = true // Update flag for audit log
+		reconstructedBody, metadata := reconstructTimedStreamResponse(responseBody, startTime, capturer.EventTimes(), h.stallThreshold())
 		if metadata != nil {
+			rawStream = h.preserveRawStream(responseBody, sequenceID)
 			responseBody = reconstructedBody
 			streamingMetadata = metadata
-			isStreaming = true // Update flag for audit log
 		}
 	}
 
 	// Extract media from request and response bodies
 	modifiedReqBody, reqMedia, modifiedRespBody, respMedia := h.extractMediaFromBodies(
-		string(requestBody),
+		requestCapturer.Body(),
 		responseBody,
 		sequenceID,
 	)
 
+	// Remove personal data and secrets before the bodies are inspected and stored
+	// Runs after media extraction so the finding offsets refer to the stored bodies
+	requestBody := h.redact(modifiedReqBody, "request.body", &redactions)
+	auditedResponseBody := h.redact(modifiedRespBody, "response.body", &redactions)
+
 	// Extract trace context from headers
 	traceContext := h.extractTraceContext(r)
 
 	// Enrich trace context with tool call/result detection
 	if traceContext != nil {
-		trace.EnrichTraceContext(traceContext, string(requestBody), responseBody)
+		trace.EnrichTraceContext(traceContext, requestBody, auditedResponseBody)
 	}
 
+	// Score tool results and retrieved documents for prompt injection
+	h.injection.Inspect(traceContext, requestBody)
+
+	// Check the completion against the guardrails, before redaction hides what they look for
+	findings := h.checkGuardrails(endpointName, responseBody, traceContext)
+
+	// Account token usage and cost
+	tokenUsage := usage.Extract(requestBody, auditedResponseBody)
+	h.priceTable.Apply(tokenUsage)
+	h.budgets.Record(h.budgetSubject(r, endpointName), tokenUsage, time.Now())
+
 	// Create audit entry with complete data
 	entry := &models.AuditEntry{
 		Timestamp:  startTime,
 		Endpoint:   endpointName,
 		SequenceID: sequenceID,
 		Request: models.RequestDetails{
-			Method:          r.Method,
-			Path:            actualPath,
-			Headers:         h.sanitizeHeaders(h.cloneHeaders(r.Header)),
-			Body:            modifiedReqBody,
-			ContentLength:   r.ContentLength,
-			MediaReferences: reqMedia,
+			Method:           r.Method,
+			Path:             actualPath,
+			URL:              h.requestURL(r),
+			Headers:          h.sanitizeHeaders(h.cloneHeaders(r.Header)),
+			Body:             requestBody,
+			ContentLength:    r.ContentLength,
+			Truncated:        requestCapturer.IsTruncated(),
+			TruncatedAtBytes: requestCapturer.TruncatedAtBytes(),
+			MediaReferences:  reqMedia,
 		},
 		Response: models.ResponseDetails{
-			StatusCode:        capturer.StatusCode(),
-			Headers:           h.sanitizeResponseHeaders(h.cloneHeaders(capturer.Headers()), bodyWasDecompressed),
-			Body:              modifiedRespBody,
+			StatusCode:        statusCode,
+			Headers:           h.sanitizeResponseHeaders(h.cloneHeaders(responseHeaders), bodyWasDecompressed),
+			Body:              auditedResponseBody,
 			ContentLength:     int64(len(responseBody)),
 			Duration:          duration,
 			IsStreaming:       isStreaming,
 			IsComplete:        capturer.IsComplete(),
-			Error:             capturer.Error(),
+			Error:             responseError,
+			Truncated:         capturer.IsTruncated(),
+			TruncatedAtBytes:  capturer.TruncatedAtBytes(),
 			MediaReferences:   respMedia,
 			StreamingMetadata: streamingMetadata,
+			RawStream:         rawStream,
 		},
-		Trace: traceContext,
+		Trace:      traceContext,
+		Upstream:   route.details(traceContext),
+		Usage:      tokenUsage,
+		Principal:  auth.FromContext(r.Context()),
+		Redactions: redactions,
+		Policy:     policy.FromContext(r.Context()),
+		Findings:   findings,
 	}
 
 	// Send to audit worker (non-blocking due to buffered channel)
@@ -412,11 +917,11 @@ func (h *Handler) handleRegularResponse(
 func (h *Handler) handleStreamingResponse(
 	w http.ResponseWriter,
 	r *http.Request,
-	proxy *httputil.ReverseProxy,
+	route *upstreamRoute,
 	startTime time.Time,
 	endpointName string,
 	actualPath string,
-	requestBody []byte,
+	requestCapturer *RequestCapturer,
 ) {
 	// Assign sequence ID immediately (ensures correct ordering)
 	sequenceID := h.getNextSequenceID()
@@ -426,6 +931,9 @@ func (h *Handler) handleStreamingResponse(
 	ctx, cancel := context.WithTimeout(r.Context(), streamTimeout)
 	defer cancel()
 
+	// Let the stream outlive the server's read/write timeouts
+	extendConnDeadlines(w, startTime.Add(streamTimeout+streamDeadlineGrace))
+
 	// Extract trace context from headers (do this before callback closure)
 	traceContext := h.extractTraceContext(r)
 
@@ -450,37 +958,63 @@ func (h *Handler) handleStreamingResponse(
 		bodyWasDecompressed := responseBody != capturer.Body()
 
 		// Reconstruct streaming response from SSE deltas
-		reconstructedBody, streamingMetadata := reconstructStreamResponse(responseBody, startTime)
+		reconstructedBody, streamingMetadata := reconstructTimedStreamResponse(responseBody, startTime, capturer.EventTimes(), h.stallThreshold())
+
+		// Keep the exact transcript when reconstruction succeeded (opt-in)
+		var rawStream *models.RawStreamReference
+		var redactions []models.RedactionFinding
+		if streamingMetadata != nil {
+			rawStream = h.preserveRawStream(responseBody, sequenceID)
+		}
 
 		// Extract media from request and response bodies
 		modifiedReqBody, reqMedia, modifiedRespBody, respMedia := h.extractMediaFromBodies(
-			string(requestBody),
+			requestCapturer.Body(),
 			reconstructedBody,
 			sequenceID,
 		)
 
+		// Remove personal data and secrets before the bodies are inspected and stored
+		// Runs after media extraction so the finding offsets refer to the stored bodies
+		requestBody := h.redact(modifiedReqBody, "request.body", &redactions)
+		auditedResponseBody := h.redact(modifiedRespBody, "response.body", &redactions)
+
 		// Enrich trace context with tool call/result detection
 		if traceContext != nil {
-			trace.EnrichTraceContext(traceContext, string(requestBody), reconstructedBody)
+			trace.EnrichTraceContext(traceContext, requestBody, auditedResponseBody)
 		}
 
+		// Score tool results and retrieved documents for prompt injection
+		h.injection.Inspect(traceContext, requestBody)
+
+		// Check the completion against the guardrails; the stream already reached the client
+		findings := h.checkGuardrails(endpointName, reconstructedBody, traceContext)
+
+		// Account token usage and cost
+		tokenUsage := usage.Extract(requestBody, auditedResponseBody)
+		h.priceTable.Apply(tokenUsage)
+		h.budgets.Record(h.budgetSubject(r, endpointName), tokenUsage, time.Now())
+
 		// Create audit entry with finalized data
 		entry := &models.AuditEntry{
 			Timestamp:  startTime,
 			Endpoint:   endpointName,
 			SequenceID: sequenceID,
 			Request: models.RequestDetails{
-				Method:          r.Method,
-				Path:            actualPath,
-				Headers:         h.sanitizeHeaders(h.cloneHeaders(r.Header)),
-				Body:            modifiedReqBody,
-				ContentLength:   r.ContentLength,
-				MediaReferences: reqMedia,
+				Method:           r.Method,
+				Path:             actualPath,
+				URL:              h.requestURL(r),
+				Headers:          h.sanitizeHeaders(h.cloneHeaders(r.Header)),
+				Body:             requestBody,
+				ContentLength:    r.ContentLength,
+				Truncated:        requestCapturer.IsTruncated(),
+				TruncatedAtBytes: requestCapturer.TruncatedAtBytes(),
+				MediaReferences:  reqMedia,
 			},
 			Response: models.ResponseDetails{
 				StatusCode:        capturer.StatusCode(),
 				Headers:           h.sanitizeResponseHeaders(h.cloneHeaders(capturer.Headers()), bodyWasDecompressed),
-				Body:              modifiedRespBody,
+				Body:              auditedResponseBody,
 				ContentLength:     int64(len(reconstructedBody)),
 				Duration:          duration,
 				IsStreaming:       true,
@@ -490,8 +1024,15 @@ func (h *Handler) handleStreamingResponse(
 				TruncatedAtBytes:  capturer.TruncatedAtBytes(),
 				MediaReferences:   respMedia,
 				StreamingMetadata: streamingMetadata,
+				RawStream:         rawStream,
 			},
-			Trace: traceContext,
+			Trace:      traceContext,
+			Upstream:   route.details(traceContext),
+			Usage:      tokenUsage,
+			Principal:  auth.FromContext(r.Context()),
+			Redactions: redactions,
+			Policy:     policy.FromContext(r.Context()),
+			Findings:   findings,
 		}
 
 		// Send to audit worker
@@ -523,7 +1064,8 @@ func (h *Handler) handleStreamingResponse(
 	go capturer.StartMonitoring()
 
 	// Proxy the request (connection stays open for streaming)
-	proxy.ServeHTTP(capturer, r)
+	// The stream context is propagated upstream so the stream timeout actually ends the stream
+	h.forward(capturer, r.WithContext(ctx), route)
 
 	// ServeHTTP returns when the upstream finishes or connection breaks
 	// Finalize the audit entry (callback called only once due to atomic flag)
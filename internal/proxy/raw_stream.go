@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+)
+
+// Raw stream encodings
+const (
+	rawStreamEncodingInline  = "gzip+base64"
+	rawStreamEncodingSidecar = "gzip"
+)
+
+// preserveRawStream compresses the raw SSE transcript and stores it inline or as a sidecar file
+// Returns nil if preservation is disabled or fails (fail-open: the audit entry is still written)
+// Nothing is preserved while redaction is enabled: values split across SSE events cannot be
+// redacted in the transcript, and a redacted transcript would no longer reconstruct to the body
+func (h *Handler) preserveRawStream(raw string, sequenceID uint64) *models.RawStreamReference {
+	if !h.config.Streaming.PreserveRawStream || h.redactor != nil || raw == "" {
+		return nil
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write([]byte(raw)); err != nil {
+		log.Printf("WARNING: Failed to compress raw stream: seq=%d, error=%v", sequenceID, err)
+		return nil
+	}
+	if err := gz.Close(); err != nil {
+		log.Printf("WARNING: Failed to compress raw stream: seq=%d, error=%v", sequenceID, err)
+		return nil
+	}
+
+	hash := sha256.Sum256([]byte(raw))
+	ref := &models.RawStreamReference{
+		SHA256:          hex.EncodeToString(hash[:]),
+		SizeBytes:       int64(len(raw)),
+		CompressedBytes: int64(compressed.Len()),
+	}
+
+	if h.config.Streaming.RawStreamStorage == config.RawStreamStorageSidecar {
+		filePath, err := h.mediaExtractor.SaveBlob(compressed.Bytes(), sequenceID, "raw_stream", "sse.gz")
+		if err == nil {
+			ref.Encoding = rawStreamEncodingSidecar
+			ref.FilePath = filePath
+			return ref
+		}
+		// Fall back to inline storage so the transcript is not lost
+		log.Printf("WARNING: Failed to write raw stream sidecar, storing inline: seq=%d, error=%v", sequenceID, err)
+	}
+
+	ref.Encoding = rawStreamEncodingInline
+	ref.Data = base64.StdEncoding.EncodeToString(compressed.Bytes())
+	return ref
+}
+
+// LoadRawStream decodes a preserved raw SSE transcript and checks it against its recorded hash
+// mediaDir is the media storage directory that sidecar file paths are relative to
+func LoadRawStream(ref *models.RawStreamReference, mediaDir string) (string, error) {
+	var compressed []byte
+	var err error
+
+	switch ref.Encoding {
+	case rawStreamEncodingInline:
+		compressed, err = base64.StdEncoding.DecodeString(ref.Data)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode raw stream: %w", err)
+		}
+	case rawStreamEncodingSidecar:
+		compressed, err = os.ReadFile(filepath.Join(mediaDir, ref.FilePath))
+		if err != nil {
+			return "", fmt.Errorf("failed to read raw stream sidecar: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("unknown raw stream encoding: %s", ref.Encoding)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", fmt.Errorf("failed to open raw stream: %w", err)
+	}
+	defer reader.Close()
+
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress raw stream: %w", err)
+	}
+
+	hash := sha256.Sum256(raw)
+	if hex.EncodeToString(hash[:]) != ref.SHA256 {
+		return "", fmt.Errorf("raw stream hash mismatch")
+	}
+
+	return string(raw), nil
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/audit"
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+const rawStreamTestSSE = `data: {"id":"chatcmpl-raw","object":"chat.completion.chunk","created":1,"model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-raw","object":"chat.completion.chunk","created":1,"model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`
+
+// TestRawStreamPreservation verifies the raw SSE transcript is preserved and re-reconstructs to the stored body
+func TestRawStreamPreservation(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage string
+	}{
+		{"inline", config.RawStreamStorageInline},
+		{"sidecar", config.RawStreamStorageSidecar},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(rawStreamTestSSE))
+			}))
+			defer backend.Close()
+
+			mediaDir := t.TempDir()
+			cfg := createTestConfig(backend.URL)
+			cfg.Streaming.PreserveRawStream = true
+			cfg.Streaming.RawStreamStorage = tt.storage
+			cfg.Media.StoragePath = mediaDir
+
+			storage := &mockAuditStorage{}
+			worker := audit.NewWorker(storage, "test-seed", 10)
+			defer worker.Shutdown()
+
+			handler := NewHandler(cfg, worker)
+
+			req := httptest.NewRequest("POST", "/test/chat/completions", strings.NewReader(`{"stream":true}`))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			time.Sleep(100 * time.Millisecond)
+
+			if len(storage.Entries()) != 1 {
+				t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
+			}
+
+			entry := storage.Entries()[0]
+			ref := entry.Response.RawStream
+			if ref == nil {
+				t.Fatal("Expected raw stream to be preserved")
+			}
+
+			if tt.storage == config.RawStreamStorageSidecar {
+				if ref.FilePath == "" || ref.Data != "" {
+					t.Errorf("Expected sidecar reference, got %+v", ref)
+				}
+				if _, err := os.Stat(filepath.Join(mediaDir, ref.FilePath)); err != nil {
+					t.Errorf("Sidecar file not written: %v", err)
+				}
+			} else if ref.Data == "" || ref.FilePath != "" {
+				t.Errorf("Expected inline reference, got %+v", ref)
+			}
+
+			raw, err := LoadRawStream(ref, mediaDir)
+			if err != nil {
+				t.Fatalf("Failed to load raw stream: %v", err)
+			}
+			if raw != rawStreamTestSSE {
+				t.Error("Preserved transcript should match the bytes sent by the upstream")
+			}
+
+			reconstructed, ok := ReconstructStream(raw)
+			if !ok || reconstructed != entry.Response.Body {
+				t.Errorf("Re-running reconstruction should reproduce the stored body:\nstored: %s\nrerun:  %s", entry.Response.Body, reconstructed)
+			}
+		})
+	}
+}
+
+// TestRawStreamDisabledByDefault verifies transcripts are only preserved when enabled
+func TestRawStreamDisabledByDefault(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(rawStreamTestSSE))
+	}))
+	defer backend.Close()
+
+	cfg := createTestConfig(backend.URL)
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+
+	req := httptest.NewRequest("POST", "/test/chat/completions", strings.NewReader(`{"stream":true}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	time.Sleep(100 * time.Millisecond)
+
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
+	}
+	if storage.Entries()[0].Response.RawStream != nil {
+		t.Error("Raw stream should not be preserved unless enabled")
+	}
+}
+
+// TestLoadRawStreamDetectsTampering verifies a modified transcript fails the hash check
+func TestLoadRawStreamDetectsTampering(t *testing.T) {
+	cfg := createTestConfig("http://localhost")
+	cfg.Streaming.PreserveRawStream = true
+	cfg.Streaming.RawStreamStorage = config.RawStreamStorageInline
+	handler := NewHandler(cfg, nil)
+
+	ref := handler.preserveRawStream(rawStreamTestSSE, 0)
+	if ref == nil {
+		t.Fatal("Expected raw stream reference")
+	}
+
+	ref.SHA256 = strings.Repeat("0", 64)
+	if _, err := LoadRawStream(ref, ""); err == nil {
+		t.Error("Expected hash mismatch error for tampered transcript")
+	}
+}
@@ -0,0 +1,303 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/auth"
+	"github.com/jnd-labs/aiblackbox/internal/budget"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+	"github.com/jnd-labs/aiblackbox/internal/policy"
+	"github.com/jnd-labs/aiblackbox/internal/ratelimit"
+)
+
+// rejection describes a request refused by the proxy before it reached the upstream
+type rejection struct {
+	status     int
+	errorType  string // OpenAI-style error type, upper-cased as the audit error code
+	message    string
+	retryAfter time.Duration // Sent as Retry-After when positive
+	headers    map[string]string
+	details    map[string]interface{}
+}
+
+// rejectRequest answers with an OpenAI-compatible JSON error and records the rejection in the audit chain
+func (h *Handler) rejectRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	startTime time.Time,
+	endpointName string,
+	actualPath string,
+	requestCapturer *RequestCapturer,
+	rej *rejection,
+) {
+	errorBody := map[string]interface{}{
+		"message": rej.message,
+		"type":    rej.errorType,
+		"code":    rej.errorType,
+	}
+	for k, v := range rej.details {
+		errorBody[k] = v
+	}
+	body, err := json.Marshal(map[string]interface{}{"error": errorBody})
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal rejection body: %v", err)
+		body = []byte(`{"error":{"type":"` + rej.errorType + `"}}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	for name, value := range rej.headers {
+		w.Header().Set(name, value)
+	}
+	if rej.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rej.retryAfter.Seconds()))))
+	}
+	w.WriteHeader(rej.status)
+	w.Write(body)
+
+	sequenceID := h.getNextSequenceID()
+	var redactions []models.RedactionFinding
+	requestBody := h.redact(requestCapturer.Body(), "request.body", &redactions)
+
+	entry := &models.AuditEntry{
+		Timestamp:  startTime,
+		Endpoint:   endpointName,
+		SequenceID: sequenceID,
+		Request: models.RequestDetails{
+			Method:           r.Method,
+			Path:             actualPath,
+			URL:              h.requestURL(r),
+			Headers:          h.sanitizeHeaders(h.cloneHeaders(r.Header)),
+			Body:             requestBody,
+			ContentLength:    r.ContentLength,
+			Truncated:        requestCapturer.IsTruncated(),
+			TruncatedAtBytes: requestCapturer.TruncatedAtBytes(),
+		},
+		Response: models.ResponseDetails{
+			StatusCode:    rej.status,
+			Headers:       h.cloneHeaders(w.Header()),
+			Body:          string(body),
+			ContentLength: int64(len(body)),
+			Duration:      time.Since(startTime),
+			IsComplete:    true,
+			Error:         strings.ToUpper(rej.errorType),
+		},
+		Trace:      h.extractTraceContext(r),
+		Principal:  auth.FromContext(r.Context()),
+		Redactions: redactions,
+		Policy:     policy.FromContext(r.Context()),
+	}
+
+	h.auditWorker.Log(entry)
+
+	log.Printf("WARNING: Request rejected: endpoint=%s, seq=%d, status=%d, reason=%s",
+		endpointName, sequenceID, rej.status, rej.message)
+}
+
+// authenticate identifies the client and checks the endpoint allowlist
+// Requests inside a forward-proxy tunnel use the client authenticated on the CONNECT request
+// Returns the request carrying the principal, which is set even when the endpoint is refused
+// so the rejection is attributed to the client
+func (h *Handler) authenticate(r *http.Request, endpointName string) (*http.Request, *rejection) {
+	if !h.authenticator.Enabled() {
+		return r, nil
+	}
+
+	identity := tunnelIdentity(r.Context())
+	var err error
+	if identity == nil {
+		identity, err = h.authenticator.Authenticate(r)
+	}
+	if err != nil {
+		return r, &rejection{
+			status:    http.StatusUnauthorized,
+			errorType: "authentication_error",
+			message:   "Authentication failed: " + err.Error(),
+			headers:   map[string]string{"WWW-Authenticate": `Bearer realm="aiblackbox"`},
+		}
+	}
+
+	r = r.WithContext(auth.NewContext(r.Context(), &identity.Principal))
+	if !identity.Allows(endpointName) {
+		return r, &rejection{
+			status:    http.StatusForbidden,
+			errorType: "permission_error",
+			message:   fmt.Sprintf("Client %q is not allowed to use endpoint %q", identity.Principal.ID, endpointName),
+		}
+	}
+	return r, nil
+}
+
+// applyPolicies evaluates the request policies and rewrites the body of mutated requests
+// body is the complete request body, or nil if it was too large to inspect
+// Returns the request carrying the decision, so every audit entry for it records the decision,
+// and the body as it is forwarded
+func (h *Handler) applyPolicies(r *http.Request, endpointName, actualPath string, body []byte, capturer *RequestCapturer) (*http.Request, []byte, *rejection) {
+	client := ""
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		client = principal.ID
+	}
+
+	// Bodies too large to inspect cannot match body conditions; refuse them if configured to fail closed
+	if body == nil && h.policies.NeedsBody(endpointName, client) {
+		if h.config.Policies.RequireInspectableBody {
+			return r, body, &rejection{
+				status:    http.StatusRequestEntityTooLarge,
+				errorType: "body_not_inspectable",
+				message:   "Request body is too large for the request policies to inspect",
+				details:   map[string]interface{}{"max_inspect_body_size": h.inspectBodySize()},
+			}
+		}
+		log.Printf("WARNING: Request policies skip the body of a request to endpoint %s: body too large to inspect", endpointName)
+	}
+
+	decision, rewritten := h.policies.Evaluate(&policy.Request{
+		Endpoint: endpointName,
+		Client:   client,
+		Path:     actualPath,
+		Header:   r.Header,
+		Body:     body,
+	})
+	if decision == nil {
+		return r, body, nil
+	}
+	r = r.WithContext(policy.NewContext(r.Context(), decision))
+
+	switch decision.Action {
+	case models.PolicyDeny:
+		return r, body, &rejection{
+			status:    http.StatusForbidden,
+			errorType: "policy_violation",
+			message:   h.policies.Message(decision.Rule),
+			details:   map[string]interface{}{"policy": decision.Rule},
+		}
+	case models.PolicyFlag:
+		log.Printf("WARNING: Request flagged by policy %s: endpoint=%s, path=%s", decision.Rule, endpointName, actualPath)
+	case models.PolicyMutate:
+		log.Printf("INFO: Request rewritten by policy %s: endpoint=%s, changes=%s", decision.Rule, endpointName, strings.Join(decision.Mutations, ", "))
+	}
+
+	// The rewritten body is forwarded, retried and audited in place of the original
+	if rewritten != nil {
+		capturer.Replace(rewritten)
+		r.ContentLength = int64(len(rewritten))
+		body = rewritten
+	}
+	return r, body, nil
+}
+
+// checkBudgets returns a rejection if any budget for the request is exhausted
+func (h *Handler) checkBudgets(r *http.Request, endpointName string) *rejection {
+	violation := h.budgets.Check(h.budgetSubject(r, endpointName), time.Now())
+	if violation == nil {
+		return nil
+	}
+
+	return &rejection{
+		status:     http.StatusTooManyRequests,
+		errorType:  "budget_exceeded",
+		message:    violation.Error(),
+		retryAfter: violation.RetryAfter,
+		details: map[string]interface{}{
+			"budget":              violation.Rule,
+			"scope":               violation.Scope,
+			"metric":              violation.Metric,
+			"used":                violation.Used,
+			"limit":               violation.Limit,
+			"retry_after_seconds": int(math.Ceil(violation.RetryAfter.Seconds())),
+		},
+	}
+}
+
+// checkRateLimits takes a request token from every applicable rate limit
+// Streaming requests also reserve a stream slot, freed by the returned release function
+func (h *Handler) checkRateLimits(r *http.Request, endpointName string, isStreaming bool) (func(), *rejection) {
+	release, violation := h.rateLimiter.Allow(h.rateLimitSubject(r, endpointName), isStreaming, time.Now())
+	if violation == nil {
+		return release, nil
+	}
+
+	return release, &rejection{
+		status:     http.StatusTooManyRequests,
+		errorType:  "rate_limit_exceeded",
+		message:    violation.Error(),
+		retryAfter: violation.RetryAfter,
+		details: map[string]interface{}{
+			"rate_limit":          violation.Rule,
+			"scope":               violation.Scope,
+			"limit":               violation.Limit,
+			"retry_after_seconds": int(math.Ceil(violation.RetryAfter.Seconds())),
+		},
+	}
+}
+
+// rateLimitSubject identifies who a request is counted against for rate limits
+// The authenticated principal wins, then the configured client header, then the API key fingerprint
+func (h *Handler) rateLimitSubject(r *http.Request, endpointName string) ratelimit.Subject {
+	client := principalKey(r)
+	if header := h.config.RateLimits.ClientHeader; header != "" && client == "" {
+		client = r.Header.Get(header)
+	}
+	if client == "" {
+		client = apiKeyFingerprint(r.Header)
+	}
+
+	return ratelimit.Subject{
+		Endpoint: endpointName,
+		Client:   client,
+	}
+}
+
+// budgetSubject identifies who a request is counted against for budgets
+// The api_key scope counts per authenticated principal when client authentication is enabled
+func (h *Handler) budgetSubject(r *http.Request, endpointName string) budget.Subject {
+	apiKey := principalKey(r)
+	if apiKey == "" {
+		apiKey = apiKeyFingerprint(r.Header)
+	}
+
+	return budget.Subject{
+		Endpoint: endpointName,
+		APIKey:   apiKey,
+		TraceID:  r.Header.Get("X-Trace-ID"),
+	}
+}
+
+// principalKey identifies the authenticated client for rate limits and budgets, or ""
+// Prefixed so principal names never collide with API key fingerprints
+func principalKey(r *http.Request) string {
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		return "principal:" + principal.ID
+	}
+	return ""
+}
+
+// apiKeyFingerprint returns a short SHA-256 fingerprint of the client credential
+// Checks Authorization (Bearer), x-api-key and api-key; returns "" if none is present
+// The credential itself is never stored
+func apiKeyFingerprint(headers http.Header) string {
+	credential := headers.Get("Authorization")
+	if len(credential) > 7 && strings.EqualFold(credential[:7], "bearer ") {
+		credential = credential[7:]
+	}
+	if credential == "" {
+		credential = headers.Get("X-Api-Key")
+	}
+	if credential == "" {
+		credential = headers.Get("Api-Key")
+	}
+	if credential == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(credential))
+	return hex.EncodeToString(sum[:8])
+}
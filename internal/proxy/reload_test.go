@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/audit"
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+)
+
+// TestHandlerReload verifies new requests use the reloaded config while in-flight streams finish on the old one
+func TestHandlerReload(t *testing.T) {
+	release := make(chan struct{})
+	streaming := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		flusher := w.(http.Flusher)
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hello\"}}]}\n\n")
+		flusher.Flush()
+		<-release
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\" world\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer streaming.Close()
+
+	regular := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message": "second"}`))
+	}))
+	defer regular.Close()
+
+	cfg := createTestConfig(streaming.URL)
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// Start a stream on the original config
+	resp, err := http.Post(server.URL+"/test/v1/chat/completions", "application/json", strings.NewReader(`{"stream": true}`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("Failed to read first event: %v", err)
+	}
+
+	// Replace the endpoint while the stream is open
+	reloaded := createTestConfig(regular.URL)
+	reloaded.Endpoints = []config.EndpointConfig{{Name: "second", Target: regular.URL}}
+	handler.Reload(reloaded)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/second/v1/chat/completions", strings.NewReader(`{}`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected added endpoint to be served, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected removed endpoint to be unknown, got %d", w.Code)
+	}
+
+	// The stream finishes on the old config
+	close(release)
+	rest, _ := io.ReadAll(reader)
+	if !strings.Contains(string(rest), "world") {
+		t.Errorf("Expected the stream to complete, got %q", rest)
+	}
+
+	// Reloading the same config again changes nothing
+	handler.Reload(reloaded)
+
+	time.Sleep(200 * time.Millisecond)
+
+	if len(storage.Entries()) != 3 {
+		t.Fatalf("Expected 3 audit entries, got %d", len(storage.Entries()))
+	}
+	bySeq := make(map[uint64]*models.AuditEntry)
+	for _, entry := range storage.Entries() {
+		bySeq[entry.SequenceID] = entry
+	}
+
+	stream := bySeq[0]
+	if stream == nil || stream.Endpoint != "test" || !stream.Response.IsComplete {
+		t.Errorf("Expected the complete stream as entry 0, got %+v", stream)
+	}
+
+	change := bySeq[1]
+	if change == nil || change.System == nil {
+		t.Fatalf("Expected config change as entry 1, got %+v", change)
+	}
+	if change.System.Type != models.SystemEventConfigChanged || change.System.ConfigHash != reloaded.Hash() {
+		t.Errorf("Unexpected system event: %+v", change.System)
+	}
+	if got := strings.Join(change.System.Changes, "; "); got != "endpoint added: second; endpoint removed: test" {
+		t.Errorf("Unexpected change summary: %s", got)
+	}
+	if !strings.Contains(string(change.System.Config), `"name":"second"`) {
+		t.Errorf("Expected the reloaded configuration in the change record, got %s", change.System.Config)
+	}
+
+	if second := bySeq[2]; second == nil || second.Endpoint != "second" {
+		t.Errorf("Expected the new endpoint's request as entry 2, got %+v", second)
+	}
+}
+
+// TestHandlerRecordStartup verifies the startup record opens the chain with the sanitized configuration
+func TestHandlerRecordStartup(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	cfg := createTestConfig(upstream.URL)
+	cfg.Server.GenesisSeed = "private-seed"
+	cfg.Endpoints[0].Headers = []config.HeaderInjection{{Name: "Authorization", Value: "Bearer ${env:TEST_UPSTREAM_KEY}"}}
+	t.Setenv("TEST_UPSTREAM_KEY", "sk-upstream-secret")
+
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+	handler.RecordStartup("v1.2.0")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`)))
+
+	time.Sleep(200 * time.Millisecond)
+
+	if len(storage.Entries()) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %d", len(storage.Entries()))
+	}
+	startup := storage.Entries()[0]
+	if startup.SequenceID != 0 || startup.System == nil || startup.System.Type != models.SystemEventStartup {
+		t.Fatalf("Expected the startup record as entry 0, got %+v", startup)
+	}
+	if startup.System.Version != "v1.2.0" || startup.System.Host == "" || startup.System.ConfigHash != cfg.Hash() {
+		t.Errorf("Unexpected startup record: %+v", startup.System)
+	}
+
+	// The hash covers the recorded sanitized configuration, not the secrets
+	recomputed := sha256.Sum256(startup.System.Config)
+	if startup.System.ConfigHash != hex.EncodeToString(recomputed[:]) {
+		t.Errorf("Expected the config hash to be recomputable from the recorded config, got %s", startup.System.ConfigHash)
+	}
+
+	recorded := string(startup.System.Config)
+	if strings.Contains(recorded, "private-seed") || strings.Contains(recorded, "sk-upstream-secret") {
+		t.Errorf("Startup record leaks secrets: %s", recorded)
+	}
+	if !strings.Contains(recorded, `"target":"`+upstream.URL+`"`) {
+		t.Errorf("Expected the endpoint in the startup record, got %s", recorded)
+	}
+
+	if request := storage.Entries()[1]; request.SequenceID != 1 || request.PrevHash != startup.Hash {
+		t.Errorf("Expected the request chained after the startup record, got seq=%d", request.SequenceID)
+	}
+}
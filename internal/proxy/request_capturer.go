@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// requestPeekSize is how much of a request body is read before proxying, unless
+// requests.max_inspect_body_size is set
+// Bodies up to this size are buffered whole so the JSON can be inspected up front
+// (e.g. "stream": true); larger bodies are streamed to the upstream as they arrive
+const requestPeekSize = 1 << 20 // 1 MB
+
+// RequestCapturer tees a request body to the upstream while keeping a copy for the audit log
+// Only the first maxSize bytes are kept; the rest is forwarded but not retained
+type RequestCapturer struct {
+	source  io.ReadCloser
+	reader  io.Reader
+	maxSize int64 // 0 means unlimited
+
+	mu        sync.Mutex
+	body      bytes.Buffer
+	size      int64
+	truncated bool
+}
+
+// NewRequestCapturer wraps a request body, capturing up to maxSize bytes (0 for unlimited)
+func NewRequestCapturer(body io.ReadCloser, maxSize int64) *RequestCapturer {
+	rc := &RequestCapturer{
+		source:  body,
+		maxSize: maxSize,
+	}
+	rc.reader = io.TeeReader(body, captureWriter{rc})
+	return rc
+}
+
+// Peek reads up to n bytes ahead of the upstream and reports whether that was the whole body
+// The peeked bytes are replayed by Read, so the upstream still receives the full body
+func (rc *RequestCapturer) Peek(n int) ([]byte, bool, error) {
+	prefix, err := io.ReadAll(io.LimitReader(rc.reader, int64(n)+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	rc.reader = io.MultiReader(bytes.NewReader(prefix), rc.reader)
+	return prefix, len(prefix) <= n, nil
+}
+
+// Replace swaps a body peeked whole for a rewritten one, which is forwarded and captured instead
+func (rc *RequestCapturer) Replace(body []byte) {
+	rc.mu.Lock()
+	rc.body.Reset()
+	rc.size = 0
+	rc.truncated = false
+	rc.mu.Unlock()
+
+	rc.reader = io.TeeReader(bytes.NewReader(body), captureWriter{rc})
+}
+
+// Read implements io.Reader, capturing everything that is forwarded upstream
+func (rc *RequestCapturer) Read(p []byte) (int, error) {
+	return rc.reader.Read(p)
+}
+
+// Close implements io.Closer
+func (rc *RequestCapturer) Close() error {
+	return rc.source.Close()
+}
+
+// captureWriter receives the bytes read from the client body
+type captureWriter struct {
+	rc *RequestCapturer
+}
+
+func (w captureWriter) Write(data []byte) (int, error) {
+	w.rc.capture(data)
+	return len(data), nil
+}
+
+// capture keeps data up to the audit limit and tracks the total size
+func (rc *RequestCapturer) capture(data []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	keep := int64(len(data))
+	if rc.maxSize > 0 {
+		keep = max(min(keep, rc.maxSize-rc.size), 0)
+	}
+	rc.body.Write(data[:keep])
+	rc.size += int64(len(data))
+
+	if rc.maxSize > 0 && rc.size > rc.maxSize {
+		rc.truncated = true
+	}
+}
+
+// Body returns the captured request body
+// If truncated, appends a truncation marker
+func (rc *RequestCapturer) Body() string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body := rc.body.String()
+	if rc.truncated {
+		body += "\n[TRUNCATED: request exceeded requests.max_audit_body_size limit]"
+	}
+	return body
+}
+
+// Size returns the number of body bytes read from the client so far
+func (rc *RequestCapturer) Size() int64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.size
+}
+
+// TruncatedAtBytes returns the original size before truncation
+// Only meaningful when IsTruncated() returns true
+func (rc *RequestCapturer) TruncatedAtBytes() int64 {
+	return rc.Size()
+}
+
+// IsTruncated returns whether the captured body was truncated
+func (rc *RequestCapturer) IsTruncated() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.truncated
+}
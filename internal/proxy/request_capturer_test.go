@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestRequestCapturerPeekSmallBody verifies small bodies are read whole and replayed
+func TestRequestCapturerPeekSmallBody(t *testing.T) {
+	body := `{"model":"gpt-4","stream":true}`
+	rc := NewRequestCapturer(io.NopCloser(strings.NewReader(body)), 0)
+
+	peeked, complete, err := rc.Peek(1024)
+	if err != nil {
+		t.Fatalf("Peek failed: %v", err)
+	}
+	if !complete {
+		t.Error("Body smaller than the peek size should be complete")
+	}
+	if string(peeked) != body {
+		t.Errorf("Expected peeked body %q, got %q", body, peeked)
+	}
+
+	forwarded, _ := io.ReadAll(rc)
+	if string(forwarded) != body {
+		t.Errorf("Expected forwarded body %q, got %q", body, forwarded)
+	}
+	if rc.Body() != body {
+		t.Errorf("Expected captured body %q, got %q", body, rc.Body())
+	}
+}
+
+// TestRequestCapturerTruncation verifies the audit copy is limited while the full body is forwarded
+func TestRequestCapturerTruncation(t *testing.T) {
+	body := strings.Repeat("A", 5000)
+	rc := NewRequestCapturer(io.NopCloser(strings.NewReader(body)), 1000)
+
+	_, complete, err := rc.Peek(100)
+	if err != nil {
+		t.Fatalf("Peek failed: %v", err)
+	}
+	if complete {
+		t.Error("Body larger than the peek size should not be complete")
+	}
+
+	forwarded, _ := io.ReadAll(rc)
+	if len(forwarded) != len(body) {
+		t.Errorf("Expected %d forwarded bytes, got %d", len(body), len(forwarded))
+	}
+
+	if !rc.IsTruncated() {
+		t.Error("Capture should be truncated")
+	}
+	if rc.TruncatedAtBytes() != int64(len(body)) {
+		t.Errorf("Expected TruncatedAtBytes %d, got %d", len(body), rc.TruncatedAtBytes())
+	}
+	captured := rc.Body()
+	if !strings.HasPrefix(captured, strings.Repeat("A", 1000)+"\n[TRUNCATED:") {
+		t.Errorf("Expected 1000 captured bytes followed by a truncation marker, got %d bytes", len(captured))
+	}
+}
+
+// TestRequestCapturerExactLimit verifies a body exactly at the limit is not marked truncated
+func TestRequestCapturerExactLimit(t *testing.T) {
+	body := strings.Repeat("B", 1000)
+	rc := NewRequestCapturer(io.NopCloser(strings.NewReader(body)), 1000)
+
+	io.ReadAll(rc)
+
+	if rc.IsTruncated() {
+		t.Error("Body at the limit should not be truncated")
+	}
+	if rc.Body() != body {
+		t.Error("Captured body should match the original")
+	}
+}
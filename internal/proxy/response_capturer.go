@@ -1,14 +1,18 @@
 package proxy
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"context"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // ResponseCapturer wraps http.ResponseWriter to capture response data
@@ -17,6 +21,10 @@ import (
 type ResponseCapturer struct {
 	http.ResponseWriter
 
+	// mu guards the capture state below; streaming responses are finalized by the monitoring
+	// goroutine while the proxy may still be writing
+	mu sync.Mutex
+
 	// Core capture fields
 	statusCode int
 	body       strings.Builder
@@ -36,6 +44,12 @@ type ResponseCapturer struct {
 	errorMsg   string
 	isComplete bool
 	writeErr   error
+
+	// SSE event timing (only tracked for uncompressed text/event-stream bodies)
+	trackEvents bool
+	lineEmpty   bool
+	eventOpen   bool
+	eventTimes  []time.Time
 }
 
 // NewResponseCapturer creates a new response capturer for regular (non-streaming) responses
@@ -83,8 +97,10 @@ func (rc *ResponseCapturer) StartMonitoring() {
 	// Panic recovery to prevent monitoring goroutine crashes
 	defer func() {
 		if rec := recover(); rec != nil {
+			rc.mu.Lock()
 			rc.errorMsg = "MONITORING_PANIC"
 			rc.isComplete = false
+			rc.mu.Unlock()
 			rc.finalize()
 		}
 	}()
@@ -96,28 +112,55 @@ func (rc *ResponseCapturer) StartMonitoring() {
 	// Wait for context cancellation (client disconnect or timeout)
 	<-rc.ctx.Done()
 
+	// Stream already finalized normally; the context was cancelled during cleanup
+	if rc.completed.Load() {
+		return
+	}
+
 	// Determine the reason for context cancellation
-	switch rc.ctx.Err() {
+	rc.recordContextError()
+
+	// Finalize the response
+	rc.finalize()
+}
+
+// recordContextError marks the response incomplete with the reason the context ended
+// Uses the cancellation cause so callers can signal timeouts via context.WithCancelCause
+func (rc *ResponseCapturer) recordContextError() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	switch cause := context.Cause(rc.ctx); cause {
+	case nil:
+		return
 	case context.DeadlineExceeded:
 		rc.errorMsg = "STREAM_TIMEOUT"
-		rc.isComplete = false
 	case context.Canceled:
 		rc.errorMsg = "CLIENT_DISCONNECT"
-		rc.isComplete = false
 	default:
 		// Unknown context error
-		if rc.ctx.Err() != nil {
-			rc.errorMsg = "CONTEXT_ERROR: " + rc.ctx.Err().Error()
-			rc.isComplete = false
-		}
+		rc.errorMsg = "CONTEXT_ERROR: " + cause.Error()
 	}
+	rc.isComplete = false
+}
 
-	// Finalize the response
-	rc.finalize()
+// EnableStreaming switches a regular capturer into streaming mode
+// Used when the upstream answers with an SSE body although the request gave no hint
+// ctx: context whose cancellation marks the stream as interrupted
+// maxSize: maximum body size to capture (bytes), -1 for unlimited
+func (rc *ResponseCapturer) EnableStreaming(ctx context.Context, maxSize int64) {
+	rc.ctx = ctx
+	rc.maxSize = maxSize
+}
+
+// IsStreaming returns whether the capturer is operating in streaming mode
+func (rc *ResponseCapturer) IsStreaming() bool {
+	return rc.ctx != nil
 }
 
 // WriteHeader captures the status code and headers
 func (rc *ResponseCapturer) WriteHeader(statusCode int) {
+	rc.mu.Lock()
 	rc.statusCode = statusCode
 
 	// Capture headers
@@ -125,6 +168,11 @@ func (rc *ResponseCapturer) WriteHeader(statusCode int) {
 		rc.headers[k] = v
 	}
 
+	// Event boundaries can only be observed on the wire when the body is not compressed
+	rc.trackEvents = isEventStream(rc.headers) && rc.headers.Get("Content-Encoding") == ""
+	rc.lineEmpty = true
+	rc.mu.Unlock()
+
 	// Forward to original writer
 	rc.ResponseWriter.WriteHeader(statusCode)
 }
@@ -137,14 +185,24 @@ func (rc *ResponseCapturer) Write(data []byte) (int, error) {
 
 	// Track write errors
 	if err != nil {
+		rc.mu.Lock()
 		rc.writeErr = err
 		rc.isComplete = false
 		rc.errorMsg = "WRITE_ERROR: " + err.Error()
+		rc.mu.Unlock()
 		// Finalize on error
 		rc.finalize()
 		return n, err
 	}
 
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	// Record arrival times of SSE events as they pass through
+	if rc.trackEvents {
+		rc.recordEventTimes(data)
+	}
+
 	// Capture the data if we haven't exceeded the buffer limit
 	if rc.maxSize < 0 || rc.currentSize < rc.maxSize {
 		// Calculate how much we can still capture
@@ -171,6 +229,30 @@ func (rc *ResponseCapturer) Write(data []byte) (int, error) {
 	return n, nil
 }
 
+// recordEventTimes stamps every SSE event that completes within data
+// An event completes at the first blank line following a non-blank line; the state
+// carries across writes so events split over several network reads are handled
+// The caller must hold rc.mu
+func (rc *ResponseCapturer) recordEventTimes(data []byte) {
+	now := time.Now()
+
+	for _, b := range data {
+		switch b {
+		case '\r':
+			continue
+		case '\n':
+			if rc.lineEmpty && rc.eventOpen {
+				rc.eventTimes = append(rc.eventTimes, now)
+				rc.eventOpen = false
+			}
+			rc.lineEmpty = true
+		default:
+			rc.lineEmpty = false
+			rc.eventOpen = true
+		}
+	}
+}
+
 // Flush implements http.Flusher for streaming support
 // Required for Server-Sent Events (SSE)
 func (rc *ResponseCapturer) Flush() {
@@ -179,6 +261,12 @@ func (rc *ResponseCapturer) Flush() {
 	}
 }
 
+// Hijack implements http.Hijacker so upgraded connections (WebSocket) can be taken over
+// The switched-protocol traffic bypasses the capturer
+func (rc *ResponseCapturer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rc.ResponseWriter).Hijack()
+}
+
 // finalize calls the completion callback exactly once
 func (rc *ResponseCapturer) finalize() {
 	// Use atomic CAS to ensure callback is called exactly once
@@ -191,18 +279,28 @@ func (rc *ResponseCapturer) finalize() {
 
 // Complete signals that the response is complete and triggers finalization
 // Can be called multiple times safely (callback invoked only once)
+// If the streaming context already ended, the interruption is recorded first so a
+// completion racing the monitoring goroutine never reports a cut-off stream as complete
 func (rc *ResponseCapturer) Complete() {
+	if rc.ctx != nil && rc.ctx.Err() != nil && !rc.completed.Load() {
+		rc.recordContextError()
+	}
 	rc.finalize()
 }
 
 // StatusCode returns the captured status code
 func (rc *ResponseCapturer) StatusCode() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
 	return rc.statusCode
 }
 
 // Body returns the captured response body
 // If truncated, appends a truncation marker
 func (rc *ResponseCapturer) Body() string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
 	body := rc.body.String()
 	if rc.truncated {
 		body += "\n[TRUNCATED: response exceeded max_audit_body_size limit]"
@@ -213,10 +311,14 @@ func (rc *ResponseCapturer) Body() string {
 // DecompressedBody returns the response body, decompressing it if Content-Encoding is gzip
 // Returns the original body if not gzipped or if decompression fails
 func (rc *ResponseCapturer) DecompressedBody() string {
-	body := rc.Body()
+	return decompressBody(rc.Body(), rc.Headers())
+}
 
+// decompressBody returns body decompressed if headers declare gzip Content-Encoding
+// Returns body unchanged if it is not gzipped or decompression fails
+func decompressBody(body string, headers http.Header) string {
 	// Check if the response is gzipped
-	contentEncoding := rc.headers.Get("Content-Encoding")
+	contentEncoding := headers.Get("Content-Encoding")
 	if !strings.Contains(strings.ToLower(contentEncoding), "gzip") {
 		// Not gzipped, return as-is
 		return body
@@ -245,29 +347,47 @@ func (rc *ResponseCapturer) DecompressedBody() string {
 	return string(decompressed)
 }
 
-// Headers returns the captured headers
+// EventTimes returns the arrival time of each complete SSE event, in stream order
+// Empty for non-SSE or compressed responses
+func (rc *ResponseCapturer) EventTimes() []time.Time {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]time.Time(nil), rc.eventTimes...)
+}
+
+// Headers returns a copy of the captured headers
 func (rc *ResponseCapturer) Headers() http.Header {
-	return rc.headers
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.headers.Clone()
 }
 
 // Error returns the error message if the response was incomplete
 // Empty string indicates no error
 func (rc *ResponseCapturer) Error() string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
 	return rc.errorMsg
 }
 
 // IsComplete returns whether the response body is complete
 func (rc *ResponseCapturer) IsComplete() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
 	return rc.isComplete
 }
 
 // IsTruncated returns whether the response body was truncated
 func (rc *ResponseCapturer) IsTruncated() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
 	return rc.truncated
 }
 
 // TruncatedAtBytes returns the original size before truncation
 // Only meaningful when IsTruncated() returns true
 func (rc *ResponseCapturer) TruncatedAtBytes() int64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
 	return rc.currentSize
 }
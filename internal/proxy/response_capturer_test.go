@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -192,9 +193,9 @@ func TestCompletionCallback(t *testing.T) {
 
 	capturer := NewStreamingResponseCapturer(w, ctx, 1024)
 
-	callCount := 0
+	var callCount atomic.Int32
 	capturer.SetCompletionCallback(func() {
-		callCount++
+		callCount.Add(1)
 	})
 
 	// Start monitoring
@@ -209,16 +210,16 @@ func TestCompletionCallback(t *testing.T) {
 	// Wait for callback
 	time.Sleep(50 * time.Millisecond)
 
-	if callCount != 1 {
-		t.Errorf("Expected callback to be called exactly once, called %d times", callCount)
+	if n := callCount.Load(); n != 1 {
+		t.Errorf("Expected callback to be called exactly once, called %d times", n)
 	}
 
 	// Try to finalize again - should not call callback again
 	capturer.finalize()
 	capturer.finalize()
 
-	if callCount != 1 {
-		t.Errorf("Expected callback to still be called only once, called %d times", callCount)
+	if n := callCount.Load(); n != 1 {
+		t.Errorf("Expected callback to still be called only once, called %d times", n)
 	}
 }
 
@@ -229,9 +230,9 @@ func TestContextCancellationDetection(t *testing.T) {
 
 	capturer := NewStreamingResponseCapturer(w, ctx, 1024)
 
-	callbackCalled := false
+	var callbackCalled atomic.Bool
 	capturer.SetCompletionCallback(func() {
-		callbackCalled = true
+		callbackCalled.Store(true)
 	})
 
 	// Start monitoring
@@ -243,7 +244,7 @@ func TestContextCancellationDetection(t *testing.T) {
 	// Wait for callback
 	time.Sleep(50 * time.Millisecond)
 
-	if !callbackCalled {
+	if !callbackCalled.Load() {
 		t.Error("Callback should be called on context cancellation")
 	}
 
@@ -264,9 +265,9 @@ func TestTimeoutDetection(t *testing.T) {
 
 	capturer := NewStreamingResponseCapturer(w, ctx, 1024)
 
-	callbackCalled := false
+	var callbackCalled atomic.Bool
 	capturer.SetCompletionCallback(func() {
-		callbackCalled = true
+		callbackCalled.Store(true)
 	})
 
 	// Start monitoring
@@ -275,7 +276,7 @@ func TestTimeoutDetection(t *testing.T) {
 	// Wait for timeout
 	time.Sleep(100 * time.Millisecond)
 
-	if !callbackCalled {
+	if !callbackCalled.Load() {
 		t.Error("Callback should be called on timeout")
 	}
 
@@ -296,9 +297,9 @@ func TestWriteErrorDetection(t *testing.T) {
 
 	capturer := NewStreamingResponseCapturer(w, ctx, 1024)
 
-	callbackCalled := false
+	var callbackCalled atomic.Bool
 	capturer.SetCompletionCallback(func() {
-		callbackCalled = true
+		callbackCalled.Store(true)
 	})
 
 	// Try to write - should trigger error
@@ -308,7 +309,7 @@ func TestWriteErrorDetection(t *testing.T) {
 		t.Fatal("Expected write error")
 	}
 
-	if !callbackCalled {
+	if !callbackCalled.Load() {
 		t.Error("Callback should be called on write error")
 	}
 
@@ -358,3 +359,47 @@ func (w *errorWriter) Write([]byte) (int, error) {
 func (w *errorWriter) WriteHeader(statusCode int) {
 	// No-op
 }
+
+// TestEventTimesRecorded verifies SSE event arrival times are recorded as data is written
+func TestEventTimesRecorded(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "text/event-stream")
+	capturer := NewResponseCapturer(w)
+	capturer.WriteHeader(http.StatusOK)
+
+	// Event split across writes, then two events in a single write
+	capturer.Write([]byte("data: {\"a\":"))
+	capturer.Write([]byte("1}\n\n"))
+	time.Sleep(5 * time.Millisecond)
+	capturer.Write([]byte("data: {\"b\":2}\r\n\r\ndata: [DONE]\n\n"))
+
+	times := capturer.EventTimes()
+	if len(times) != 3 {
+		t.Fatalf("Expected 3 event times, got %d", len(times))
+	}
+
+	if !times[1].After(times[0]) {
+		t.Error("Second event should arrive after the first")
+	}
+
+	chunks := parseSSEEvents(capturer.Body(), times)
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, got %d", len(chunks))
+	}
+	if !chunks[0].timestamp.Equal(times[0]) || !chunks[1].timestamp.Equal(times[1]) {
+		t.Error("Chunks should be stamped with the arrival time of their event")
+	}
+}
+
+// TestEventTimesNotRecordedForJSON verifies non-SSE responses are not timed
+func TestEventTimesNotRecordedForJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/json")
+	capturer := NewResponseCapturer(w)
+	capturer.WriteHeader(http.StatusOK)
+	capturer.Write([]byte("{\"a\":1}\n\n"))
+
+	if len(capturer.EventTimes()) != 0 {
+		t.Error("Event times should only be recorded for SSE responses")
+	}
+}
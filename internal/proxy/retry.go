@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+// Retry defaults used when the endpoint config leaves them unset
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+	defaultMaxRetryAfter  = 30 * time.Second
+)
+
+// defaultRetryOn are statuses that tell the client the request was not processed
+var defaultRetryOn = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable}
+
+// retryPolicy decides whether and when a failed upstream attempt is retried
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxRetryAfter  time.Duration
+	retryOn        []int
+}
+
+// newRetryPolicy applies the defaults to an endpoint's retry config
+func newRetryPolicy(cfg config.RetryConfig) retryPolicy {
+	p := retryPolicy{
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		maxRetryAfter:  defaultMaxRetryAfter,
+		retryOn:        cfg.RetryOn,
+	}
+	if cfg.InitialBackoffMs > 0 {
+		p.initialBackoff = time.Duration(cfg.InitialBackoffMs) * time.Millisecond
+	}
+	if cfg.MaxBackoffMs > 0 {
+		p.maxBackoff = time.Duration(cfg.MaxBackoffMs) * time.Millisecond
+	}
+	if cfg.MaxRetryAfter > 0 {
+		p.maxRetryAfter = time.Duration(cfg.MaxRetryAfter) * time.Second
+	}
+	if len(p.retryOn) == 0 {
+		p.retryOn = defaultRetryOn
+	}
+	return p
+}
+
+// enabled reports whether retries are configured
+func (p retryPolicy) enabled() bool {
+	return p.maxAttempts > 1
+}
+
+// allows reports whether another attempt may follow the given attempt number
+// Without retries configured, failover alone is bounded by the number of targets
+func (p retryPolicy) allows(attempt int) bool {
+	return !p.enabled() || attempt < p.maxAttempts
+}
+
+// retryableStatus reports whether a response status is retried
+func (p retryPolicy) retryableStatus(status int) bool {
+	return p.enabled() && slices.Contains(p.retryOn, status)
+}
+
+// retryableError reports whether a transport error is safe to retry
+func (p retryPolicy) retryableError(r *http.Request, err error) bool {
+	return p.enabled() && safeToResend(r, err)
+}
+
+// safeToResend reports whether a request that failed with a transport error may be sent again,
+// to the same or another upstream
+// Connection failures before the request was sent are always safe; other errors may occur
+// after the upstream started acting on the request, so they are only safe for idempotent requests
+func safeToResend(r *http.Request, err error) bool {
+	if r.Context().Err() != nil {
+		return false
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	return isIdempotent(r)
+}
+
+// backoff returns the jittered delay before the given retry (1-based)
+// The delay doubles with every retry up to maxBackoff and is drawn between half and the full value
+func (p retryPolicy) backoff(retry int) time.Duration {
+	d := p.initialBackoff
+	for i := 1; i < retry && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.maxBackoff)
+	if half := int64(d / 2); half > 0 {
+		d = time.Duration(half + rand.Int63n(half+1))
+	}
+	return d
+}
+
+// isIdempotent reports whether resending the request cannot repeat a side effect
+func isIdempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.Header.Get("Idempotency-Key") != ""
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+// Returns false if the header is absent or malformed
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,317 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/audit"
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+	"github.com/jnd-labs/aiblackbox/internal/trace"
+)
+
+// newRetryHandler creates a handler for a single target with retries enabled
+func newRetryHandler(t *testing.T, target string, retry config.RetryConfig) (*Handler, *mockAuditStorage) {
+	t.Helper()
+
+	cfg := createTestConfig(target)
+	cfg.Endpoints[0].Retry = retry
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	t.Cleanup(worker.Shutdown)
+
+	handler := NewHandler(cfg, worker)
+	t.Cleanup(handler.Shutdown)
+	return handler, storage
+}
+
+// TestHandlerRetriesTransientStatus verifies transient statuses are retried and every attempt is traced
+func TestHandlerRetriesTransientStatus(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message": "success"}`))
+	}))
+	defer upstream.Close()
+
+	handler, storage := newRetryHandler(t, upstream.URL, config.RetryConfig{MaxAttempts: 3, InitialBackoffMs: 10})
+
+	req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{"model":"gpt-4"}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 after retries, got %d", w.Code)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 upstream calls, got %d", calls)
+	}
+
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
+	}
+	entry := storage.Entries()[0]
+
+	outcomes := []models.AttemptOutcome{models.AttemptRetried, models.AttemptRetried, models.AttemptServed}
+	if len(entry.Upstream.Attempts) != len(outcomes) {
+		t.Fatalf("Expected %d attempts, got %d", len(outcomes), len(entry.Upstream.Attempts))
+	}
+	if len(entry.Trace.Attempts) != len(outcomes) {
+		t.Fatalf("Expected %d attempt spans, got %d", len(outcomes), len(entry.Trace.Attempts))
+	}
+
+	for i, want := range outcomes {
+		attempt := entry.Upstream.Attempts[i]
+		span := entry.Trace.Attempts[i]
+		if attempt.Outcome != want || span.Outcome != want {
+			t.Errorf("Attempt %d: expected outcome %s, got %s/%s", i+1, want, attempt.Outcome, span.Outcome)
+		}
+		expectedSpanID := trace.AttemptSpanID(entry.Trace.SpanID, i+1)
+		if attempt.SpanID != expectedSpanID || span.SpanID != expectedSpanID {
+			t.Errorf("Attempt %d: expected span %s, got %s/%s", i+1, expectedSpanID, attempt.SpanID, span.SpanID)
+		}
+		if span.Attempt != i+1 {
+			t.Errorf("Expected attempt number %d, got %d", i+1, span.Attempt)
+		}
+	}
+	if entry.Upstream.Attempts[1].BackoffMs < 5 {
+		t.Error("Retried attempts should record their backoff")
+	}
+	if entry.Trace.Attributes["upstream_attempts"] != "3" {
+		t.Errorf("Expected upstream_attempts attribute 3, got %q", entry.Trace.Attributes["upstream_attempts"])
+	}
+}
+
+// TestHandlerSingleAttemptHasNoSpans verifies requests served at once carry no attempt spans
+func TestHandlerSingleAttemptHasNoSpans(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	handler, storage := newRetryHandler(t, upstream.URL, config.RetryConfig{MaxAttempts: 3})
+
+	req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	time.Sleep(100 * time.Millisecond)
+
+	entry := storage.Entries()[0]
+	if len(entry.Trace.Attempts) != 0 {
+		t.Errorf("Expected no attempt spans, got %d", len(entry.Trace.Attempts))
+	}
+	if entry.Upstream.Attempts[0].Outcome != models.AttemptServed || entry.Upstream.Attempts[0].SpanID != "" {
+		t.Errorf("Unexpected attempt: %+v", entry.Upstream.Attempts[0])
+	}
+}
+
+// TestHandlerRetryStopsAtMaxAttempts verifies the last attempt's response is served
+func TestHandlerRetryStopsAtMaxAttempts(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	handler, _ := newRetryHandler(t, upstream.URL, config.RetryConfig{MaxAttempts: 2, InitialBackoffMs: 1})
+
+	req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected the final 502, got %d", w.Code)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 upstream calls, got %d", calls)
+	}
+}
+
+// TestHandlerRetryOnlyListedStatuses verifies statuses outside retry_on are served as is
+func TestHandlerRetryOnlyListedStatuses(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	handler, _ := newRetryHandler(t, upstream.URL, config.RetryConfig{MaxAttempts: 3, InitialBackoffMs: 1})
+
+	req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError || calls != 1 {
+		t.Errorf("Expected a single 500, got %d after %d calls", w.Code, calls)
+	}
+}
+
+// TestHandlerRetryHonoursRetryAfter verifies Retry-After delays the retry or, if too long, is passed to the client
+func TestHandlerRetryHonoursRetryAfter(t *testing.T) {
+	t.Run("waits", func(t *testing.T) {
+		var calls int32
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer upstream.Close()
+
+		handler, _ := newRetryHandler(t, upstream.URL, config.RetryConfig{MaxAttempts: 2, InitialBackoffMs: 1})
+
+		start := time.Now()
+		req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 after retry, got %d", w.Code)
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("Retry should wait for Retry-After, took %s", elapsed)
+		}
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		var calls int32
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer upstream.Close()
+
+		handler, _ := newRetryHandler(t, upstream.URL, config.RetryConfig{MaxAttempts: 3, MaxRetryAfter: 10})
+
+		req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusTooManyRequests || calls != 1 {
+			t.Errorf("Expected the 429 to be passed through, got %d after %d calls", w.Code, calls)
+		}
+		if w.Header().Get("Retry-After") != "120" {
+			t.Errorf("Retry-After should reach the client, got %q", w.Header().Get("Retry-After"))
+		}
+	})
+}
+
+// TestHandlerNoRetryAfterStreamingBegins verifies a stream failing midway is not retried
+func TestHandlerNoRetryAfterStreamingBegins(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+
+		// Drop the connection in the middle of the stream
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer upstream.Close()
+
+	handler, _ := newRetryHandler(t, upstream.URL, config.RetryConfig{MaxAttempts: 3, InitialBackoffMs: 1})
+
+	req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{"stream": true}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if calls != 1 {
+		t.Errorf("A stream that has begun must not be retried, got %d calls", calls)
+	}
+	if !strings.Contains(w.Body.String(), "Hel") {
+		t.Errorf("Expected the partial stream to reach the client, got %q", w.Body.String())
+	}
+}
+
+// TestRetryPolicyBackoff verifies exponential backoff with jitter and the cap
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := newRetryPolicy(config.RetryConfig{MaxAttempts: 5, InitialBackoffMs: 100, MaxBackoffMs: 300})
+
+	tests := []struct {
+		retry int
+		base  time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 300 * time.Millisecond},
+		{10, 300 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			d := p.backoff(tt.retry)
+			if d < tt.base/2 || d > tt.base {
+				t.Errorf("Retry %d: backoff %s outside [%s, %s]", tt.retry, d, tt.base/2, tt.base)
+			}
+		}
+	}
+}
+
+// TestRetryPolicyErrors verifies only idempotency-safe transport errors are retried
+func TestRetryPolicyErrors(t *testing.T) {
+	p := newRetryPolicy(config.RetryConfig{MaxAttempts: 2})
+
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	resetErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+	post := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	keyed := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	keyed.Header.Set("Idempotency-Key", "abc")
+	get := httptest.NewRequest("GET", "/v1/models", nil)
+
+	if !p.retryableError(post, dialErr) {
+		t.Error("Dial errors should be retried for any method")
+	}
+	if p.retryableError(post, resetErr) {
+		t.Error("Errors after sending a POST should not be retried")
+	}
+	if !p.retryableError(keyed, resetErr) {
+		t.Error("Requests with an Idempotency-Key should be retried")
+	}
+	if !p.retryableError(get, resetErr) {
+		t.Error("Idempotent methods should be retried")
+	}
+
+	disabled := newRetryPolicy(config.RetryConfig{})
+	if disabled.retryableError(get, dialErr) || disabled.retryableStatus(http.StatusServiceUnavailable) {
+		t.Error("Nothing should be retried with retries disabled")
+	}
+}
+
+// TestParseRetryAfter verifies both Retry-After formats
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if d, ok := parseRetryAfter("7", now); !ok || d != 7*time.Second {
+		t.Errorf("Expected 7s, got %s (%v)", d, ok)
+	}
+	if d, ok := parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now); !ok || d != 90*time.Second {
+		t.Errorf("Expected 90s, got %s (%v)", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Error("Malformed Retry-After should be rejected")
+	}
+	if _, ok := parseRetryAfter("", now); ok {
+		t.Error("Empty Retry-After should be rejected")
+	}
+}
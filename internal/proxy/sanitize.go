@@ -0,0 +1,295 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/secrets"
+)
+
+// sensitiveHeaders lists headers that should be masked in audit logs
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+	"api-key":             true,
+	"x-auth-token":        true,
+	"x-csrf-token":        true,
+	"proxy-authorization": true,
+}
+
+// sensitiveQueryParams lists query parameters that carry credentials and should be masked in audit logs
+var sensitiveQueryParams = config.SensitiveQueryParams
+
+// urlHeaders hold URLs whose query strings are sanitized like the request's own
+var urlHeaders = map[string]bool{
+	"referer":          true,
+	"location":         true,
+	"content-location": true,
+}
+
+// defaultKeepLast is the number of characters kept by the keep_last strategy unless configured
+const defaultKeepLast = 4
+
+// defaultSanitizer applies the built-in rules; used when a handler has no configured sanitizer
+var defaultSanitizer = &sanitizer{rules: []sanitizeRule{builtinSanitizeRule}}
+
+// builtinSanitizeRule masks the well-known credential headers and query parameters
+var builtinSanitizeRule = sanitizeRule{
+	headers:     sensitiveHeaders,
+	queryParams: sensitiveQueryParams,
+	strategy:    config.SanitizeMask,
+}
+
+// sanitizer hides credentials in headers and query strings before they are audited
+type sanitizer struct {
+	allowlist bool
+	allowed   map[string]bool
+
+	// rules are checked in order; the built-in rule comes last
+	rules   []sanitizeRule
+	hmacKey []byte
+}
+
+// sanitizeRule is a compiled config.SanitizationRule; names are lower-case
+type sanitizeRule struct {
+	headers       map[string]bool
+	headerPattern *regexp.Regexp
+	queryParams   map[string]bool
+	queryPattern  *regexp.Regexp
+	strategy      string
+	keepLast      int
+}
+
+// newSanitizer compiles the sanitization rules and resolves the HMAC key
+func newSanitizer(cfg config.SanitizationConfig, store *secrets.Store) (*sanitizer, error) {
+	s := &sanitizer{
+		allowlist: cfg.HeaderMode == config.HeaderModeAllowlist,
+		allowed:   lowerSet(cfg.AllowedHeaders),
+	}
+
+	for _, r := range cfg.Rules {
+		rule := sanitizeRule{
+			headers:     lowerSet(r.Headers),
+			queryParams: lowerSet(r.QueryParams),
+			strategy:    r.Strategy,
+			keepLast:    r.KeepLast,
+		}
+		if rule.strategy == "" {
+			rule.strategy = config.SanitizeMask
+		}
+		if rule.keepLast == 0 {
+			rule.keepLast = defaultKeepLast
+		}
+		var err error
+		if rule.headerPattern, err = compileNamePattern(r.HeaderPattern); err != nil {
+			return nil, err
+		}
+		if rule.queryPattern, err = compileNamePattern(r.QueryPattern); err != nil {
+			return nil, err
+		}
+		s.rules = append(s.rules, rule)
+	}
+	s.rules = append(s.rules, builtinSanitizeRule)
+
+	if cfg.HMACKey != "" {
+		key, err := store.Expand(cfg.HMACKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve sanitization.hmac_key: %w", err)
+		}
+		s.hmacKey = []byte(key)
+	}
+
+	return s, nil
+}
+
+// compileNamePattern compiles a case-insensitive name pattern; empty patterns match nothing
+func compileNamePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sanitization pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// lowerSet returns the lower-cased names as a set
+func lowerSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return set
+}
+
+// headerRule returns the first rule matching the header name, or nil
+func (s *sanitizer) headerRule(name string) *sanitizeRule {
+	lower := strings.ToLower(name)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if rule.headers[lower] || (rule.headerPattern != nil && rule.headerPattern.MatchString(lower)) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// queryRule returns the first rule matching the query parameter name, or nil
+func (s *sanitizer) queryRule(name string) *sanitizeRule {
+	lower := strings.ToLower(name)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if rule.queryParams[lower] || (rule.queryPattern != nil && rule.queryPattern.MatchString(lower)) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// headers returns a sanitized copy of headers
+// In allowlist mode headers that are not allowed are left out
+func (s *sanitizer) headers(headers map[string][]string) map[string][]string {
+	sanitized := make(map[string][]string, len(headers))
+	for k, values := range headers {
+		lowerKey := strings.ToLower(k)
+		if s.allowlist && !s.allowed[lowerKey] {
+			continue
+		}
+
+		rule := s.headerRule(k)
+		switch {
+		case rule != nil && rule.strategy == config.SanitizeDrop:
+			continue
+		case rule != nil:
+			// Hide sensitive values but preserve structure
+			masked := make([]string, len(values))
+			for i, v := range values {
+				masked[i] = s.hide(rule, v)
+			}
+			sanitized[k] = masked
+		case urlHeaders[lowerKey]:
+			urls := make([]string, len(values))
+			for i, v := range values {
+				urls[i] = s.url(v)
+			}
+			sanitized[k] = urls
+		default:
+			// Copy non-sensitive headers as-is
+			sanitized[k] = append([]string(nil), values...)
+		}
+	}
+	return sanitized
+}
+
+// query returns the raw query string with sensitive parameter values hidden
+// Parameter order and encoding are preserved; dropped parameters are removed
+func (s *sanitizer) query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		rawName, value, hasValue := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+
+		rule := s.queryRule(name)
+		switch {
+		case rule == nil || !hasValue:
+			kept = append(kept, param)
+		case rule.strategy == config.SanitizeDrop:
+			continue
+		default:
+			kept = append(kept, rawName+"="+s.hide(rule, value))
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// url returns rawURL with its query string sanitized
+func (s *sanitizer) url(rawURL string) string {
+	base, rest, found := strings.Cut(rawURL, "?")
+	if !found {
+		return rawURL
+	}
+	rawQuery, fragment, hasFragment := strings.Cut(rest, "#")
+
+	sanitized := base
+	if query := s.query(rawQuery); query != "" {
+		sanitized += "?" + query
+	}
+	if hasFragment {
+		sanitized += "#" + fragment
+	}
+	return sanitized
+}
+
+// hide applies the rule's strategy to a sensitive value
+// A "Bearer " prefix is kept so the credential type stays visible
+func (s *sanitizer) hide(rule *sanitizeRule, value string) string {
+	if rule.strategy == config.SanitizeMask {
+		return maskSensitiveValue(value)
+	}
+	if len(value) == 0 {
+		return "[EMPTY]"
+	}
+
+	prefix := ""
+	if strings.HasPrefix(value, "Bearer ") || strings.HasPrefix(value, "bearer ") {
+		prefix, value = "Bearer ", value[7:]
+	}
+
+	switch rule.strategy {
+	case config.SanitizeHMAC:
+		mac := hmac.New(sha256.New, s.hmacKey)
+		mac.Write([]byte(value))
+		return prefix + "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+	case config.SanitizeKeepLast:
+		// Keep at most half of the value
+		if len(value) <= 2*rule.keepLast {
+			return prefix + "[REDACTED]"
+		}
+		return prefix + "..." + value[len(value)-rule.keepLast:]
+	default:
+		return prefix + "[REDACTED]"
+	}
+}
+
+// maskSensitiveValue masks a sensitive header value
+// Shows prefix and last 4 characters for debugging while hiding the secret
+func maskSensitiveValue(value string) string {
+	if len(value) == 0 {
+		return "[EMPTY]"
+	}
+
+	// For Bearer tokens, mask the token but keep the "Bearer" prefix
+	if strings.HasPrefix(value, "Bearer ") || strings.HasPrefix(value, "bearer ") {
+		token := value[7:] // Remove "Bearer " prefix
+		if len(token) <= 8 {
+			return "Bearer [REDACTED]"
+		}
+		// Show prefix and last 4 chars: "Bearer sk-...abc123"
+		return fmt.Sprintf("Bearer %s...%s", token[:3], token[len(token)-4:])
+	}
+
+	// For other sensitive values, show only length
+	if len(value) <= 8 {
+		return "[REDACTED]"
+	}
+
+	// Show first 3 and last 4 characters
+	return fmt.Sprintf("%s...%s", value[:3], value[len(value)-4:])
+}
@@ -1,26 +1,47 @@
 package proxy
 
 import (
+	"bytes"
 	"encoding/json"
 	"log"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/jnd-labs/aiblackbox/internal/models"
 )
 
+// defaultStallThreshold is the gap between token-bearing chunks reported as a stall
+// when no threshold is configured
+const defaultStallThreshold = 2 * time.Second
+
 // reconstructStreamResponse converts SSE stream format into a consolidated response
 // Parses OpenAI streaming format and rebuilds the complete response
 func reconstructStreamResponse(sseBody string, startTime time.Time) (string, *models.StreamingMetadata) {
+	return reconstructTimedStreamResponse(sseBody, startTime, nil, defaultStallThreshold)
+}
+
+// ReconstructStream rebuilds the consolidated response body from a raw SSE transcript
+// Returns false if the transcript could not be reconstructed
+// Used by cmd/verify to check stored bodies against preserved raw streams
+func ReconstructStream(raw string) (string, bool) {
+	reconstructed, metadata := reconstructStreamResponse(raw, time.Now())
+	return reconstructed, metadata != nil
+}
+
+// reconstructTimedStreamResponse is reconstructStreamResponse with real per-event arrival times
+// eventTimes[i] is when the i-th SSE event finished arriving (see ResponseCapturer.EventTimes)
+// Latency metrics are only computed when arrival times are available
+func reconstructTimedStreamResponse(sseBody string, startTime time.Time, eventTimes []time.Time, stallThreshold time.Duration) (string, *models.StreamingMetadata) {
 	// Parse SSE stream into chunks
-	chunks := parseSSEChunks(sseBody)
+	chunks := parseSSEEvents(sseBody, eventTimes)
 	if len(chunks) == 0 {
 		// Not SSE format or empty, return as-is
 		return sseBody, nil
 	}
 
 	// Reconstruct the final response from deltas
-	reconstructed, metadata := reconstructOpenAIStream(chunks, startTime)
+	reconstructed, metadata := reconstructOpenAIStream(chunks, startTime, stallThreshold)
 	if reconstructed == "" {
 		// Reconstruction failed, return original
 		return sseBody, nil
@@ -30,21 +51,43 @@ func reconstructStreamResponse(sseBody string, startTime time.Time) (string, *mo
 }
 
 // sseChunk represents a parsed SSE data chunk
+// timestamp is the arrival time of the event, zero when unknown
 type sseChunk struct {
 	data      map[string]interface{}
+	raw       []byte
 	timestamp time.Time
 }
 
 // parseSSEChunks parses SSE format into structured chunks
 func parseSSEChunks(body string) []sseChunk {
+	return parseSSEEvents(body, nil)
+}
+
+// parseSSEEvents parses SSE format into structured chunks, stamping each chunk with the
+// arrival time of the event it belongs to. Events are delimited by blank lines, counted
+// the same way ResponseCapturer counts them while the stream is being written
+func parseSSEEvents(body string, eventTimes []time.Time) []sseChunk {
 	var chunks []sseChunk
 	lines := strings.Split(body, "\n")
 
+	eventIndex := 0
+	eventOpen := false
+
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 
-		// Skip empty lines and [DONE] marker
-		if line == "" || line == "data: [DONE]" {
+		// Blank line terminates the current event
+		if line == "" {
+			if eventOpen {
+				eventIndex++
+				eventOpen = false
+			}
+			continue
+		}
+		eventOpen = true
+
+		// Skip [DONE] marker
+		if line == "data: [DONE]" {
 			continue
 		}
 
@@ -58,9 +101,15 @@ func parseSSEChunks(body string) []sseChunk {
 				continue
 			}
 
+			var timestamp time.Time
+			if eventIndex < len(eventTimes) {
+				timestamp = eventTimes[eventIndex]
+			}
+
 			chunks = append(chunks, sseChunk{
 				data:      data,
-				timestamp: time.Now(), // Approximate timing
+				raw:       []byte(jsonData),
+				timestamp: timestamp,
 			})
 		}
 	}
@@ -68,129 +117,389 @@ func parseSSEChunks(body string) []sseChunk {
 	return chunks
 }
 
-// reconstructOpenAIStream rebuilds OpenAI streaming response from deltas
-func reconstructOpenAIStream(chunks []sseChunk, startTime time.Time) (string, *models.StreamingMetadata) {
-	if len(chunks) == 0 {
-		return "", nil
+// openAIStreamChunk is the wire format of a single chat.completion.chunk event
+type openAIStreamChunk struct {
+	ID                string              `json:"id"`
+	Object            string              `json:"object"`
+	Created           int64               `json:"created"`
+	Model             string              `json:"model"`
+	ServiceTier       string              `json:"service_tier"`
+	SystemFingerprint string              `json:"system_fingerprint"`
+	Choices           []openAIChunkChoice `json:"choices"`
+	Usage             json.RawMessage     `json:"usage"`
+}
+
+// openAIChunkChoice is a single choice delta within a stream chunk
+type openAIChunkChoice struct {
+	Index        int               `json:"index"`
+	Delta        openAIChunkDelta  `json:"delta"`
+	Logprobs     *openAIChunkProbs `json:"logprobs"`
+	FinishReason *string           `json:"finish_reason"`
+}
+
+// openAIChunkDelta holds the incremental message fields of a choice
+type openAIChunkDelta struct {
+	Role         string                `json:"role"`
+	Content      *string               `json:"content"`
+	Refusal      *string               `json:"refusal"`
+	ToolCalls    []openAIToolCallDelta `json:"tool_calls"`
+	FunctionCall *openAIFunctionDelta  `json:"function_call"`
+}
+
+// openAIToolCallDelta is a fragment of a tool call, keyed by its index in the tool_calls array
+type openAIToolCallDelta struct {
+	Index    int                 `json:"index"`
+	ID       string              `json:"id"`
+	Type     string              `json:"type"`
+	Function openAIFunctionDelta `json:"function"`
+}
+
+// openAIFunctionDelta is a fragment of a function name and its JSON arguments
+type openAIFunctionDelta struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// openAIChunkProbs carries the log probabilities for the tokens in a single delta
+type openAIChunkProbs struct {
+	Content []json.RawMessage `json:"content"`
+	Refusal []json.RawMessage `json:"refusal"`
+}
+
+// reconstructedCompletion mirrors the non-streaming chat.completion response
+// Field order matches the upstream API so reconstructed bodies read like regular responses
+type reconstructedCompletion struct {
+	ID                string                `json:"id,omitempty"`
+	Object            string                `json:"object,omitempty"`
+	Created           int64                 `json:"created,omitempty"`
+	Model             string                `json:"model,omitempty"`
+	Choices           []reconstructedChoice `json:"choices"`
+	Usage             json.RawMessage       `json:"usage,omitempty"`
+	ServiceTier       string                `json:"service_tier,omitempty"`
+	SystemFingerprint string                `json:"system_fingerprint,omitempty"`
+}
+
+// reconstructedChoice mirrors a single choice of a non-streaming response
+type reconstructedChoice struct {
+	Index        int                  `json:"index"`
+	Message      reconstructedMessage `json:"message"`
+	Logprobs     *openAIChunkProbs    `json:"logprobs"`
+	FinishReason *string              `json:"finish_reason"`
+}
+
+// reconstructedMessage mirrors the assistant message of a non-streaming response
+type reconstructedMessage struct {
+	Role         string                  `json:"role"`
+	Content      *string                 `json:"content"`
+	Refusal      *string                 `json:"refusal"`
+	ToolCalls    []reconstructedToolCall `json:"tool_calls,omitempty"`
+	FunctionCall *openAIFunctionDelta    `json:"function_call,omitempty"`
+}
+
+// reconstructedToolCall is a fully merged tool call
+type reconstructedToolCall struct {
+	ID       string              `json:"id"`
+	Type     string              `json:"type"`
+	Function openAIFunctionDelta `json:"function"`
+}
+
+// choiceAccumulator collects the deltas belonging to one choice index
+type choiceAccumulator struct {
+	role         string
+	content      strings.Builder
+	sawContent   bool
+	refusal      strings.Builder
+	sawRefusal   bool
+	toolCalls    map[int]*reconstructedToolCall
+	functionCall *openAIFunctionDelta
+	logprobs     *openAIChunkProbs
+	finishReason *string
+}
+
+// merge applies a single choice delta to the accumulator
+func (acc *choiceAccumulator) merge(choice openAIChunkChoice) {
+	delta := choice.Delta
+
+	if delta.Role != "" {
+		acc.role = delta.Role
 	}
 
-	// Use first chunk as template for metadata
-	firstChunk := chunks[0].data
+	if delta.Content != nil {
+		acc.sawContent = true
+		acc.content.WriteString(*delta.Content)
+	}
 
-	// Build the reconstructed response
-	reconstructed := make(map[string]interface{})
+	if delta.Refusal != nil {
+		acc.sawRefusal = true
+		acc.refusal.WriteString(*delta.Refusal)
+	}
 
-	// Copy metadata from first chunk
-	if id, ok := firstChunk["id"].(string); ok {
-		reconstructed["id"] = id
+	// Tool call fragments are merged by their index; id/type arrive once,
+	// name and arguments arrive as string fragments to be concatenated
+	for _, tc := range delta.ToolCalls {
+		if acc.toolCalls == nil {
+			acc.toolCalls = make(map[int]*reconstructedToolCall)
+		}
+		merged, ok := acc.toolCalls[tc.Index]
+		if !ok {
+			merged = &reconstructedToolCall{}
+			acc.toolCalls[tc.Index] = merged
+		}
+		if tc.ID != "" {
+			merged.ID = tc.ID
+		}
+		if tc.Type != "" {
+			merged.Type = tc.Type
+		}
+		merged.Function.Name += tc.Function.Name
+		merged.Function.Arguments += tc.Function.Arguments
 	}
-	if obj, ok := firstChunk["object"].(string); ok {
-		// Change from "chat.completion.chunk" to "chat.completion"
-		reconstructed["object"] = strings.Replace(obj, ".chunk", "", 1)
+
+	// Legacy function_call deltas (pre tool_calls API)
+	if delta.FunctionCall != nil {
+		if acc.functionCall == nil {
+			acc.functionCall = &openAIFunctionDelta{}
+		}
+		acc.functionCall.Name += delta.FunctionCall.Name
+		acc.functionCall.Arguments += delta.FunctionCall.Arguments
 	}
-	if created, ok := firstChunk["created"].(float64); ok {
-		reconstructed["created"] = int64(created)
+
+	if choice.Logprobs != nil {
+		if acc.logprobs == nil {
+			acc.logprobs = &openAIChunkProbs{}
+		}
+		acc.logprobs.Content = append(acc.logprobs.Content, choice.Logprobs.Content...)
+		acc.logprobs.Refusal = append(acc.logprobs.Refusal, choice.Logprobs.Refusal...)
 	}
-	if model, ok := firstChunk["model"].(string); ok {
-		reconstructed["model"] = model
+
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		acc.finishReason = choice.FinishReason
 	}
-	if tier, ok := firstChunk["service_tier"].(string); ok {
-		reconstructed["service_tier"] = tier
+}
+
+// carriesTokens reports whether a delta contains generated output
+// Role-only and finish-only deltas do not count towards token timing
+func (delta openAIChunkDelta) carriesTokens() bool {
+	return (delta.Content != nil && *delta.Content != "") ||
+		(delta.Refusal != nil && *delta.Refusal != "") ||
+		len(delta.ToolCalls) > 0 ||
+		delta.FunctionCall != nil
+}
+
+// build converts the accumulated deltas into a non-streaming choice
+func (acc *choiceAccumulator) build(index int) reconstructedChoice {
+	message := reconstructedMessage{
+		Role:         acc.role,
+		FunctionCall: acc.functionCall,
 	}
-	if fp, ok := firstChunk["system_fingerprint"].(string); ok {
-		reconstructed["system_fingerprint"] = fp
+	if message.Role == "" {
+		message.Role = "assistant"
 	}
 
-	// Reconstruct the message from deltas
-	var contentBuilder strings.Builder
-	var role string
-	var toolCalls []interface{}
-	var finishReason string
-	var usage map[string]interface{}
+	// Content is null for pure tool-call responses, matching the non-streaming API
+	content := acc.content.String()
+	if content != "" || (acc.sawContent && len(acc.toolCalls) == 0 && acc.functionCall == nil) {
+		message.Content = &content
+	}
 
-	for _, chunk := range chunks {
-		choices, ok := chunk.data["choices"].([]interface{})
-		if !ok || len(choices) == 0 {
-			continue
+	if acc.sawRefusal && acc.refusal.Len() > 0 {
+		refusal := acc.refusal.String()
+		message.Refusal = &refusal
+	}
+
+	if len(acc.toolCalls) > 0 {
+		indexes := make([]int, 0, len(acc.toolCalls))
+		for i := range acc.toolCalls {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		for _, i := range indexes {
+			message.ToolCalls = append(message.ToolCalls, *acc.toolCalls[i])
 		}
+	}
 
-		choice := choices[0].(map[string]interface{})
-		delta, ok := choice["delta"].(map[string]interface{})
-		if !ok {
+	return reconstructedChoice{
+		Index:        index,
+		Message:      message,
+		Logprobs:     acc.logprobs,
+		FinishReason: acc.finishReason,
+	}
+}
+
+// reconstructOpenAIStream rebuilds OpenAI streaming response from deltas
+// Deltas are merged per choice index and per tool call index so that n>1 completions
+// and parallel tool calls come out in the same shape as a non-streaming response
+func reconstructOpenAIStream(chunks []sseChunk, startTime time.Time, stallThreshold time.Duration) (string, *models.StreamingMetadata) {
+	if len(chunks) == 0 {
+		return "", nil
+	}
+
+	var reconstructed reconstructedCompletion
+	accumulators := make(map[int]*choiceAccumulator)
+
+	// Arrival times of chunks that carried generated tokens (content, refusal or tool call fragments)
+	var tokenTimes []time.Time
+
+	for _, chunk := range chunks {
+		var parsed openAIStreamChunk
+		if err := json.Unmarshal(chunk.raw, &parsed); err != nil {
+			// Chunk is valid JSON but not in the expected shape, skip it
 			continue
 		}
 
-		// Collect role
-		if r, ok := delta["role"].(string); ok && r != "" {
-			role = r
+		// Response-level metadata: first non-empty value wins
+		if reconstructed.ID == "" {
+			reconstructed.ID = parsed.ID
 		}
-
-		// Collect content
-		if content, ok := delta["content"].(string); ok {
-			contentBuilder.WriteString(content)
+		if reconstructed.Object == "" && parsed.Object != "" {
+			// Change from "chat.completion.chunk" to "chat.completion"
+			reconstructed.Object = strings.Replace(parsed.Object, ".chunk", "", 1)
 		}
-
-		// Collect tool calls
-		if tc, ok := delta["tool_calls"].([]interface{}); ok {
-			toolCalls = append(toolCalls, tc...)
+		if reconstructed.Created == 0 {
+			reconstructed.Created = parsed.Created
+		}
+		if reconstructed.Model == "" {
+			reconstructed.Model = parsed.Model
+		}
+		if reconstructed.ServiceTier == "" {
+			reconstructed.ServiceTier = parsed.ServiceTier
+		}
+		if reconstructed.SystemFingerprint == "" {
+			reconstructed.SystemFingerprint = parsed.SystemFingerprint
 		}
 
-		// Collect finish reason
-		if fr, ok := choice["finish_reason"].(string); ok && fr != "" {
-			finishReason = fr
+		// Collect usage (usually in last chunk, which may have no choices)
+		if len(parsed.Usage) > 0 && string(parsed.Usage) != "null" {
+			reconstructed.Usage = parsed.Usage
 		}
 
-		// Collect usage (usually in last chunk)
-		if u, ok := chunk.data["usage"].(map[string]interface{}); ok {
-			usage = u
+		carriesTokens := false
+		for _, choice := range parsed.Choices {
+			acc, ok := accumulators[choice.Index]
+			if !ok {
+				acc = &choiceAccumulator{}
+				accumulators[choice.Index] = acc
+			}
+			acc.merge(choice)
+			carriesTokens = carriesTokens || choice.Delta.carriesTokens()
+		}
+		if carriesTokens && !chunk.timestamp.IsZero() {
+			tokenTimes = append(tokenTimes, chunk.timestamp)
 		}
 	}
 
-	// Build choices array
-	message := make(map[string]interface{})
-	if role != "" {
-		message["role"] = role
+	// Build choices array ordered by index
+	indexes := make([]int, 0, len(accumulators))
+	for i := range accumulators {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	reconstructed.Choices = make([]reconstructedChoice, 0, len(indexes))
+	for _, i := range indexes {
+		reconstructed.Choices = append(reconstructed.Choices, accumulators[i].build(i))
+	}
+
+	// Convert to JSON without HTML escaping so content matches the provider's bytes
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(reconstructed); err != nil {
+		log.Printf("WARNING: Failed to marshal reconstructed response: %v", err)
+		return "", nil
 	}
 
-	content := contentBuilder.String()
-	if content != "" {
-		message["content"] = content
-	} else if len(toolCalls) > 0 {
-		// For tool calls, content is null
-		message["content"] = nil
-		message["tool_calls"] = toolCalls
+	// Calculate streaming metadata
+	metadata := &models.StreamingMetadata{
+		ChunksReceived:          len(chunks),
+		ReconstructedFromStream: true,
 	}
+	applyStreamTiming(metadata, chunks, tokenTimes, startTime, completionTokens(reconstructed.Usage), stallThreshold)
+
+	return strings.TrimSuffix(buf.String(), "\n"), metadata
+}
 
-	choice := map[string]interface{}{
-		"index":   0,
-		"message": message,
+// applyStreamTiming fills the latency fields of the streaming metadata from chunk arrival times
+// Without arrival times only LastChunkTime is set, measured at reconstruction time
+func applyStreamTiming(metadata *models.StreamingMetadata, chunks []sseChunk, tokenTimes []time.Time, startTime time.Time, tokens int, stallThreshold time.Duration) {
+	var first, last time.Time
+	for _, chunk := range chunks {
+		if chunk.timestamp.IsZero() {
+			continue
+		}
+		if first.IsZero() {
+			first = chunk.timestamp
+		}
+		last = chunk.timestamp
 	}
 
-	if finishReason != "" {
-		choice["finish_reason"] = finishReason
+	if first.IsZero() {
+		metadata.LastChunkTime = time.Since(startTime)
+		return
 	}
 
-	reconstructed["choices"] = []interface{}{choice}
+	metadata.FirstChunkTime = first.Sub(startTime)
+	metadata.LastChunkTime = last.Sub(startTime)
 
-	// Add usage if available
-	if usage != nil {
-		reconstructed["usage"] = usage
+	if len(tokenTimes) == 0 {
+		return
+	}
+	metadata.TimeToFirstTokenMs = tokenTimes[0].Sub(startTime).Milliseconds()
+
+	// Gaps between consecutive token-bearing chunks
+	gaps := make([]time.Duration, 0, len(tokenTimes)-1)
+	for i := 1; i < len(tokenTimes); i++ {
+		gap := tokenTimes[i].Sub(tokenTimes[i-1])
+		gaps = append(gaps, gap)
+
+		if stallThreshold > 0 && gap >= stallThreshold {
+			metadata.Stalls = append(metadata.Stalls, models.StreamStall{
+				StartMs:    tokenTimes[i-1].Sub(startTime).Milliseconds(),
+				DurationMs: gap.Milliseconds(),
+			})
+		}
 	}
 
-	// Convert to JSON
-	jsonBytes, err := json.MarshalIndent(reconstructed, "", "  ")
-	if err != nil {
-		log.Printf("WARNING: Failed to marshal reconstructed response: %v", err)
-		return "", nil
+	if len(gaps) > 0 {
+		sorted := append([]time.Duration(nil), gaps...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		metadata.InterTokenLatency = &models.LatencyPercentiles{
+			P50Ms: percentile(sorted, 50).Milliseconds(),
+			P90Ms: percentile(sorted, 90).Milliseconds(),
+			P99Ms: percentile(sorted, 99).Milliseconds(),
+			MaxMs: sorted[len(sorted)-1].Milliseconds(),
+		}
 	}
 
-	// Calculate streaming metadata
-	metadata := &models.StreamingMetadata{
-		ChunksReceived:          len(chunks),
-		ReconstructedFromStream: true,
-		FirstChunkTime:          0, // First chunk is immediate
-		LastChunkTime:           time.Since(startTime),
+	// Prefer the provider's completion token count; fall back to counting token-bearing chunks
+	if tokens <= 0 {
+		tokens = len(tokenTimes)
+	}
+	if generation := tokenTimes[len(tokenTimes)-1].Sub(tokenTimes[0]); generation > 0 {
+		metadata.TokensPerSecond = float64(tokens) / generation.Seconds()
 	}
+}
+
+// percentile returns the nearest-rank percentile of an ascending slice
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
 
-	return string(jsonBytes), metadata
+// completionTokens extracts usage.completion_tokens from a raw usage object
+// Returns 0 if usage is absent or malformed
+func completionTokens(usage json.RawMessage) int {
+	if len(usage) == 0 {
+		return 0
+	}
+	var parsed struct {
+		CompletionTokens int `json:"completion_tokens"`
+	}
+	if err := json.Unmarshal(usage, &parsed); err != nil {
+		return 0
+	}
+	return parsed.CompletionTokens
 }
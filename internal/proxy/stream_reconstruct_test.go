@@ -216,3 +216,256 @@ func TestReconstructStreamSizeComparison(t *testing.T) {
 		t.Errorf("Expected at least 50%% size reduction, got %.1f%%", reduction)
 	}
 }
+
+func TestReconstructStreamMultipleChoices(t *testing.T) {
+	// n=2 completion with interleaved choice deltas and per-choice finish reasons
+	sseStream := `data: {"id":"chatcmpl-789","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","content":""},"logprobs":null,"finish_reason":null},{"index":1,"delta":{"role":"assistant","content":""},"logprobs":null,"finish_reason":null}]}
+
+data: {"id":"chatcmpl-789","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":1,"delta":{"content":"Second"},"logprobs":null,"finish_reason":null}]}
+
+data: {"id":"chatcmpl-789","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":"First"},"logprobs":null,"finish_reason":null}]}
+
+data: {"id":"chatcmpl-789","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{},"logprobs":null,"finish_reason":"stop"}]}
+
+data: {"id":"chatcmpl-789","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":1,"delta":{},"logprobs":null,"finish_reason":"length"}]}
+
+data: [DONE]
+
+`
+
+	reconstructed, metadata := reconstructStreamResponse(sseStream, time.Now())
+	if metadata == nil {
+		t.Fatal("Expected metadata for SSE stream")
+	}
+
+	var result struct {
+		Choices []struct {
+			Index   int `json:"index"`
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(reconstructed), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+
+	if len(result.Choices) != 2 {
+		t.Fatalf("Expected 2 choices, got %d", len(result.Choices))
+	}
+
+	expected := []struct {
+		content      string
+		finishReason string
+	}{
+		{"First", "stop"},
+		{"Second", "length"},
+	}
+	for i, exp := range expected {
+		choice := result.Choices[i]
+		if choice.Index != i {
+			t.Errorf("Choice %d: expected index %d, got %d", i, i, choice.Index)
+		}
+		if choice.Message.Content != exp.content {
+			t.Errorf("Choice %d: expected content %q, got %q", i, exp.content, choice.Message.Content)
+		}
+		if choice.FinishReason != exp.finishReason {
+			t.Errorf("Choice %d: expected finish_reason %q, got %q", i, exp.finishReason, choice.FinishReason)
+		}
+	}
+}
+
+func TestReconstructStreamParallelToolCalls(t *testing.T) {
+	// Two parallel tool calls whose arguments arrive as interleaved fragments
+	sseStream := `data: {"id":"chatcmpl-tc","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","content":null,"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"get_weather","arguments":""}}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-tc","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-tc","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"get_time","arguments":"{\"tz\":"}}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-tc","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"London\"}"}}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-tc","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":"\"UTC\"}"}}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-tc","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}
+
+data: [DONE]
+
+`
+
+	reconstructed, _ := reconstructStreamResponse(sseStream, time.Now())
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content   *string `json:"content"`
+				ToolCalls []struct {
+					ID       string `json:"id"`
+					Type     string `json:"type"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(reconstructed), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+
+	if len(result.Choices) != 1 {
+		t.Fatalf("Expected 1 choice, got %d", len(result.Choices))
+	}
+
+	message := result.Choices[0].Message
+	if message.Content != nil {
+		t.Errorf("Expected null content for tool calls, got %q", *message.Content)
+	}
+	if len(message.ToolCalls) != 2 {
+		t.Fatalf("Expected 2 merged tool calls, got %d", len(message.ToolCalls))
+	}
+
+	first, second := message.ToolCalls[0], message.ToolCalls[1]
+	if first.ID != "call_a" || first.Function.Name != "get_weather" || first.Function.Arguments != `{"city":"London"}` {
+		t.Errorf("First tool call not merged correctly: %+v", first)
+	}
+	if second.ID != "call_b" || second.Function.Name != "get_time" || second.Function.Arguments != `{"tz":"UTC"}` {
+		t.Errorf("Second tool call not merged correctly: %+v", second)
+	}
+	if first.Type != "function" || second.Type != "function" {
+		t.Error("Tool call type should be preserved")
+	}
+	if result.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("Expected finish_reason 'tool_calls', got %q", result.Choices[0].FinishReason)
+	}
+}
+
+func TestReconstructStreamLogprobsAndRefusal(t *testing.T) {
+	sseStream := `data: {"id":"chatcmpl-lp","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","refusal":"I can't"},"logprobs":{"content":null,"refusal":[{"token":"I","logprob":-0.1}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-lp","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"refusal":" help with that."},"logprobs":{"content":null,"refusal":[{"token":" can't","logprob":-0.2}]},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`
+
+	reconstructed, _ := reconstructStreamResponse(sseStream, time.Now())
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content *string `json:"content"`
+				Refusal *string `json:"refusal"`
+			} `json:"message"`
+			Logprobs *struct {
+				Refusal []map[string]interface{} `json:"refusal"`
+			} `json:"logprobs"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(reconstructed), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+
+	choice := result.Choices[0]
+	if choice.Message.Refusal == nil || *choice.Message.Refusal != "I can't help with that." {
+		t.Errorf("Refusal not reconstructed correctly: %v", choice.Message.Refusal)
+	}
+	if choice.Message.Content != nil {
+		t.Errorf("Expected null content for refusal, got %q", *choice.Message.Content)
+	}
+	if choice.Logprobs == nil || len(choice.Logprobs.Refusal) != 2 {
+		t.Fatalf("Expected 2 merged refusal logprobs, got %+v", choice.Logprobs)
+	}
+}
+
+func TestReconstructStreamMatchesNonStreamingShape(t *testing.T) {
+	sseStream := `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4","system_fingerprint":"fp_x","choices":[{"index":0,"delta":{"role":"assistant","content":"a <b> & c"},"logprobs":null,"finish_reason":"stop"}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4","system_fingerprint":"fp_x","choices":[],"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}}
+
+data: [DONE]
+
+`
+
+	reconstructed, _ := reconstructStreamResponse(sseStream, time.Now())
+
+	expected := `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"a <b> & c","refusal":null},"logprobs":null,"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3},"system_fingerprint":"fp_x"}`
+	if reconstructed != expected {
+		t.Errorf("Reconstructed body does not match non-streaming shape:\nexpected: %s\ngot:      %s", expected, reconstructed)
+	}
+}
+
+func TestReconstructStreamTimingMetrics(t *testing.T) {
+	sseStream := `data: {"id":"chatcmpl-t","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-t","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-t","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":" there"},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-t","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"!"},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-t","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":6,"total_tokens":11}}
+
+data: [DONE]
+
+`
+
+	startTime := time.Now()
+	eventTimes := []time.Time{
+		startTime.Add(100 * time.Millisecond), // role preamble
+		startTime.Add(300 * time.Millisecond), // first token
+		startTime.Add(400 * time.Millisecond),
+		startTime.Add(3400 * time.Millisecond), // after a 3s stall
+		startTime.Add(3500 * time.Millisecond),
+		startTime.Add(3500 * time.Millisecond), // [DONE]
+	}
+
+	_, metadata := reconstructTimedStreamResponse(sseStream, startTime, eventTimes, 2*time.Second)
+	if metadata == nil {
+		t.Fatal("Expected metadata for SSE stream")
+	}
+
+	if metadata.FirstChunkTime != 100*time.Millisecond {
+		t.Errorf("Expected first chunk at 100ms, got %v", metadata.FirstChunkTime)
+	}
+	if metadata.TimeToFirstTokenMs != 300 {
+		t.Errorf("Expected TTFT 300ms, got %dms", metadata.TimeToFirstTokenMs)
+	}
+	if metadata.LastChunkTime != 3500*time.Millisecond {
+		t.Errorf("Expected last chunk at 3500ms, got %v", metadata.LastChunkTime)
+	}
+
+	if metadata.InterTokenLatency == nil {
+		t.Fatal("Expected inter-token latency percentiles")
+	}
+	if metadata.InterTokenLatency.P50Ms != 100 {
+		t.Errorf("Expected p50 100ms, got %dms", metadata.InterTokenLatency.P50Ms)
+	}
+	if metadata.InterTokenLatency.MaxMs != 3000 {
+		t.Errorf("Expected max 3000ms, got %dms", metadata.InterTokenLatency.MaxMs)
+	}
+
+	if len(metadata.Stalls) != 1 {
+		t.Fatalf("Expected 1 stall, got %d", len(metadata.Stalls))
+	}
+	if metadata.Stalls[0].StartMs != 400 || metadata.Stalls[0].DurationMs != 3000 {
+		t.Errorf("Unexpected stall: %+v", metadata.Stalls[0])
+	}
+
+	// The _ms fields hold milliseconds, not nanoseconds
+	encoded, _ := json.Marshal(metadata)
+	for _, want := range []string{`"time_to_first_token_ms":300`, `"p50_ms":100`, `"start_ms":400,"duration_ms":3000`} {
+		if !strings.Contains(string(encoded), want) {
+			t.Errorf("Expected %s in %s", want, encoded)
+		}
+	}
+
+	// 6 completion tokens over the 3.1s between first and last token
+	expectedRate := 6 / 3.1
+	if diff := metadata.TokensPerSecond - expectedRate; diff > 0.01 || diff < -0.01 {
+		t.Errorf("Expected %.2f tokens/sec, got %.2f", expectedRate, metadata.TokensPerSecond)
+	}
+}
@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/audit"
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/tlsutil"
+)
+
+// testCA issues certificates for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	file string
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	file := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool, file: file}
+}
+
+// issue creates a leaf certificate and writes it with its key to dir
+func (ca *testCA) issue(t *testing.T, dir, commonName string, usage x509.ExtKeyUsage) (tls.Certificate, string, string) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	certFile := filepath.Join(dir, commonName+".crt")
+	keyFile := filepath.Join(dir, commonName+".key")
+	os.WriteFile(certFile, certPEM, 0600)
+	os.WriteFile(keyFile, keyPEM, 0600)
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("Failed to load issued certificate: %v", err)
+	}
+	return pair, certFile, keyFile
+}
+
+// TestHandlerUpstreamMTLS verifies endpoints reach upstreams with a private CA, client certificate and SNI override
+func TestHandlerUpstreamMTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	serverCert, _, _ := ca.issue(t, dir, "models.internal", x509.ExtKeyUsageServerAuth)
+	_, clientCertFile, clientKeyFile := ca.issue(t, dir, "aiblackbox", x509.ExtKeyUsageClientAuth)
+
+	var clientName string
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientName = r.TLS.VerifiedChains[0][0].Subject.CommonName
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message": "success"}`))
+	}))
+	backend.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	backend.StartTLS()
+	defer backend.Close()
+
+	cfg := createTestConfig(backend.URL)
+	cfg.Endpoints[0].TLS = config.UpstreamTLSConfig{
+		CAFile:     ca.file,
+		CertFile:   clientCertFile,
+		KeyFile:    clientKeyFile,
+		ServerName: "models.internal",
+		MinVersion: "1.2",
+	}
+	cfg.Endpoints = append(cfg.Endpoints, config.EndpointConfig{
+		Name:   "no-client-cert",
+		Target: backend.URL,
+		TLS:    config.UpstreamTLSConfig{CAFile: ca.file, ServerName: "models.internal"},
+	})
+
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if clientName != "aiblackbox" {
+		t.Errorf("Expected upstream to see client certificate aiblackbox, got %q", clientName)
+	}
+
+	req = httptest.NewRequest("POST", "/no-client-cert/v1/chat/completions", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502 without a client certificate, got %d", w.Code)
+	}
+}
+
+// TestHandlerServesHTTPSWithClientCertificates verifies verified client certificates authenticate clients
+func TestHandlerServesHTTPSWithClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	_, serverCertFile, serverKeyFile := ca.issue(t, dir, "proxy.internal", x509.ExtKeyUsageServerAuth)
+	clientCert, _, _ := ca.issue(t, dir, "ci.internal", x509.ExtKeyUsageClientAuth)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := createTestConfig(backend.URL)
+	cfg.Auth = config.AuthConfig{
+		Enabled: true,
+		Clients: []config.AuthClient{{Name: "ci", CertCommonName: "ci.internal"}},
+	}
+
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	tlsConfig, err := tlsutil.ServerConfig(config.ServerTLSConfig{
+		CertFile:     serverCertFile,
+		KeyFile:      serverKeyFile,
+		ClientCAFile: ca.file,
+		ClientAuth:   config.TLSClientAuthOptional,
+	})
+	if err != nil {
+		t.Fatalf("Failed to build server TLS config: %v", err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      ca.pool,
+			ServerName:   "proxy.internal",
+			Certificates: certs,
+		}}}
+	}
+
+	resp, err := newClient(clientCert).Post(server.URL+"/test/v1/chat/completions", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	// Optional client certificates: the handshake succeeds, authentication does not
+	resp, err = newClient().Post(server.URL+"/test/v1/chat/completions", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a client certificate, got %d", resp.StatusCode)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if len(storage.Entries()) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %d", len(storage.Entries()))
+	}
+	principal := storage.Entries()[0].Principal
+	if principal == nil || principal.ID != "ci" || principal.Method != "mtls" || principal.Issuer != "test-ca" {
+		t.Errorf("Expected mTLS principal, got %+v", principal)
+	}
+}
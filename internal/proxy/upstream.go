@@ -0,0 +1,470 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+	"github.com/jnd-labs/aiblackbox/internal/tlsutil"
+	"github.com/jnd-labs/aiblackbox/internal/trace"
+)
+
+// Health check defaults used when the endpoint config leaves them unset
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultUnhealthyThreshold  = 2
+)
+
+// errRetryableStatus signals a response that is discarded in favour of another attempt
+var errRetryableStatus = errors.New("retryable upstream status")
+
+// upstream is one target of an endpoint
+type upstream struct {
+	url    *url.URL
+	raw    string
+	weight int
+
+	outstanding atomic.Int64 // Requests currently in flight
+	healthy     atomic.Bool
+	failures    int // Consecutive failed health checks (health checker goroutine only)
+	current     int // Smooth weighted round-robin state (guarded by pool mutex)
+}
+
+// upstreamPool holds the targets of an endpoint with their health and load
+type upstreamPool struct {
+	signature string
+	strategy  string
+	targets   []*upstream
+	transport http.RoundTripper
+
+	mu   sync.Mutex
+	done chan struct{}
+}
+
+// newUpstreamPool builds the pool for an endpoint and starts its health checks if configured
+// transport carries both proxied requests and health checks
+func newUpstreamPool(endpoint config.EndpointConfig, transport http.RoundTripper) (*upstreamPool, error) {
+	pool := &upstreamPool{
+		signature: poolSignature(endpoint),
+		strategy:  endpoint.LoadBalancing,
+		transport: transport,
+		done:      make(chan struct{}),
+	}
+
+	for _, t := range endpoint.Upstreams() {
+		u, err := url.Parse(t.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target URL %q: %w", t.URL, err)
+		}
+		weight := t.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		target := &upstream{url: u, raw: t.URL, weight: weight}
+		target.healthy.Store(true)
+		pool.targets = append(pool.targets, target)
+	}
+
+	if endpoint.HealthCheck.Path != "" {
+		go pool.runHealthChecks(endpoint.Name, endpoint.HealthCheck, &http.Client{Transport: transport})
+	}
+
+	return pool, nil
+}
+
+// poolSignature identifies the endpoint settings a pool was built from
+func poolSignature(endpoint config.EndpointConfig) string {
+	return fmt.Sprintf("%v|%s|%+v|%+v", endpoint.Upstreams(), endpoint.LoadBalancing, endpoint.HealthCheck, endpoint.TLS)
+}
+
+// stop ends the pool's health checks
+func (p *upstreamPool) stop() {
+	close(p.done)
+}
+
+// pick selects the next target, skipping targets already tried for this request
+// Unhealthy targets are skipped unless every target is unhealthy and none was tried yet
+// Returns nil when no candidate is left
+func (p *upstreamPool) pick(tried map[*upstream]bool) *upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var candidates []*upstream
+	for _, t := range p.targets {
+		if !tried[t] && t.healthy.Load() {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) == 0 && len(tried) == 0 {
+		candidates = p.targets // Fail open rather than refusing all traffic
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	if p.strategy == config.LoadBalancingLeastOutstanding {
+		best := candidates[0]
+		for _, t := range candidates[1:] {
+			// Compare outstanding/weight without division
+			if t.outstanding.Load()*int64(best.weight) < best.outstanding.Load()*int64(t.weight) {
+				best = t
+			}
+		}
+		return best
+	}
+
+	// Smooth weighted round-robin spreads heavier targets evenly instead of in runs
+	total := 0
+	var best *upstream
+	for _, t := range candidates {
+		t.current += t.weight
+		total += t.weight
+		if best == nil || t.current > best.current {
+			best = t
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// runHealthChecks probes every target until the pool is stopped
+func (p *upstreamPool) runHealthChecks(endpointName string, hc config.HealthCheckConfig, client *http.Client) {
+	interval := defaultHealthCheckInterval
+	if hc.Interval > 0 {
+		interval = time.Duration(hc.Interval) * time.Second
+	}
+	timeout := defaultHealthCheckTimeout
+	if hc.Timeout > 0 {
+		timeout = time.Duration(hc.Timeout) * time.Second
+	}
+	threshold := defaultUnhealthyThreshold
+	if hc.UnhealthyThreshold > 0 {
+		threshold = hc.UnhealthyThreshold
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, t := range p.targets {
+			p.checkTarget(endpointName, t, hc.Path, timeout, threshold, client)
+		}
+
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkTarget runs one health check and updates the target's health
+func (p *upstreamPool) checkTarget(endpointName string, t *upstream, path string, timeout time.Duration, threshold int, client *http.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	checkURL := *t.url
+	checkURL.Path = singleJoiningSlash(t.url.Path, path)
+
+	healthy := false
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL.String(), nil)
+	if err == nil {
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			healthy = resp.StatusCode < 400
+			if !healthy {
+				err = fmt.Errorf("status %d", resp.StatusCode)
+			}
+		}
+	}
+
+	if healthy {
+		t.failures = 0
+		if !t.healthy.Swap(true) {
+			log.Printf("INFO: Upstream healthy again: endpoint=%s, target=%s", endpointName, t.raw)
+		}
+		return
+	}
+
+	t.failures++
+	if t.failures >= threshold && t.healthy.Swap(false) {
+		log.Printf("WARNING: Upstream marked unhealthy: endpoint=%s, target=%s, error=%v", endpointName, t.raw, err)
+	}
+}
+
+// upstreamPool returns the pool for an endpoint, rebuilding it when the endpoint config changed
+func (h *Handler) upstreamPool(endpoint config.EndpointConfig) (*upstreamPool, error) {
+	signature := poolSignature(endpoint)
+
+	h.poolsMu.Lock()
+	defer h.poolsMu.Unlock()
+
+	if pool, ok := h.pools[endpoint.Name]; ok && pool.signature == signature {
+		return pool, nil
+	}
+
+	transport, err := h.upstreamTransport(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := newUpstreamPool(endpoint, transport)
+	if err != nil {
+		return nil, err
+	}
+	if old, ok := h.pools[endpoint.Name]; ok {
+		old.stop()
+	}
+	h.pools[endpoint.Name] = pool
+	return pool, nil
+}
+
+// upstreamTransport returns the transport for an endpoint's targets
+// Endpoints with TLS settings get their own transport so connections are never shared
+// across trust stores or client certificates
+func (h *Handler) upstreamTransport(endpoint config.EndpointConfig) (http.RoundTripper, error) {
+	if endpoint.TLS == (config.UpstreamTLSConfig{}) {
+		return h.transport, nil
+	}
+
+	tlsConfig, err := tlsutil.ClientConfig(endpoint.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream TLS settings: %w", err)
+	}
+	transport := h.transport.Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// upstreamRoute carries a request through an endpoint's upstream pool
+type upstreamRoute struct {
+	pool       *upstreamPool
+	actualPath string
+
+	// body is the complete request body when it was buffered up front
+	// Failover and retries need to resend the body, so they are only possible when replayable is true
+	body       []byte
+	replayable bool
+
+	retry       retryPolicy
+	credentials *upstreamCredentials
+
+	// onResponse is called with the response that will be served to the client
+	onResponse func(*http.Response) error
+
+	// Guarded by mu: a timed-out stream is finalized while forward may still be running
+	mu        sync.Mutex
+	served    string
+	servedURL string
+	attempts  []models.UpstreamAttempt
+}
+
+// record appends a finished attempt, marking its target as the serving one if it was served
+// upstreamURL is the sanitized URL the attempt was sent to
+func (route *upstreamRoute) record(attempt models.UpstreamAttempt, upstreamURL string) {
+	route.mu.Lock()
+	defer route.mu.Unlock()
+
+	route.attempts = append(route.attempts, attempt)
+	if attempt.Outcome == models.AttemptServed {
+		route.served = attempt.Target
+		route.servedURL = upstreamURL
+	}
+}
+
+// details returns the routing record for the audit entry
+// When the request took several attempts and a trace context is given, every attempt
+// is linked to a child span of the request's span
+func (route *upstreamRoute) details(traceContext *models.TraceContext) *models.UpstreamDetails {
+	route.mu.Lock()
+	defer route.mu.Unlock()
+
+	if len(route.attempts) == 0 {
+		return nil
+	}
+	details := &models.UpstreamDetails{
+		Target:   route.served,
+		URL:      route.servedURL,
+		Attempts: append([]models.UpstreamAttempt(nil), route.attempts...),
+	}
+
+	if traceContext == nil || len(details.Attempts) < 2 {
+		return details
+	}
+	for i := range details.Attempts {
+		a := &details.Attempts[i]
+		a.SpanID = trace.AttemptSpanID(traceContext.SpanID, i+1)
+		traceContext.Attempts = append(traceContext.Attempts, models.AttemptSpan{
+			SpanID:     a.SpanID,
+			Attempt:    i + 1,
+			Target:     a.Target,
+			StatusCode: a.StatusCode,
+			Error:      a.Error,
+			Outcome:    a.Outcome,
+		})
+	}
+	if traceContext.Attributes == nil {
+		traceContext.Attributes = make(map[string]string)
+	}
+	traceContext.Attributes["upstream_attempts"] = strconv.Itoa(len(details.Attempts))
+	return details
+}
+
+// forward proxies the request to the pool's targets
+// Connection errors before the request was sent (any transport error for idempotent requests) and
+// 5xx/429 responses fail over to the next untried target at once;
+// failures the retry policy deems safe are retried after a backoff once no untried target is left
+// Both decisions are made before anything is written to w, so a response that has started
+// streaming to the client is never abandoned
+func (h *Handler) forward(w http.ResponseWriter, r *http.Request, route *upstreamRoute) {
+	tried := make(map[*upstream]bool)
+	var backoff time.Duration
+	retries := 0
+
+	for n := 1; ; n++ {
+		target := route.pool.pick(tried)
+		if target == nil {
+			// Every remaining target went unhealthy while failing over
+			proxyErrorHandler(w, r, errors.New("no upstream target available"))
+			return
+		}
+		tried[target] = true
+
+		more := route.replayable && route.retry.allows(n)
+		canFailover := more && route.pool.pickable(tried)
+
+		if n > 1 {
+			r.Body = io.NopCloser(bytes.NewReader(route.body))
+		}
+
+		attempt := models.UpstreamAttempt{Target: target.raw, StartTime: time.Now(), BackoffMs: backoff.Milliseconds(), Outcome: models.AttemptServed}
+		backoff = 0
+		var upstreamURL string
+
+		proxy := httputil.NewSingleHostReverseProxy(target.url)
+		proxy.Transport = route.pool.transport
+
+		// Customize the director to modify the request
+		originalDirector := proxy.Director
+		targetURL := target.url
+		proxy.Director = func(req *http.Request) {
+			// Client credentials are stripped before the target's own query is merged in
+			route.credentials.apply(req)
+			originalDirector(req)
+			// Combine target's base path with the actual request path
+			req.URL.Path = singleJoiningSlash(targetURL.Path, route.actualPath)
+			req.Host = targetURL.Host
+			upstreamURL = h.sanitizeURL(req.URL.Redacted())
+		}
+
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			attempt.StatusCode = resp.StatusCode
+			attempt.DurationMs = time.Since(attempt.StartTime).Milliseconds()
+
+			if canFailover && isRetryableStatus(resp.StatusCode) {
+				attempt.Outcome = models.AttemptFailedOver
+				return errRetryableStatus
+			}
+			if more && route.retry.retryableStatus(resp.StatusCode) {
+				backoff = route.retry.backoff(retries + 1)
+				wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+				if !ok || wait <= route.retry.maxRetryAfter {
+					backoff = max(backoff, wait)
+					attempt.Outcome = models.AttemptRetried
+					return errRetryableStatus
+				}
+				// The upstream asks for a longer wait than we hold requests for; let the client decide
+				backoff = 0
+			}
+
+			if route.onResponse != nil {
+				return route.onResponse(resp)
+			}
+			return nil
+		}
+
+		proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+			if attempt.StatusCode == 0 {
+				// No response arrived, so ModifyResponse did not time the attempt
+				attempt.DurationMs = time.Since(attempt.StartTime).Milliseconds()
+			}
+			if errors.Is(err, errRetryableStatus) {
+				// Discarded response; the outcome was decided in ModifyResponse
+				return
+			}
+			attempt.Error = err.Error()
+
+			// Nothing was written yet; leave the response to the next attempt
+			// unless the upstream may already have acted on a non-idempotent request
+			if canFailover && safeToResend(req, err) {
+				attempt.Outcome = models.AttemptFailedOver
+				return
+			}
+			if more && route.retry.retryableError(req, err) {
+				attempt.Outcome = models.AttemptRetried
+				backoff = route.retry.backoff(retries + 1)
+				return
+			}
+			proxyErrorHandler(rw, req, err)
+		}
+
+		target.outstanding.Add(1)
+		proxy.ServeHTTP(w, r)
+		target.outstanding.Add(-1)
+
+		route.record(attempt, upstreamURL)
+
+		switch attempt.Outcome {
+		case models.AttemptServed:
+			return
+		case models.AttemptFailedOver:
+			log.Printf("WARNING: Upstream attempt failed, failing over: target=%s, status=%d, error=%s",
+				target.raw, attempt.StatusCode, attempt.Error)
+		case models.AttemptRetried:
+			log.Printf("WARNING: Upstream attempt failed, retrying in %s: target=%s, status=%d, error=%s",
+				backoff, target.raw, attempt.StatusCode, attempt.Error)
+
+			retries++
+			clear(tried) // Every target is eligible again for the retry
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				proxyErrorHandler(w, r, context.Cause(r.Context()))
+				return
+			}
+		}
+	}
+}
+
+// pickable reports whether any healthy target is left untried
+func (p *upstreamPool) pickable(tried map[*upstream]bool) bool {
+	for _, t := range p.targets {
+		if !tried[t] && t.healthy.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableStatus reports whether a response status warrants trying another target
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
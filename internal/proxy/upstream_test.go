@@ -0,0 +1,351 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/audit"
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+// createMultiTargetConfig creates a test configuration with several upstream targets
+func createMultiTargetConfig(targets ...string) *config.Config {
+	cfg := createTestConfig("")
+	cfg.Endpoints[0].Target = ""
+	for _, t := range targets {
+		cfg.Endpoints[0].Targets = append(cfg.Endpoints[0].Targets, config.UpstreamTarget{URL: t, Weight: 1})
+	}
+	return cfg
+}
+
+// TestHandlerFailoverOnRetryableStatus verifies 5xx/429 responses fail over to the next target
+func TestHandlerFailoverOnRetryableStatus(t *testing.T) {
+	var failingCalls int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failingCalls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error": "overloaded"}`))
+	}))
+	defer failing.Close()
+
+	var receivedBody string
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receivedBody = string(body)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message": "success"}`))
+	}))
+	defer healthy.Close()
+
+	cfg := createMultiTargetConfig(failing.URL, healthy.URL)
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{"model":"gpt-4"}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if w.Code != http.StatusOK || w.Body.String() != `{"message": "success"}` {
+		t.Fatalf("Expected the healthy target's response, got %d %s", w.Code, w.Body.String())
+	}
+	if failingCalls != 1 {
+		t.Errorf("Expected 1 call to the failing target, got %d", failingCalls)
+	}
+	if receivedBody != `{"model":"gpt-4"}` {
+		t.Errorf("Failover should resend the full body, got %q", receivedBody)
+	}
+
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
+	}
+	up := storage.Entries()[0].Upstream
+	if up == nil {
+		t.Fatal("Expected upstream details in audit entry")
+	}
+	if up.Target != healthy.URL {
+		t.Errorf("Expected serving target %s, got %s", healthy.URL, up.Target)
+	}
+	if len(up.Attempts) != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", len(up.Attempts))
+	}
+	if up.Attempts[0].Target != failing.URL || up.Attempts[0].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected first attempt: %+v", up.Attempts[0])
+	}
+	if up.Attempts[1].StatusCode != http.StatusOK {
+		t.Errorf("Unexpected second attempt: %+v", up.Attempts[1])
+	}
+}
+
+// TestHandlerFailoverOnConnectionError verifies unreachable targets fail over
+func TestHandlerFailoverOnConnectionError(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	cfg := createMultiTargetConfig(downURL, healthy.URL)
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 after failover, got %d", w.Code)
+	}
+
+	up := storage.Entries()[0].Upstream
+	if len(up.Attempts) != 2 || up.Attempts[0].Error == "" {
+		t.Errorf("Expected a failed first attempt with an error, got %+v", up.Attempts)
+	}
+}
+
+// TestHandlerLastTargetErrorIsServed verifies the final target's error reaches the client
+func TestHandlerLastTargetErrorIsServed(t *testing.T) {
+	var calls int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer failing.Close()
+
+	cfg := createMultiTargetConfig(failing.URL, failing.URL+"/")
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the last target's 429, got %d", w.Code)
+	}
+	if calls != 2 {
+		t.Errorf("Each target should be tried once, got %d calls", calls)
+	}
+}
+
+// TestHandlerNoFailoverForStreamedBody verifies bodies too large to buffer are sent only once
+func TestHandlerNoFailoverForStreamedBody(t *testing.T) {
+	var calls int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	cfg := createMultiTargetConfig(failing.URL, failing.URL+"/")
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+
+	largeBody := strings.Repeat("A", requestPeekSize+1)
+	req := httptest.NewRequest("POST", "/test/v1/files", strings.NewReader(largeBody))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502, got %d", w.Code)
+	}
+	if calls != 1 {
+		t.Errorf("Streamed body must not be resent, got %d calls", calls)
+	}
+}
+
+// TestHandlerNoFailoverAfterRequestSent verifies requests the upstream may have acted on are only
+// failed over when they are idempotent
+func TestHandlerNoFailoverAfterRequestSent(t *testing.T) {
+	tests := []struct {
+		name           string
+		idempotencyKey string
+		wantCalls      int32
+	}{
+		{"non-idempotent", "", 1},
+		{"idempotency key", "req-1", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The upstream reads the request and drops the connection without answering
+			var calls int32
+			reset := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				io.Copy(io.Discard, r.Body)
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Errorf("Failed to hijack connection: %v", err)
+					return
+				}
+				conn.Close()
+			})
+			first := httptest.NewServer(reset)
+			defer first.Close()
+			second := httptest.NewServer(reset)
+			defer second.Close()
+
+			cfg := createMultiTargetConfig(first.URL, second.URL)
+			storage := &mockAuditStorage{}
+			worker := audit.NewWorker(storage, "test-seed", 10)
+			defer worker.Shutdown()
+
+			handler := NewHandler(cfg, worker)
+			defer handler.Shutdown()
+
+			req := httptest.NewRequest("POST", "/test/v1/chat/completions", strings.NewReader(`{}`))
+			if tt.idempotencyKey != "" {
+				req.Header.Set("Idempotency-Key", tt.idempotencyKey)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadGateway {
+				t.Errorf("Expected 502, got %d", w.Code)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("Expected %d upstream calls, got %d", tt.wantCalls, got)
+			}
+		})
+	}
+}
+
+// TestUpstreamPoolWeightedRoundRobin verifies targets are picked in proportion to their weights
+func TestUpstreamPoolWeightedRoundRobin(t *testing.T) {
+	pool, err := newUpstreamPool(config.EndpointConfig{
+		Name: "test",
+		Targets: []config.UpstreamTarget{
+			{URL: "http://a", Weight: 3},
+			{URL: "http://b", Weight: 1},
+		},
+	}, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	defer pool.stop()
+
+	counts := make(map[string]int)
+	var sequence []string
+	for i := 0; i < 8; i++ {
+		target := pool.pick(map[*upstream]bool{})
+		counts[target.raw]++
+		sequence = append(sequence, target.raw)
+	}
+
+	if counts["http://a"] != 6 || counts["http://b"] != 2 {
+		t.Errorf("Expected 6/2 split, got %v", counts)
+	}
+	// Smooth round-robin never sends more than three requests in a row to the heavier target
+	if strings.Contains(strings.Join(sequence, ","), strings.Repeat("http://a,", 4)) {
+		t.Errorf("Expected interleaved picks, got %v", sequence)
+	}
+}
+
+// TestUpstreamPoolLeastOutstanding verifies the least loaded target is picked
+func TestUpstreamPoolLeastOutstanding(t *testing.T) {
+	pool, err := newUpstreamPool(config.EndpointConfig{
+		Name:          "test",
+		LoadBalancing: config.LoadBalancingLeastOutstanding,
+		Targets: []config.UpstreamTarget{
+			{URL: "http://a"},
+			{URL: "http://b"},
+		},
+	}, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	defer pool.stop()
+
+	pool.targets[0].outstanding.Store(5)
+	pool.targets[1].outstanding.Store(2)
+
+	if target := pool.pick(map[*upstream]bool{}); target.raw != "http://b" {
+		t.Errorf("Expected least loaded target http://b, got %s", target.raw)
+	}
+
+	// Already tried targets are skipped even if less loaded
+	tried := map[*upstream]bool{pool.targets[1]: true}
+	if target := pool.pick(tried); target == nil || target.raw != "http://a" {
+		t.Errorf("Expected untried target http://a, got %v", target)
+	}
+}
+
+// TestUpstreamPoolHealthChecks verifies failing targets are taken out of rotation
+func TestUpstreamPoolHealthChecks(t *testing.T) {
+	var healthy atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	standby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer standby.Close()
+
+	pool, err := newUpstreamPool(config.EndpointConfig{
+		Name:        "test",
+		Targets:     []config.UpstreamTarget{{URL: backend.URL}, {URL: standby.URL}},
+		HealthCheck: config.HealthCheckConfig{Path: "/health", Interval: 1, UnhealthyThreshold: 1},
+	}, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	defer pool.stop()
+
+	// The first check runs immediately
+	deadline := time.Now().Add(2 * time.Second)
+	for pool.targets[0].healthy.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pool.targets[0].healthy.Load() {
+		t.Fatal("Target failing its health check should be marked unhealthy")
+	}
+
+	for i := 0; i < 3; i++ {
+		if target := pool.pick(map[*upstream]bool{}); target.raw != standby.URL {
+			t.Errorf("Unhealthy target should not be picked, got %s", target.raw)
+		}
+	}
+
+	healthy.Store(true)
+	deadline = time.Now().Add(3 * time.Second)
+	for !pool.targets[0].healthy.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !pool.targets[0].healthy.Load() {
+		t.Error("Target passing its health check again should be healthy")
+	}
+}
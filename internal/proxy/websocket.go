@@ -0,0 +1,551 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/auth"
+	"github.com/jnd-labs/aiblackbox/internal/media"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+	"github.com/jnd-labs/aiblackbox/internal/policy"
+)
+
+// WebSocket opcodes (RFC 6455 section 5.2)
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+var wsOpcodeNames = map[byte]string{
+	wsOpText:   "text",
+	wsOpBinary: "binary",
+	wsOpClose:  "close",
+	wsOpPing:   "ping",
+	wsOpPong:   "pong",
+}
+
+// wsAudioFields maps realtime API event types to the field carrying Base64 audio
+var wsAudioFields = map[string]string{
+	"input_audio_buffer.append":   "audio",
+	"response.audio.delta":        "delta",
+	"response.output_audio.delta": "delta",
+}
+
+// isWebSocketUpgrade reports whether the client asked to upgrade the connection to a WebSocket
+func isWebSocketUpgrade(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleWebSocket proxies a WebSocket session and writes one audit entry when it ends
+// Frames are relayed unchanged; both directions are parsed on the fly to record every message
+func (h *Handler) handleWebSocket(
+	w http.ResponseWriter,
+	r *http.Request,
+	route *upstreamRoute,
+	startTime time.Time,
+	endpointName string,
+	actualPath string,
+	requestCapturer *RequestCapturer,
+) {
+	// Compressed frames cannot be recorded; only plain frames may be negotiated
+	r.Header.Del("Sec-WebSocket-Extensions")
+
+	capturer := NewResponseCapturer(w)
+	recorder := newWebSocketRecorder(h.mediaExtractor, h.config.Streaming.MaxAuditBodySize)
+
+	var upgradeHeaders http.Header
+	route.onResponse = func(resp *http.Response) error {
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			return nil
+		}
+		backend, ok := resp.Body.(io.ReadWriteCloser)
+		if !ok {
+			return nil
+		}
+
+		// Sessions outlive the server's read/write timeouts
+		extendConnDeadlines(w, time.Time{})
+
+		upgradeHeaders = resp.Header.Clone()
+		recorder.open(resp.Header.Get("Sec-WebSocket-Protocol"))
+		resp.Body = &webSocketRelay{
+			ReadWriteCloser: backend,
+			fromClient:      recorder.parser(models.WebSocketClient),
+			fromServer:      recorder.parser(models.WebSocketServer),
+		}
+		return nil
+	}
+
+	// Returns once either side ends the session
+	h.forward(capturer, r, route)
+
+	duration := time.Since(startTime)
+	sequenceID := h.getNextSequenceID()
+	session := recorder.finish(sequenceID)
+
+	// Remove personal data and secrets from the request and the relayed text messages
+	var redactions []models.RedactionFinding
+	requestBody := h.redact(requestCapturer.Body(), "request.body", &redactions)
+	if session != nil {
+		for i := range session.Events {
+			if event := &session.Events[i]; event.Opcode == wsOpcodeNames[wsOpText] {
+				event.Payload = h.redact(event.Payload, fmt.Sprintf("websocket.events[%d].payload", i), &redactions)
+			}
+		}
+	}
+
+	response := models.ResponseDetails{
+		Duration:   duration,
+		IsComplete: true,
+	}
+	if session != nil {
+		response.StatusCode = http.StatusSwitchingProtocols
+		response.Headers = h.sanitizeResponseHeaders(h.cloneHeaders(upgradeHeaders), false)
+		if session.ClosedBy == "" {
+			response.IsComplete = false
+			response.Error = "ABNORMAL_CLOSURE"
+		}
+	} else {
+		// The upstream refused the upgrade and answered with a regular response
+		responseBody := capturer.DecompressedBody()
+		response.StatusCode = capturer.StatusCode()
+		response.Headers = h.sanitizeResponseHeaders(h.cloneHeaders(capturer.Headers()), responseBody != capturer.Body())
+		response.Body = h.redact(responseBody, "response.body", &redactions)
+		response.ContentLength = int64(len(responseBody))
+		response.IsComplete = capturer.IsComplete()
+		response.Error = capturer.Error()
+	}
+
+	traceContext := h.extractTraceContext(r)
+
+	entry := &models.AuditEntry{
+		Timestamp:  startTime,
+		Endpoint:   endpointName,
+		SequenceID: sequenceID,
+		Request: models.RequestDetails{
+			Method:           r.Method,
+			Path:             actualPath,
+			URL:              h.requestURL(r),
+			Headers:          h.sanitizeHeaders(h.cloneHeaders(r.Header)),
+			Body:             requestBody,
+			ContentLength:    r.ContentLength,
+			Truncated:        requestCapturer.IsTruncated(),
+			TruncatedAtBytes: requestCapturer.TruncatedAtBytes(),
+		},
+		Response:   response,
+		Trace:      traceContext,
+		Upstream:   route.details(traceContext),
+		Principal:  auth.FromContext(r.Context()),
+		WebSocket:  session,
+		Redactions: redactions,
+		Policy:     policy.FromContext(r.Context()),
+	}
+
+	h.auditWorker.Log(entry)
+
+	if session != nil {
+		log.Printf("INFO: WebSocket session ended: endpoint=%s, seq=%d, duration=%v, client_messages=%d, server_messages=%d, closed_by=%s",
+			endpointName, sequenceID, duration, session.ClientMessages, session.ServerMessages, session.ClosedBy)
+	}
+}
+
+// webSocketRelay wraps the upstream connection of an upgraded session
+// Reads carry server-to-client bytes and writes client-to-server bytes; both are
+// passed through unchanged after being fed to the direction's frame parser
+type webSocketRelay struct {
+	io.ReadWriteCloser
+	fromClient *frameParser
+	fromServer *frameParser
+}
+
+func (c *webSocketRelay) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	c.fromServer.feed(p[:n])
+	return n, err
+}
+
+func (c *webSocketRelay) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	c.fromClient.feed(p[:n])
+	return n, err
+}
+
+// frameParser reassembles the messages of one direction of a WebSocket byte stream
+// It tolerates frames split across reads and keeps at most limit payload bytes per message
+type frameParser struct {
+	limit     int64
+	onMessage func(opcode byte, payload []byte, size int64, truncated bool)
+
+	// Current frame
+	header    []byte
+	inFrame   bool
+	fin       bool
+	opcode    byte
+	remaining uint64
+	masked    bool
+	mask      [4]byte
+	maskPos   int
+
+	// Message being assembled from data frames
+	msgOpcode    byte
+	msg          []byte
+	msgSize      int64
+	msgTruncated bool
+
+	// Control frames may be interleaved with the fragments of a data message
+	control []byte
+
+	// broken is set on a malformed frame; the rest of the stream is not recorded
+	broken bool
+}
+
+func newFrameParser(limit int64, onMessage func(opcode byte, payload []byte, size int64, truncated bool)) *frameParser {
+	return &frameParser{limit: limit, onMessage: onMessage}
+}
+
+// feed parses the next bytes of the stream
+func (p *frameParser) feed(data []byte) {
+	for len(data) > 0 && !p.broken {
+		if !p.inFrame {
+			p.header = append(p.header, data[0])
+			data = data[1:]
+			if need := frameHeaderLen(p.header); need < 0 || len(p.header) < need {
+				continue
+			}
+			p.startFrame()
+			if p.remaining == 0 && !p.broken {
+				p.endFrame()
+			}
+			continue
+		}
+
+		n := min(uint64(len(data)), p.remaining)
+		p.payload(data[:n])
+		data = data[n:]
+		p.remaining -= n
+		if p.remaining == 0 {
+			p.endFrame()
+		}
+	}
+}
+
+// frameHeaderLen returns the length of the frame header starting with h, or -1 if more bytes are needed
+func frameHeaderLen(h []byte) int {
+	if len(h) < 2 {
+		return -1
+	}
+	n := 2
+	switch h[1] & 0x7f {
+	case 126:
+		n += 2
+	case 127:
+		n += 8
+	}
+	if h[1]&0x80 != 0 {
+		n += 4
+	}
+	return n
+}
+
+func (p *frameParser) startFrame() {
+	h := p.header
+	p.header = p.header[:0]
+
+	p.fin = h[0]&0x80 != 0
+	p.opcode = h[0] & 0x0f
+	p.masked = h[1]&0x80 != 0
+	p.maskPos = 0
+
+	length := uint64(h[1] & 0x7f)
+	offset := 2
+	switch length {
+	case 126:
+		length = uint64(binary.BigEndian.Uint16(h[2:4]))
+		offset = 4
+	case 127:
+		length = binary.BigEndian.Uint64(h[2:10])
+		offset = 10
+	}
+	if p.masked {
+		copy(p.mask[:], h[offset:offset+4])
+	}
+
+	isControl := p.opcode >= wsOpClose
+	if length > 1<<62 || (isControl && length > 125) || (p.opcode == wsOpContinuation && p.msgOpcode == 0) {
+		log.Printf("WARNING: Malformed WebSocket frame; the rest of the session is not recorded")
+		p.broken = true
+		return
+	}
+
+	p.inFrame = true
+	p.remaining = length
+
+	switch {
+	case isControl:
+		p.control = p.control[:0]
+	case p.opcode != wsOpContinuation:
+		p.msgOpcode = p.opcode
+		p.msg = p.msg[:0]
+		p.msgSize = 0
+		// Compressed payloads (RSV1) cannot be decoded for the audit log
+		p.msgTruncated = h[0]&0x40 != 0
+	}
+}
+
+// payload unmasks a chunk of the current frame into the message buffers
+// The relayed bytes are never modified
+func (p *frameParser) payload(chunk []byte) {
+	if p.opcode < wsOpClose {
+		p.msgSize += int64(len(chunk))
+		if p.msgTruncated {
+			p.maskPos += len(chunk)
+			return
+		}
+		if room := p.limit - int64(len(p.msg)); int64(len(chunk)) > room {
+			chunk = chunk[:max(room, 0)]
+			p.msgTruncated = true
+		}
+	}
+
+	start := len(p.msg)
+	if p.opcode >= wsOpClose {
+		start = len(p.control)
+		p.control = append(p.control, chunk...)
+	} else {
+		p.msg = append(p.msg, chunk...)
+	}
+	if !p.masked {
+		p.maskPos += len(chunk)
+		return
+	}
+
+	buf := p.msg
+	if p.opcode >= wsOpClose {
+		buf = p.control
+	}
+	for i := start; i < len(buf); i++ {
+		buf[i] ^= p.mask[p.maskPos%4]
+		p.maskPos++
+	}
+}
+
+func (p *frameParser) endFrame() {
+	p.inFrame = false
+
+	if p.opcode >= wsOpClose {
+		p.onMessage(p.opcode, p.control, int64(len(p.control)), false)
+		return
+	}
+	if p.fin {
+		p.onMessage(p.msgOpcode, p.msg, p.msgSize, p.msgTruncated)
+		p.msgOpcode = 0
+	}
+}
+
+// webSocketRecorder builds the transcript of a session from the messages of both directions
+type webSocketRecorder struct {
+	extractor *media.Extractor
+	limit     int64
+
+	// Guarded by mu: the two directions are parsed on different goroutines, and one of
+	// them may still be running when the session is finalized
+	mu       sync.Mutex
+	opened   time.Time
+	session  *models.WebSocketSession
+	budget   int64
+	tracks   map[string]*media.Track
+	noTrack  map[string]bool
+	finished bool
+}
+
+func newWebSocketRecorder(extractor *media.Extractor, limit int64) *webSocketRecorder {
+	return &webSocketRecorder{
+		extractor: extractor,
+		limit:     limit,
+		budget:    limit,
+		tracks:    make(map[string]*media.Track),
+		noTrack:   make(map[string]bool),
+	}
+}
+
+// open starts the transcript once the upstream accepted the upgrade
+func (rec *webSocketRecorder) open(subprotocol string) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.opened = time.Now()
+	rec.session = &models.WebSocketSession{Subprotocol: subprotocol, Events: []models.WebSocketEvent{}}
+}
+
+// parser returns the frame parser recording the messages sent by direction
+func (rec *webSocketRecorder) parser(direction string) *frameParser {
+	return newFrameParser(rec.limit, func(opcode byte, payload []byte, size int64, truncated bool) {
+		rec.record(direction, opcode, payload, size, truncated)
+	})
+}
+
+// record appends a message to the transcript
+func (rec *webSocketRecorder) record(direction string, opcode byte, payload []byte, size int64, truncated bool) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if rec.finished || rec.session == nil {
+		return
+	}
+	session := rec.session
+
+	event := models.WebSocketEvent{
+		Direction: direction,
+		OffsetMs:  time.Since(rec.opened).Milliseconds(),
+		Opcode:    wsOpcodeNames[opcode],
+		Size:      size,
+		Truncated: truncated,
+	}
+
+	switch opcode {
+	case wsOpText:
+		event.Payload = string(payload)
+		if !truncated {
+			event.Type, event.Payload = rec.extractAudio(direction, event.Payload)
+		}
+	case wsOpBinary:
+		event.Payload = base64.StdEncoding.EncodeToString(payload)
+	case wsOpClose:
+		if len(payload) >= 2 && session.ClosedBy == "" {
+			session.CloseCode = int(binary.BigEndian.Uint16(payload))
+			session.CloseReason = string(payload[2:])
+		}
+		if len(payload) >= 2 {
+			event.Payload = string(payload[2:])
+		}
+		if session.ClosedBy == "" {
+			session.ClosedBy = direction
+		}
+	}
+
+	if opcode == wsOpText || opcode == wsOpBinary {
+		if direction == models.WebSocketClient {
+			session.ClientMessages++
+		} else {
+			session.ServerMessages++
+		}
+	}
+
+	// Payloads count against the session's audit size limit; later ones are dropped
+	if int64(len(event.Payload)) > rec.budget {
+		event.Payload = ""
+		event.Truncated = true
+		session.Truncated = true
+	} else {
+		rec.budget -= int64(len(event.Payload))
+	}
+	if event.Truncated {
+		session.Truncated = true
+	}
+
+	session.Events = append(session.Events, event)
+}
+
+// extractAudio returns the event type of a JSON text message and the message with its audio
+// moved to the direction's track, referenced as [AUDIO_EXTRACTED:{direction}:{start}-{end}]
+// The message is returned unchanged if it carries no audio or extraction is disabled
+func (rec *webSocketRecorder) extractAudio(direction, text string) (string, string) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &fields); err != nil {
+		return "", text
+	}
+	var eventType string
+	json.Unmarshal(fields["type"], &eventType)
+
+	field, ok := wsAudioFields[eventType]
+	if !ok || fields[field] == nil {
+		return eventType, text
+	}
+	var encoded string
+	if err := json.Unmarshal(fields[field], &encoded); err != nil || encoded == "" {
+		return eventType, text
+	}
+	audio, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return eventType, text
+	}
+
+	track := rec.track(direction)
+	if track == nil {
+		return eventType, text
+	}
+	start, end, err := track.Append(audio)
+	if err != nil {
+		log.Printf("WARNING: Failed to extract WebSocket audio: direction=%s, error=%v", direction, err)
+		return eventType, text
+	}
+
+	placeholder := fmt.Sprintf(`"[AUDIO_EXTRACTED:%s:%d-%d]"`, direction, start, end)
+	return eventType, strings.Replace(text, string(fields[field]), placeholder, 1)
+}
+
+// track returns the audio track of a direction, starting it on first use
+// Returns nil if extraction is disabled or the track could not be created
+func (rec *webSocketRecorder) track(direction string) *media.Track {
+	if track := rec.tracks[direction]; track != nil || rec.noTrack[direction] {
+		return track
+	}
+	track, err := rec.extractor.NewTrack("ws_"+direction+"_audio", "audio/pcm", "pcm")
+	if err != nil {
+		log.Printf("WARNING: Failed to start WebSocket audio track, keeping audio inline: direction=%s, error=%v", direction, err)
+	}
+	if track == nil {
+		rec.noTrack[direction] = true
+		return nil
+	}
+	rec.tracks[direction] = track
+	return track
+}
+
+// finish stops recording and stores the audio tracks under the session's sequence ID
+// Returns nil if the upgrade never happened
+func (rec *webSocketRecorder) finish(sequenceID uint64) *models.WebSocketSession {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.finished = true
+	if rec.session == nil {
+		return nil
+	}
+
+	for _, direction := range []string{models.WebSocketClient, models.WebSocketServer} {
+		track := rec.tracks[direction]
+		if track == nil {
+			continue
+		}
+		ref, err := rec.extractor.SaveTrack(track, sequenceID, "[AUDIO_EXTRACTED:"+direction+"]")
+		if err != nil {
+			log.Printf("WARNING: Failed to store WebSocket audio: seq=%d, direction=%s, error=%v", sequenceID, direction, err)
+			continue
+		}
+		rec.session.Audio = append(rec.session.Audio, *ref)
+	}
+	return rec.session
+}
@@ -0,0 +1,396 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/audit"
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+)
+
+// writeWSFrame writes a single WebSocket frame; client frames must be masked
+func writeWSFrame(w io.Writer, fin bool, opcode byte, payload []byte, masked bool) error {
+	var frame bytes.Buffer
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	frame.WriteByte(b0)
+
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame.WriteByte(maskBit | byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame.WriteByte(maskBit | 126)
+		binary.Write(&frame, binary.BigEndian, uint16(len(payload)))
+	default:
+		frame.WriteByte(maskBit | 127)
+		binary.Write(&frame, binary.BigEndian, uint64(len(payload)))
+	}
+
+	if masked {
+		mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+		frame.Write(mask[:])
+		for i, b := range payload {
+			frame.WriteByte(b ^ mask[i%4])
+		}
+	} else {
+		frame.Write(payload)
+	}
+	_, err := w.Write(frame.Bytes())
+	return err
+}
+
+// readWSFrame reads a single WebSocket frame, unmasking its payload
+func readWSFrame(r *bufio.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext uint16
+		binary.Read(r, binary.BigEndian, &ext)
+		length = uint64(ext)
+	case 127:
+		binary.Read(r, binary.BigEndian, &length)
+	}
+	var mask [4]byte
+	if header[1]&0x80 != 0 {
+		io.ReadFull(r, mask[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if header[1]&0x80 != 0 {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return header[0] & 0x0f, payload, nil
+}
+
+func closePayload(code uint16, reason string) []byte {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	return append(payload, reason...)
+}
+
+// dialWebSocket opens a WebSocket through the proxy and returns the connection after the 101
+func dialWebSocket(t *testing.T, proxyURL, path string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(proxyURL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: proxy\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Protocol: realtime\r\nSec-WebSocket-Extensions: permessage-deflate\r\n"+
+		"Authorization: Bearer sk-secret-key\r\n\r\n", path)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", resp.StatusCode)
+	}
+	return conn, reader
+}
+
+// TestHandlerWebSocketSession verifies realtime sessions are relayed and audited as one entry
+func TestHandlerWebSocketSession(t *testing.T) {
+	clientAudio := []byte{0, 1, 2, 3}
+	serverAudio := []byte{10, 11, 12, 13, 14, 15}
+
+	extensions := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extensions <- r.Header.Get("Sec-WebSocket-Extensions")
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\nSec-WebSocket-Protocol: realtime\r\n\r\n")
+		rw.Flush()
+
+		// session.update and input_audio_buffer.append
+		for i := 0; i < 2; i++ {
+			if _, _, err := readWSFrame(rw.Reader); err != nil {
+				return
+			}
+		}
+
+		delta := fmt.Sprintf(`{"type":"response.output_audio.delta","delta":"%s"}`, base64.StdEncoding.EncodeToString(serverAudio))
+		writeWSFrame(conn, true, wsOpText, []byte(delta), false)
+
+		// A fragmented message with a ping between its fragments
+		writeWSFrame(conn, false, wsOpText, []byte(`{"type":"respo`), false)
+		writeWSFrame(conn, true, wsOpPing, nil, false)
+		writeWSFrame(conn, true, wsOpContinuation, []byte(`nse.done"}`), false)
+
+		// Echo the client's close
+		for {
+			opcode, payload, err := readWSFrame(rw.Reader)
+			if err != nil {
+				return
+			}
+			if opcode == wsOpClose {
+				writeWSFrame(conn, true, wsOpClose, payload, false)
+				return
+			}
+		}
+	}))
+	defer backend.Close()
+
+	mediaDir := t.TempDir()
+	cfg := createTestConfig(backend.URL)
+	cfg.Media = config.MediaConfig{EnableExtraction: true, StoragePath: mediaDir}
+
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(cfg, worker)
+	defer handler.Shutdown()
+	proxyServer := httptest.NewServer(handler)
+	defer proxyServer.Close()
+
+	conn, reader := dialWebSocket(t, proxyServer.URL, "/test/v1/realtime?model=gpt-realtime")
+	defer conn.Close()
+
+	if ext := <-extensions; ext != "" {
+		t.Errorf("Expected compression negotiation to be stripped, got %q", ext)
+	}
+
+	writeWSFrame(conn, true, wsOpText, []byte(`{"type":"session.update","session":{"voice":"alloy"}}`), true)
+	appendEvent := fmt.Sprintf(`{"type":"input_audio_buffer.append","audio":"%s"}`, base64.StdEncoding.EncodeToString(clientAudio))
+	writeWSFrame(conn, true, wsOpText, []byte(appendEvent), true)
+
+	// Frames reach the client unchanged
+	for _, want := range []byte{wsOpText, wsOpText, wsOpPing, wsOpContinuation} {
+		opcode, _, err := readWSFrame(reader)
+		if err != nil {
+			t.Fatalf("Failed to read relayed frame: %v", err)
+		}
+		if opcode != want {
+			t.Fatalf("Expected opcode %d, got %d", want, opcode)
+		}
+	}
+
+	writeWSFrame(conn, true, wsOpClose, closePayload(1000, "done"), true)
+	if opcode, _, err := readWSFrame(reader); err != nil || opcode != wsOpClose {
+		t.Fatalf("Expected close frame, got %d: %v", opcode, err)
+	}
+	conn.Close()
+
+	time.Sleep(200 * time.Millisecond)
+
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
+	}
+	entry := storage.Entries()[0]
+	if entry.Response.StatusCode != http.StatusSwitchingProtocols || !entry.Response.IsComplete {
+		t.Errorf("Expected complete 101 session, got status=%d complete=%v error=%s",
+			entry.Response.StatusCode, entry.Response.IsComplete, entry.Response.Error)
+	}
+	if entry.Request.Headers["Authorization"][0] == "Bearer sk-secret-key" {
+		t.Error("Authorization header should be sanitized")
+	}
+
+	session := entry.WebSocket
+	if session == nil {
+		t.Fatal("Expected WebSocket session in audit entry")
+	}
+	if session.Subprotocol != "realtime" || session.ClientMessages != 2 || session.ServerMessages != 2 {
+		t.Errorf("Unexpected session summary: %+v", session)
+	}
+	if session.ClosedBy != models.WebSocketClient || session.CloseCode != 1000 || session.CloseReason != "done" {
+		t.Errorf("Expected client close 1000 done, got %s %d %q", session.ClosedBy, session.CloseCode, session.CloseReason)
+	}
+
+	var types []string
+	for _, ev := range session.Events {
+		types = append(types, ev.Direction+":"+ev.Opcode+":"+ev.Type)
+	}
+	want := []string{
+		"client:text:session.update",
+		"client:text:input_audio_buffer.append",
+		"server:text:response.output_audio.delta",
+		"server:ping:",
+		"server:text:response.done",
+		"client:close:",
+		"server:close:",
+	}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("Unexpected events:\n got %v\nwant %v", types, want)
+	}
+
+	if got := session.Events[1].Payload; got != `{"type":"input_audio_buffer.append","audio":"[AUDIO_EXTRACTED:client:0-4]"}` {
+		t.Errorf("Client audio not replaced: %s", got)
+	}
+	if got := session.Events[2].Payload; !strings.Contains(got, `"[AUDIO_EXTRACTED:server:0-6]"`) {
+		t.Errorf("Server audio not replaced: %s", got)
+	}
+	if got := session.Events[4].Payload; got != `{"type":"response.done"}` {
+		t.Errorf("Fragmented message not reassembled: %s", got)
+	}
+
+	if len(session.Audio) != 2 {
+		t.Fatalf("Expected 2 audio tracks, got %d", len(session.Audio))
+	}
+	for i, want := range [][]byte{clientAudio, serverAudio} {
+		data, err := os.ReadFile(filepath.Join(mediaDir, session.Audio[i].FilePath))
+		if err != nil || !bytes.Equal(data, want) {
+			t.Errorf("Audio track %d not stored correctly: %v %v", i, data, err)
+		}
+	}
+}
+
+// TestHandlerWebSocketAbnormalClosure verifies sessions dropped without a close handshake are flagged
+func TestHandlerWebSocketAbnormalClosure(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		writeWSFrame(conn, true, wsOpBinary, []byte{1, 2, 3}, false)
+		conn.Close()
+	}))
+	defer backend.Close()
+
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(createTestConfig(backend.URL), worker)
+	defer handler.Shutdown()
+	proxyServer := httptest.NewServer(handler)
+	defer proxyServer.Close()
+
+	conn, reader := dialWebSocket(t, proxyServer.URL, "/test/v1/realtime")
+	defer conn.Close()
+	if _, _, err := readWSFrame(reader); err != nil {
+		t.Fatalf("Failed to read relayed frame: %v", err)
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("Expected connection to close, got %v", err)
+	}
+	// The session ends once the client hangs up too
+	conn.Close()
+
+	time.Sleep(200 * time.Millisecond)
+
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
+	}
+	entry := storage.Entries()[0]
+	if entry.Response.IsComplete || entry.Response.Error != "ABNORMAL_CLOSURE" {
+		t.Errorf("Expected abnormal closure, got complete=%v error=%s", entry.Response.IsComplete, entry.Response.Error)
+	}
+	events := entry.WebSocket.Events
+	if len(events) != 1 || events[0].Opcode != "binary" || events[0].Payload != "AQID" {
+		t.Errorf("Expected one Base64 binary event, got %+v", events)
+	}
+}
+
+// TestHandlerWebSocketRefused verifies a refused upgrade is audited as a regular response
+func TestHandlerWebSocketRefused(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"invalid key"}`))
+	}))
+	defer backend.Close()
+
+	storage := &mockAuditStorage{}
+	worker := audit.NewWorker(storage, "test-seed", 10)
+	defer worker.Shutdown()
+
+	handler := NewHandler(createTestConfig(backend.URL), worker)
+	defer handler.Shutdown()
+
+	req := httptest.NewRequest("GET", "/test/v1/realtime", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401, got %d", w.Code)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if len(storage.Entries()) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(storage.Entries()))
+	}
+	entry := storage.Entries()[0]
+	if entry.WebSocket != nil || entry.Response.Body != `{"error":"invalid key"}` {
+		t.Errorf("Expected regular response entry, got %+v", entry.Response)
+	}
+}
+
+// TestFrameParser verifies messages are reassembled from frames split at arbitrary points
+func TestFrameParser(t *testing.T) {
+	var stream bytes.Buffer
+	long := bytes.Repeat([]byte("x"), 70000)
+	writeWSFrame(&stream, true, wsOpText, []byte("hello"), true)
+	writeWSFrame(&stream, true, wsOpBinary, long, true)
+	writeWSFrame(&stream, true, wsOpClose, closePayload(1001, ""), false)
+
+	type message struct {
+		opcode    byte
+		payload   string
+		size      int64
+		truncated bool
+	}
+	var got []message
+	parser := newFrameParser(1000, func(opcode byte, payload []byte, size int64, truncated bool) {
+		got = append(got, message{opcode, string(payload), size, truncated})
+	})
+
+	// Feed the stream a few bytes at a time
+	data := stream.Bytes()
+	for len(data) > 0 {
+		n := min(len(data), 3)
+		parser.feed(data[:n])
+		data = data[n:]
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(got))
+	}
+	if got[0] != (message{wsOpText, "hello", 5, false}) {
+		t.Errorf("Unexpected text message: %+v", got[0])
+	}
+	if got[1].opcode != wsOpBinary || got[1].size != 70000 || len(got[1].payload) != 1000 || !got[1].truncated {
+		t.Errorf("Expected truncated 70000-byte binary message, got size=%d kept=%d truncated=%v",
+			got[1].size, len(got[1].payload), got[1].truncated)
+	}
+	if got[2].opcode != wsOpClose || binary.BigEndian.Uint16([]byte(got[2].payload)) != 1001 {
+		t.Errorf("Unexpected close message: %+v", got[2])
+	}
+}
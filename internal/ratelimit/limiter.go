@@ -0,0 +1,217 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+// sweepInterval is how often idle buckets are dropped to bound memory
+const sweepInterval = time.Minute
+
+// Subject identifies who a request is counted against
+type Subject struct {
+	Endpoint string
+	Client   string // Configured client header value or API key fingerprint
+}
+
+// Violation describes a reached limit
+type Violation struct {
+	Rule       string
+	Scope      string
+	Limit      string // "requests_per_second" or "concurrent_streams"
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface with a message suitable for API clients
+func (v *Violation) Error() string {
+	if v.Limit == "concurrent_streams" {
+		return fmt.Sprintf("rate limit %q reached for this %s: too many concurrent streams", v.Rule, v.Scope)
+	}
+	return fmt.Sprintf("rate limit %q reached for this %s: too many requests, retry after %s", v.Rule, v.Scope, v.RetryAfter)
+}
+
+// bucket is a token bucket refilled at the rule's request rate
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter enforces token-bucket request rates and concurrent stream limits
+type Limiter struct {
+	rules []config.RateLimitRule
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	streams   map[string]int
+	lastSweep time.Time
+}
+
+// NewLimiter creates a limiter for the configured rules
+func NewLimiter(rules []config.RateLimitRule) *Limiter {
+	return &Limiter{
+		rules:   rules,
+		buckets: make(map[string]*bucket),
+		streams: make(map[string]int),
+	}
+}
+
+// SetRules replaces the configured rules when the configuration is reloaded
+// Buckets and open stream slots of rules that keep their name carry over
+func (l *Limiter) SetRules(rules []config.RateLimitRule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rules = rules
+	for id := range l.buckets {
+		name, _, _ := strings.Cut(id, "\x00")
+		if !slices.ContainsFunc(rules, func(r config.RateLimitRule) bool { return r.Name == name }) {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// Allow takes one request token from every rate limit that applies to the subject
+// For streaming requests a stream slot is also reserved; the returned release function
+// frees it and must be called once the stream ends (it is a no-op otherwise)
+// No tokens or slots are consumed when a limit is reached
+func (l *Limiter) Allow(subject Subject, streaming bool, now time.Time) (func(), *Violation) {
+	noop := func() {}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.rules) == 0 {
+		return noop, nil
+	}
+
+	l.sweep(now)
+
+	// First pass: check every applicable limit without consuming anything
+	type match struct {
+		rule   config.RateLimitRule
+		id     string
+		bucket *bucket
+	}
+	var matches []match
+	for _, rule := range l.rules {
+		key, ok := scopeKey(rule, subject)
+		if !ok {
+			continue
+		}
+		id := rule.Name + "\x00" + key
+		m := match{rule: rule, id: id}
+
+		if rule.RequestsPerSecond > 0 {
+			m.bucket = l.refill(id, rule, now)
+			if m.bucket.tokens < 1 {
+				wait := time.Duration((1 - m.bucket.tokens) / rule.RequestsPerSecond * float64(time.Second))
+				return noop, &Violation{Rule: rule.Name, Scope: rule.Scope, Limit: "requests_per_second", RetryAfter: wait}
+			}
+		}
+
+		if streaming && rule.MaxConcurrentStreams > 0 && l.streams[id] >= rule.MaxConcurrentStreams {
+			return noop, &Violation{Rule: rule.Name, Scope: rule.Scope, Limit: "concurrent_streams", RetryAfter: time.Second}
+		}
+
+		matches = append(matches, m)
+	}
+
+	// Second pass: consume tokens and reserve stream slots
+	var reserved []string
+	for _, m := range matches {
+		if m.bucket != nil {
+			m.bucket.tokens--
+		}
+		if streaming && m.rule.MaxConcurrentStreams > 0 {
+			l.streams[m.id]++
+			reserved = append(reserved, m.id)
+		}
+	}
+
+	if len(reserved) == 0 {
+		return noop, nil
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			for _, id := range reserved {
+				if l.streams[id]--; l.streams[id] <= 0 {
+					delete(l.streams, id)
+				}
+			}
+		})
+	}, nil
+}
+
+// refill returns the bucket for id topped up for the time elapsed since its last use
+func (l *Limiter) refill(id string, rule config.RateLimitRule, now time.Time) *bucket {
+	capacity := burst(rule)
+
+	b := l.buckets[id]
+	if b == nil {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[id] = b
+		return b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*rule.RequestsPerSecond)
+		b.last = now
+	}
+	return b
+}
+
+// sweep drops buckets that have been idle long enough to be full again
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for _, rule := range l.rules {
+		if rule.RequestsPerSecond <= 0 {
+			continue
+		}
+		refillTime := time.Duration(burst(rule) / rule.RequestsPerSecond * float64(time.Second))
+		prefix := rule.Name + "\x00"
+		for id, b := range l.buckets {
+			if strings.HasPrefix(id, prefix) && now.Sub(b.last) >= refillTime {
+				delete(l.buckets, id)
+			}
+		}
+	}
+}
+
+// burst is the bucket capacity of a rule
+func burst(rule config.RateLimitRule) float64 {
+	if rule.Burst > 0 {
+		return float64(rule.Burst)
+	}
+	return math.Max(1, math.Ceil(rule.RequestsPerSecond))
+}
+
+// scopeKey returns the key a rule counts the subject under
+// False if the rule does not apply (endpoint not listed or no client identity)
+func scopeKey(rule config.RateLimitRule, subject Subject) (string, bool) {
+	if len(rule.Endpoints) > 0 && !slices.Contains(rule.Endpoints, subject.Endpoint) {
+		return "", false
+	}
+
+	var key string
+	switch rule.Scope {
+	case config.RateLimitScopeEndpoint:
+		key = subject.Endpoint
+	case config.RateLimitScopeClient:
+		key = subject.Client
+	}
+	return key, key != ""
+}
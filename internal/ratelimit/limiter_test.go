@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+// TestLimiterRequestRate verifies the token bucket allows a burst then refills at the configured rate
+func TestLimiterRequestRate(t *testing.T) {
+	limiter := NewLimiter([]config.RateLimitRule{
+		{Name: "per-endpoint", Scope: config.RateLimitScopeEndpoint, RequestsPerSecond: 2, Burst: 3},
+	})
+	subject := Subject{Endpoint: "openai"}
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if _, v := limiter.Allow(subject, false, now); v != nil {
+			t.Fatalf("Request %d within burst should be allowed: %v", i, v)
+		}
+	}
+
+	_, v := limiter.Allow(subject, false, now)
+	if v == nil {
+		t.Fatal("Expected rate limit violation after burst")
+	}
+	if v.Limit != "requests_per_second" || v.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Unexpected violation: %+v", v)
+	}
+
+	// One token is back after half a second at 2 requests/sec
+	if _, v := limiter.Allow(subject, false, now.Add(500*time.Millisecond)); v != nil {
+		t.Errorf("Request after refill should be allowed: %v", v)
+	}
+
+	// Other endpoints have their own bucket
+	if _, v := limiter.Allow(Subject{Endpoint: "anthropic"}, false, now); v != nil {
+		t.Errorf("Other endpoint should not be limited: %v", v)
+	}
+}
+
+// TestLimiterConcurrentStreams verifies stream slots are held until released
+func TestLimiterConcurrentStreams(t *testing.T) {
+	limiter := NewLimiter([]config.RateLimitRule{
+		{Name: "streams", Scope: config.RateLimitScopeClient, MaxConcurrentStreams: 2},
+	})
+	subject := Subject{Endpoint: "openai", Client: "agent-1"}
+	now := time.Now()
+
+	release1, v := limiter.Allow(subject, true, now)
+	if v != nil {
+		t.Fatalf("First stream should be allowed: %v", v)
+	}
+	if _, v := limiter.Allow(subject, true, now); v != nil {
+		t.Fatalf("Second stream should be allowed: %v", v)
+	}
+
+	if _, v := limiter.Allow(subject, true, now); v == nil || v.Limit != "concurrent_streams" {
+		t.Fatalf("Expected concurrent stream violation, got %v", v)
+	}
+
+	// Non-streaming requests are not counted as streams
+	if _, v := limiter.Allow(subject, false, now); v != nil {
+		t.Errorf("Non-streaming request should be allowed: %v", v)
+	}
+
+	// Releasing is idempotent and frees exactly one slot
+	release1()
+	release1()
+	if _, v := limiter.Allow(subject, true, now); v != nil {
+		t.Errorf("Stream should be allowed after release: %v", v)
+	}
+	if _, v := limiter.Allow(subject, true, now); v == nil {
+		t.Error("Double release should not free a second slot")
+	}
+}
+
+// TestLimiterRejectionConsumesNothing verifies a rejected request does not use up other limits
+func TestLimiterRejectionConsumesNothing(t *testing.T) {
+	limiter := NewLimiter([]config.RateLimitRule{
+		{Name: "endpoint", Scope: config.RateLimitScopeEndpoint, RequestsPerSecond: 1, Burst: 2},
+		{Name: "client", Scope: config.RateLimitScopeClient, RequestsPerSecond: 1, Burst: 1},
+	})
+	now := time.Now()
+
+	if _, v := limiter.Allow(Subject{Endpoint: "openai", Client: "a"}, false, now); v != nil {
+		t.Fatalf("First request should be allowed: %v", v)
+	}
+	if _, v := limiter.Allow(Subject{Endpoint: "openai", Client: "a"}, false, now); v == nil || v.Rule != "client" {
+		t.Fatalf("Expected client limit violation, got %v", v)
+	}
+
+	// The rejected request must not have taken the endpoint's second token
+	if _, v := limiter.Allow(Subject{Endpoint: "openai", Client: "b"}, false, now); v != nil {
+		t.Errorf("Endpoint token should still be available: %v", v)
+	}
+}
+
+// TestLimiterUnidentifiedClient verifies client rules skip requests without an identity
+func TestLimiterUnidentifiedClient(t *testing.T) {
+	limiter := NewLimiter([]config.RateLimitRule{
+		{Name: "client", Scope: config.RateLimitScopeClient, RequestsPerSecond: 1},
+	})
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		if _, v := limiter.Allow(Subject{Endpoint: "openai"}, false, now); v != nil {
+			t.Fatalf("Unidentified client should not be limited: %v", v)
+		}
+	}
+}
+
+// TestLimiterSetRules verifies reloaded rules keep the state of rules that still exist
+func TestLimiterSetRules(t *testing.T) {
+	limiter := NewLimiter(nil)
+	subject := Subject{Endpoint: "openai", Client: "agent-1"}
+	now := time.Now()
+
+	limiter.SetRules([]config.RateLimitRule{
+		{Name: "streams", Scope: config.RateLimitScopeClient, MaxConcurrentStreams: 1},
+	})
+	release, v := limiter.Allow(subject, true, now)
+	if v != nil {
+		t.Fatalf("First stream should be allowed: %v", v)
+	}
+
+	// The open stream still counts after a reload that adds a rule
+	limiter.SetRules([]config.RateLimitRule{
+		{Name: "streams", Scope: config.RateLimitScopeClient, MaxConcurrentStreams: 1},
+		{Name: "per-endpoint", Scope: config.RateLimitScopeEndpoint, RequestsPerSecond: 1, Burst: 1},
+	})
+	if _, v := limiter.Allow(subject, true, now); v == nil || v.Rule != "streams" {
+		t.Fatalf("Expected concurrent stream violation, got %v", v)
+	}
+	release()
+
+	if _, v := limiter.Allow(subject, false, now); v != nil {
+		t.Fatalf("Request should be allowed: %v", v)
+	}
+	if _, v := limiter.Allow(subject, false, now); v == nil || v.Rule != "per-endpoint" {
+		t.Errorf("Expected request rate violation, got %v", v)
+	}
+
+	limiter.SetRules(nil)
+	if _, v := limiter.Allow(subject, false, now); v != nil {
+		t.Errorf("Removed rules should not limit: %v", v)
+	}
+}
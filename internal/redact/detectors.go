@@ -0,0 +1,92 @@
+package redact
+
+import (
+	"regexp"
+	"strings"
+)
+
+// detector finds one kind of sensitive value
+type detector struct {
+	name string
+	re   *regexp.Regexp
+
+	// validate rejects matches that only look like the value (e.g. card numbers failing Luhn)
+	validate func(string) bool
+}
+
+// builtinDetectors are the detectors listed in config.RedactionDetectors
+// Overlapping matches are resolved in favor of the earlier, then longer match, then the detector listed first,
+// so the specific key formats come before the generic ones (anthropic_key before openai_key)
+var builtinDetectors = []detector{
+	{name: "private_key", re: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY-----[\s\S]*?-----END (?:[A-Z]+ )*PRIVATE KEY-----`)},
+	{name: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{name: "aws_access_key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{name: "github_token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`)},
+	{name: "anthropic_key", re: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{name: "openai_key", re: regexp.MustCompile(`\bsk-(?:proj-|svcacct-|admin-)?[A-Za-z0-9_-]{20,}`)},
+	{name: "google_api_key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{name: "slack_token", re: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{name: "stripe_key", re: regexp.MustCompile(`\b(?:sk|rk)_live_[0-9A-Za-z]{24,}`)},
+	{name: "email", re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)},
+	{name: "ssn", re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), validate: validSSN},
+	{name: "credit_card", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), validate: validLuhn},
+}
+
+// validators are the checksum validators available to custom patterns
+var validators = map[string]func(string) bool{
+	"luhn": validLuhn,
+}
+
+// validLuhn reports whether the digits of s pass the Luhn checksum used by card numbers
+// Separators are ignored; fewer than 13 or more than 19 digits never pass
+func validLuhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// validSSN rejects numbers never issued as US Social Security numbers
+// (area 000, 666 or 900-999, group 00, serial 0000)
+func validSSN(s string) bool {
+	if len(s) != 11 {
+		return false
+	}
+	area, group, serial := s[0:3], s[4:6], s[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// escapeSafeStart moves a match start forward so it does not split a JSON escape sequence
+// (such as \n or \u00e9) in front of it, so bodies stay valid JSON after the replacement
+func escapeSafeStart(text string, start, end int) int {
+	// Odd number of backslashes before start: the first matched byte is an escaped character
+	backslashes := 0
+	for i := start - 1; i >= 0 && text[i] == '\\'; i-- {
+		backslashes++
+	}
+	if backslashes%2 == 1 {
+		return min(start+1, end)
+	}
+
+	// Inside the hex digits of a \uXXXX escape
+	if i := strings.LastIndex(text[max(0, start-5):start], `\u`); i >= 0 {
+		escapeStart := max(0, start-5) + i
+		if escapeStart+6 > start {
+			return min(escapeStart+6, end)
+		}
+	}
+	return start
+}
@@ -0,0 +1,159 @@
+package redact
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+)
+
+// Redactor replaces personal data and secrets in audited bodies
+// A nil Redactor (redaction disabled) returns bodies unchanged
+type Redactor struct {
+	detectors []detector
+
+	// vault holds the original values in tokenize mode; nil in mask mode
+	vault *Vault
+}
+
+// match is a detected value in the original text
+type match struct {
+	start, end int
+	detector   int // Index into Redactor.detectors
+}
+
+// New builds the redactor for cfg, or returns nil if redaction is disabled
+// vaultKey is the resolved redaction.vault_key, only used in tokenize mode
+func New(cfg config.RedactionConfig, vaultKey string) (*Redactor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	r := &Redactor{}
+	for _, d := range builtinDetectors {
+		if len(cfg.Detectors) == 0 || slices.Contains(cfg.Detectors, d.name) {
+			r.detectors = append(r.detectors, d)
+		}
+	}
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s: %w", p.Name, err)
+		}
+		r.detectors = append(r.detectors, detector{name: p.Name, re: re, validate: validators[p.Validator]})
+	}
+
+	if cfg.Mode == config.RedactionModeTokenize {
+		vault, err := OpenVault(cfg.VaultPath, []byte(vaultKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open redaction vault: %w", err)
+		}
+		r.vault = vault
+	}
+
+	return r, nil
+}
+
+// Redact returns text with every detected value replaced, and where each replacement was made
+// location names the body in the findings, e.g. "request.body"
+// Offsets in the findings refer to the returned text
+func (r *Redactor) Redact(text, location string) (string, []models.RedactionFinding) {
+	if r == nil || text == "" {
+		return text, nil
+	}
+
+	matches := r.find(text)
+	if len(matches) == 0 {
+		return text, nil
+	}
+
+	var out strings.Builder
+	out.Grow(len(text))
+	findings := make([]models.RedactionFinding, 0, len(matches))
+	prev := 0
+	for _, m := range matches {
+		out.WriteString(text[prev:m.start])
+
+		name := r.detectors[m.detector].name
+		finding := models.RedactionFinding{Detector: name, Location: location, Start: out.Len()}
+		replacement := "[REDACTED:" + name + "]"
+		if r.vault != nil {
+			token, err := r.vault.Tokenize(name, text[m.start:m.end])
+			if err != nil {
+				// Never fall back to the original value
+				log.Printf("WARNING: Redaction vault unavailable, masking instead of tokenizing: %v", err)
+			} else {
+				replacement = "[TOKEN:" + name + ":" + token + "]"
+				finding.Token = token
+			}
+		}
+		out.WriteString(replacement)
+		finding.End = out.Len()
+
+		findings = append(findings, finding)
+		prev = m.end
+	}
+	out.WriteString(text[prev:])
+
+	return out.String(), findings
+}
+
+// Detect returns the names of the detectors firing in text, without replacing anything
+func (r *Redactor) Detect(text string) []string {
+	if r == nil || text == "" {
+		return nil
+	}
+
+	var names []string
+	for _, m := range r.find(text) {
+		if name := r.detectors[m.detector].name; !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// find returns the non-overlapping matches of all detectors in text order
+// Overlaps are resolved in favor of the earlier, then the longer match, then the detector listed first
+func (r *Redactor) find(text string) []match {
+	var candidates []match
+	for i, d := range r.detectors {
+		for _, loc := range d.re.FindAllStringIndex(text, -1) {
+			start := escapeSafeStart(text, loc[0], loc[1])
+			if start == loc[1] {
+				continue
+			}
+			if d.validate != nil && !d.validate(text[start:loc[1]]) {
+				continue
+			}
+			candidates = append(candidates, match{start: start, end: loc[1], detector: i})
+		}
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		ca, cb := candidates[a], candidates[b]
+		if ca.start != cb.start {
+			return ca.start < cb.start
+		}
+		if ca.end != cb.end {
+			return ca.end > cb.end
+		}
+		return ca.detector < cb.detector
+	})
+
+	var matches []match
+	end := 0
+	for _, c := range candidates {
+		if c.start < end {
+			continue
+		}
+		matches = append(matches, c)
+		end = c.end
+	}
+	return matches
+}
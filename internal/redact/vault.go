@@ -0,0 +1,189 @@
+package redact
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrTokenNotFound is returned by Lookup for tokens the vault does not hold
+var ErrTokenNotFound = errors.New("token not found in vault")
+
+// vaultRecord is one line of the vault file
+type vaultRecord struct {
+	Token    string `json:"token"`
+	Detector string `json:"detector"`
+
+	// Value is the AES-256-GCM encrypted original value (nonce followed by ciphertext),
+	// authenticated together with the token
+	Value []byte `json:"value"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Vault stores the original values of tokenized redactions, encrypted, in a JSONL file
+// kept apart from the audit log; whoever holds the vault file and key can reverse a token
+type Vault struct {
+	path     string
+	tokenKey []byte
+	aead     cipher.AEAD
+
+	mu    sync.Mutex
+	known map[string]bool // Tokens already in the file
+}
+
+// OpenVault opens (or creates) the vault file at path
+// key keys the tokens and encrypts the stored values; it must stay the same for the lifetime of the vault
+func OpenVault(path string, key []byte) (*Vault, error) {
+	if len(key) == 0 {
+		return nil, errors.New("vault key cannot be empty")
+	}
+
+	aead, err := cipher.NewGCM(mustAES(deriveKey(key, "aiblackbox-redaction-vault")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize vault cipher: %w", err)
+	}
+	v := &Vault{
+		path:     path,
+		tokenKey: deriveKey(key, "aiblackbox-redaction-token"),
+		aead:     aead,
+		known:    make(map[string]bool),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create vault directory: %w", err)
+	}
+	err = v.scan(func(rec vaultRecord) bool {
+		v.known[rec.Token] = true
+		return true
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return v, nil
+}
+
+// deriveKey derives a purpose-specific 32-byte key from the vault key
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// mustAES creates an AES cipher from a derived 32-byte key, which cannot fail
+func mustAES(key []byte) cipher.Block {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(fmt.Sprintf("redact: invalid derived key: %v", err))
+	}
+	return block
+}
+
+// Tokenize returns the token for value, storing the value in the vault on first use
+// Tokens are deterministic, so the same value found by the same detector always gets the same token
+func (v *Vault) Tokenize(detectorName, value string) (string, error) {
+	mac := hmac.New(sha256.New, v.tokenKey)
+	mac.Write([]byte(detectorName))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	token := hex.EncodeToString(mac.Sum(nil)[:8])
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.known[token] {
+		return token, nil
+	}
+
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate vault nonce: %w", err)
+	}
+	rec := vaultRecord{
+		Token:     token,
+		Detector:  detectorName,
+		Value:     v.aead.Seal(nonce, nonce, []byte(value), []byte(token)),
+		CreatedAt: time.Now().UTC(),
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal vault record: %w", err)
+	}
+
+	// Opened per write so configuration reloads never leave handles behind
+	file, err := os.OpenFile(v.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to open vault: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return "", fmt.Errorf("failed to write vault: %w", err)
+	}
+
+	v.known[token] = true
+	return token, nil
+}
+
+// Lookup returns the detector and original value of a token
+func (v *Vault) Lookup(token string) (detectorName, value string, err error) {
+	var found *vaultRecord
+	err = v.scan(func(rec vaultRecord) bool {
+		if rec.Token == token {
+			found = &rec
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if found == nil {
+		return "", "", ErrTokenNotFound
+	}
+
+	nonceSize := v.aead.NonceSize()
+	if len(found.Value) < nonceSize {
+		return "", "", fmt.Errorf("corrupt vault record for token %s", token)
+	}
+	plain, err := v.aead.Open(nil, found.Value[:nonceSize], found.Value[nonceSize:], []byte(token))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decrypt token %s (wrong vault key?): %w", token, err)
+	}
+	return found.Detector, string(plain), nil
+}
+
+// scan calls fn with every record in the vault file until fn returns false
+func (v *Vault) scan(fn func(vaultRecord) bool) error {
+	file, err := os.Open(v.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec vaultRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("invalid vault record at line %d: %w", line, err)
+		}
+		if !fn(rec) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,89 @@
+package redact
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+// TestTokenizeRoundTrip verifies tokens are deterministic and reversible with the vault key
+func TestTokenizeRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault", "redaction.jsonl")
+	vault, err := OpenVault(path, []byte("vault-key"))
+	if err != nil {
+		t.Fatalf("Failed to open vault: %v", err)
+	}
+
+	token, err := vault.Tokenize("email", "jane@example.com")
+	if err != nil {
+		t.Fatalf("Failed to tokenize: %v", err)
+	}
+	again, _ := vault.Tokenize("email", "jane@example.com")
+	if again != token {
+		t.Errorf("Expected the same token for the same value, got %s and %s", token, again)
+	}
+	other, _ := vault.Tokenize("email", "john@example.com")
+	if other == token {
+		t.Error("Expected different tokens for different values")
+	}
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("Expected 2 vault records, got %d", lines)
+	}
+	if strings.Contains(string(data), "jane@example.com") {
+		t.Error("Vault must not store values in plain text")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected vault file mode 0600, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	// A reopened vault reverses the token
+	reopened, err := OpenVault(path, []byte("vault-key"))
+	if err != nil {
+		t.Fatalf("Failed to reopen vault: %v", err)
+	}
+	detectorName, value, err := reopened.Lookup(token)
+	if err != nil || detectorName != "email" || value != "jane@example.com" {
+		t.Errorf("Expected email jane@example.com, got %s %q (%v)", detectorName, value, err)
+	}
+	if _, _, err := reopened.Lookup("0000000000000000"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Expected ErrTokenNotFound, got %v", err)
+	}
+
+	// The wrong key cannot decrypt
+	wrong, _ := OpenVault(path, []byte("other-key"))
+	if _, _, err := wrong.Lookup(token); err == nil {
+		t.Error("Expected error looking up a token with the wrong key")
+	}
+}
+
+// TestRedactTokenize verifies tokenize mode replaces values with reversible tokens
+func TestRedactTokenize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redaction.jsonl")
+	r, err := New(config.RedactionConfig{Enabled: true, Mode: config.RedactionModeTokenize, VaultPath: path}, "vault-key")
+	if err != nil {
+		t.Fatalf("Failed to create redactor: %v", err)
+	}
+
+	redacted, findings := r.Redact("contact jane@example.com", "request.body")
+	if len(findings) != 1 || findings[0].Token == "" {
+		t.Fatalf("Expected one finding with a token, got %+v", findings)
+	}
+	if want := "contact [TOKEN:email:" + findings[0].Token + "]"; redacted != want {
+		t.Errorf("Expected %q, got %q", want, redacted)
+	}
+
+	_, value, err := r.vault.Lookup(findings[0].Token)
+	if err != nil || value != "jane@example.com" {
+		t.Errorf("Expected the token to reverse to the email, got %q (%v)", value, err)
+	}
+
+	if _, err := New(config.RedactionConfig{Enabled: true, Mode: config.RedactionModeTokenize, VaultPath: path}, ""); err == nil {
+		t.Error("Expected error for tokenize mode without a vault key")
+	}
+}
@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// referencePattern matches ${env:NAME} and ${secret:NAME} references in header values
+var referencePattern = regexp.MustCompile(`\$\{([a-z]+):([^}]*)\}`)
+
+// Store resolves credential references against environment variables and a secrets file
+// Resolved values must never be logged or written to the audit trail
+type Store struct {
+	path   string
+	values *viper.Viper
+}
+
+// Load reads the secrets file (YAML, JSON, TOML or .env, chosen by extension)
+// An empty path yields a store that only resolves environment variables
+func Load(path string) (*Store, error) {
+	s := &Store{path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read secrets file %s: %w", path, err)
+	}
+	s.values = v
+	return s, nil
+}
+
+// Expand replaces every ${env:NAME} and ${secret:NAME} reference in template
+// Text outside references is kept as is, so "Bearer ${env:OPENAI_API_KEY}" yields a bearer token
+// Unset or empty variables and secrets are errors rather than silently empty credentials
+func (s *Store) Expand(template string) (string, error) {
+	var firstErr error
+	result := referencePattern.ReplaceAllStringFunc(template, func(ref string) string {
+		m := referencePattern.FindStringSubmatch(ref)
+		value, err := s.lookup(m[1], m[2])
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return value
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return result, nil
+}
+
+// lookup resolves a single reference
+func (s *Store) lookup(kind, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty %s reference", kind)
+	}
+
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case "secret":
+		if s.values == nil {
+			return "", fmt.Errorf("secret %s referenced but no secrets file is configured", name)
+		}
+		// Keys are case-insensitive; nested YAML/JSON keys are addressed with dots
+		value := strings.TrimSpace(s.values.GetString(name))
+		if value == "" {
+			return "", fmt.Errorf("secret %s not found in %s", name, s.path)
+		}
+		return value, nil
+	default:
+		return "", fmt.Errorf("unknown reference type %q (must be env or secret)", kind)
+	}
+}
+
+// HasReference reports whether template holds at least one ${env:NAME} or ${secret:NAME} reference
+func HasReference(template string) bool {
+	return referencePattern.MatchString(template)
+}
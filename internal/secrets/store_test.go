@@ -0,0 +1,85 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestExpandEnv verifies environment variable references are resolved
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("ABB_TEST_KEY", "sk-test-123")
+
+	store, err := Load("")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	value, err := store.Expand("Bearer ${env:ABB_TEST_KEY}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value != "Bearer sk-test-123" {
+		t.Errorf("Expected expanded bearer token, got %q", value)
+	}
+
+	literal, err := store.Expand("2023-06-01")
+	if err != nil || literal != "2023-06-01" {
+		t.Errorf("Literal values should be kept as is, got %q (%v)", literal, err)
+	}
+
+	if _, err := store.Expand("${env:ABB_TEST_UNSET_KEY}"); err == nil {
+		t.Error("Expected error for unset environment variable")
+	}
+	if _, err := store.Expand("${secret:openai}"); err == nil {
+		t.Error("Expected error for secret reference without secrets file")
+	}
+	if _, err := store.Expand("${vault:openai}"); err == nil {
+		t.Error("Expected error for unknown reference type")
+	}
+}
+
+// TestExpandSecretsFile verifies secrets file references are resolved for each supported format
+func TestExpandSecretsFile(t *testing.T) {
+	tests := []struct {
+		file    string
+		content string
+	}{
+		{"secrets.yaml", "openai: sk-yaml\nazure:\n  key: az-yaml\n"},
+		{"secrets.json", `{"openai": "sk-json", "azure": {"key": "az-json"}}`},
+		{".env", "OPENAI=sk-env\nAZURE.KEY=az-env\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to write secrets file: %v", err)
+			}
+
+			store, err := Load(path)
+			if err != nil {
+				t.Fatalf("Failed to load secrets file: %v", err)
+			}
+
+			openai, err := store.Expand("Bearer ${secret:openai}")
+			if err != nil || openai == "Bearer " || openai[:10] != "Bearer sk-" {
+				t.Errorf("Unexpected openai secret %q (%v)", openai, err)
+			}
+			azure, err := store.Expand("${secret:azure.key}")
+			if err != nil || azure[:3] != "az-" {
+				t.Errorf("Unexpected nested secret %q (%v)", azure, err)
+			}
+			if _, err := store.Expand("${secret:missing}"); err == nil {
+				t.Error("Expected error for missing secret")
+			}
+		})
+	}
+}
+
+// TestLoadMissingFile verifies a configured but missing secrets file is an error
+func TestLoadMissingFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected error for missing secrets file")
+	}
+}
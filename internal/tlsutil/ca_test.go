@@ -0,0 +1,59 @@
+package tlsutil
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadOrCreateCA verifies the CA is generated once, reused, and issues verifiable certificates
+func TestLoadOrCreateCA(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	certFile := filepath.Join(dir, "ca.crt")
+	keyFile := filepath.Join(dir, "ca.key")
+
+	ca, err := LoadOrCreateCA(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("CA key not written: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected CA key permissions 0600, got %o", perm)
+	}
+
+	reloaded, err := LoadOrCreateCA(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load CA: %v", err)
+	}
+	if reloaded.cert.SerialNumber.Cmp(ca.cert.SerialNumber) != 0 {
+		t.Error("Existing CA should be reused, not regenerated")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	for _, host := range []string{"api.openai.com", "10.0.4.12"} {
+		leaf, err := reloaded.Certificate(host)
+		if err != nil {
+			t.Fatalf("Failed to issue certificate for %s: %v", host, err)
+		}
+		if _, err := leaf.Leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("Certificate for %s does not verify against the CA: %v", host, err)
+		}
+		again, _ := reloaded.Certificate(host)
+		if again != leaf {
+			t.Errorf("Certificate for %s should be cached", host)
+		}
+	}
+
+	// A lone certificate must not be replaced by a new CA
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatalf("Failed to remove key: %v", err)
+	}
+	if _, err := LoadOrCreateCA(certFile, keyFile); err == nil {
+		t.Error("Expected error when only the CA certificate exists")
+	}
+}
@@ -0,0 +1,197 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+// reloadCheckInterval bounds how often certificate files are checked for changes
+const reloadCheckInterval = time.Second
+
+// versions maps config min_version values to TLS versions
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// KeyPair is a certificate and private key loaded from PEM files
+// The files are reloaded when they change on disk; a pair that fails to load
+// (e.g. a half-written renewal) is ignored and the previous certificate kept
+type KeyPair struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+	checked time.Time
+}
+
+// LoadKeyPair loads a certificate and key, failing if either file is unreadable or they do not match
+func LoadKeyPair(certFile, keyFile string) (*KeyPair, error) {
+	k := &KeyPair{certFile: certFile, keyFile: keyFile, interval: reloadCheckInterval}
+	certMod, keyMod, err := k.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := k.load(certMod, keyMod); err != nil {
+		return nil, err
+	}
+	k.checked = time.Now()
+	return k, nil
+}
+
+// Certificate returns the current certificate, reloading it if the files changed
+func (k *KeyPair) Certificate() *tls.Certificate {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if now := time.Now(); now.Sub(k.checked) >= k.interval {
+		k.checked = now
+		certMod, keyMod, err := k.modTimes()
+		if err != nil {
+			log.Printf("WARNING: Keeping current certificate %s: %v", k.certFile, err)
+		} else if !certMod.Equal(k.certMod) || !keyMod.Equal(k.keyMod) {
+			if err := k.load(certMod, keyMod); err != nil {
+				log.Printf("WARNING: Keeping current certificate %s: %v", k.certFile, err)
+			} else {
+				log.Printf("Reloaded certificate %s", k.certFile)
+			}
+		}
+	}
+	return k.cert
+}
+
+// GetCertificate serves the current certificate to TLS clients (tls.Config.GetCertificate)
+func (k *KeyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return k.Certificate(), nil
+}
+
+// GetClientCertificate presents the current certificate to TLS servers (tls.Config.GetClientCertificate)
+func (k *KeyPair) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return k.Certificate(), nil
+}
+
+// load parses both files and records their modification times; must be called with k.mu held
+func (k *KeyPair) load(certMod, keyMod time.Time) error {
+	cert, err := tls.LoadX509KeyPair(k.certFile, k.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s: %w", k.certFile, err)
+	}
+	k.cert = &cert
+	k.certMod = certMod
+	k.keyMod = keyMod
+	return nil
+}
+
+func (k *KeyPair) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(k.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(k.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// ServerConfig builds the TLS config for serving HTTPS
+func ServerConfig(cfg config.ServerTLSConfig) (*tls.Config, error) {
+	minVersion, err := ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := LoadKeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: pair.GetCertificate,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pool, err := LoadCertPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	switch cfg.ClientAuth {
+	case config.TLSClientAuthNone:
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case config.TLSClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
+
+// ClientConfig builds the TLS config for connections to an endpoint's targets
+func ClientConfig(cfg config.UpstreamTLSConfig) (*tls.Config, error) {
+	minVersion, err := ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: minVersion,
+		ServerName: cfg.ServerName,
+	}
+	if cfg.CAFile != "" {
+		pool, err := LoadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		pair, err := LoadKeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = pair.GetClientCertificate
+	}
+
+	return tlsConfig, nil
+}
+
+// LoadCertPool reads a PEM bundle of CA certificates
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("CA bundle " + path + " contains no PEM certificates")
+	}
+	return pool, nil
+}
+
+// ParseVersion converts a min_version value to a TLS version; "" yields TLS 1.2
+func ParseVersion(v string) (uint16, error) {
+	if v == "" {
+		return tls.VersionTLS12, nil
+	}
+	version, ok := versions[v]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q", v)
+	}
+	return version, nil
+}
@@ -0,0 +1,180 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+)
+
+// writeCert writes a self-signed certificate and its key with the given common name
+func writeCert(t *testing.T, dir, name, commonName string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return parsed.Subject.CommonName
+}
+
+// touch moves a file's modification time forward so the change is detected on coarse filesystems
+func touch(t *testing.T, path string, offset time.Duration) {
+	t.Helper()
+	when := time.Now().Add(offset)
+	if err := os.Chtimes(path, when, when); err != nil {
+		t.Fatalf("Failed to touch %s: %v", path, err)
+	}
+}
+
+// TestKeyPairReload verifies renewed certificates are picked up and broken ones ignored
+func TestKeyPairReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server", "v1.internal")
+
+	pair, err := LoadKeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load key pair: %v", err)
+	}
+	pair.interval = 0
+	if got := commonName(t, pair.Certificate()); got != "v1.internal" {
+		t.Fatalf("Expected v1.internal, got %s", got)
+	}
+
+	// Renewal replaces both files
+	writeCert(t, dir, "server", "v2.internal")
+	touch(t, certFile, time.Second)
+	touch(t, keyFile, time.Second)
+	if got := commonName(t, pair.Certificate()); got != "v2.internal" {
+		t.Errorf("Expected renewed certificate v2.internal, got %s", got)
+	}
+
+	// A half-written renewal keeps the previous certificate
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	touch(t, keyFile, 2*time.Second)
+	if got := commonName(t, pair.Certificate()); got != "v2.internal" {
+		t.Errorf("Expected previous certificate to be kept, got %s", got)
+	}
+
+	if _, err := LoadKeyPair(certFile, filepath.Join(dir, "missing.key")); err == nil {
+		t.Error("Expected error for missing key file")
+	}
+}
+
+// TestServerConfig verifies client certificate modes and the minimum version
+func TestServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server", "proxy.internal")
+	caFile, _ := writeCert(t, dir, "ca", "clients-ca")
+
+	tests := []struct {
+		name       string
+		cfg        config.ServerTLSConfig
+		clientAuth tls.ClientAuthType
+		minVersion uint16
+	}{
+		{"server only", config.ServerTLSConfig{}, tls.NoClientCert, tls.VersionTLS12},
+		{"client ca defaults to require", config.ServerTLSConfig{ClientCAFile: caFile}, tls.RequireAndVerifyClientCert, tls.VersionTLS12},
+		{"optional", config.ServerTLSConfig{ClientCAFile: caFile, ClientAuth: config.TLSClientAuthOptional}, tls.VerifyClientCertIfGiven, tls.VersionTLS12},
+		{"tls 1.3", config.ServerTLSConfig{MinVersion: "1.3"}, tls.NoClientCert, tls.VersionTLS13},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.CertFile, tt.cfg.KeyFile = certFile, keyFile
+			tlsConfig, err := ServerConfig(tt.cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tlsConfig.ClientAuth != tt.clientAuth {
+				t.Errorf("Expected client auth %v, got %v", tt.clientAuth, tlsConfig.ClientAuth)
+			}
+			if tlsConfig.MinVersion != tt.minVersion {
+				t.Errorf("Expected min version %x, got %x", tt.minVersion, tlsConfig.MinVersion)
+			}
+			if (tlsConfig.ClientCAs != nil) != (tt.cfg.ClientCAFile != "") {
+				t.Error("Client CAs should be set exactly when client_ca_file is configured")
+			}
+		})
+	}
+
+	if _, err := ServerConfig(config.ServerTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile}); err == nil {
+		t.Error("Expected error for a CA bundle without certificates")
+	}
+}
+
+// TestClientConfig verifies upstream CA, client certificate, SNI and version settings
+func TestClientConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "client", "proxy-client")
+	caFile, _ := writeCert(t, dir, "ca", "models-ca")
+
+	tlsConfig, err := ClientConfig(config.UpstreamTLSConfig{
+		CAFile:     caFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "models.internal",
+		MinVersion: "1.3",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tlsConfig.RootCAs == nil || tlsConfig.ServerName != "models.internal" || tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Unexpected client config: %+v", tlsConfig)
+	}
+	cert, _ := tlsConfig.GetClientCertificate(nil)
+	if got := commonName(t, cert); got != "proxy-client" {
+		t.Errorf("Expected client certificate proxy-client, got %s", got)
+	}
+
+	if _, err := ClientConfig(config.UpstreamTLSConfig{MinVersion: "1.4"}); err == nil {
+		t.Error("Expected error for unsupported version")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"log"
 	"strconv"
+	"strings"
 
 	"github.com/jnd-labs/aiblackbox/internal/models"
 )
@@ -27,17 +28,29 @@ type openAIResponse struct {
 }
 
 // OpenAI API request structure for tool results
+// Content is kept raw because it may be a plain string or an array of content parts
 type openAIRequest struct {
 	Messages []struct {
-		Role       string `json:"role"`
-		ToolCallID string `json:"tool_call_id,omitempty"`
-		Content    string `json:"content,omitempty"`
+		Role       string          `json:"role"`
+		ToolCallID string          `json:"tool_call_id,omitempty"`
+		Content    json.RawMessage `json:"content,omitempty"`
 	} `json:"messages"`
 }
 
 // DetectToolCalls extracts OpenAI tool call information from a response body
 // Returns the first tool call found, or nil if none present
 func DetectToolCalls(responseBody string) *models.ToolCallInfo {
+	toolCalls := DetectAllToolCalls(responseBody)
+	if len(toolCalls) == 0 {
+		return nil
+	}
+	return &toolCalls[0]
+}
+
+// DetectAllToolCalls extracts every OpenAI tool call from a response body
+// Parallel tool calls across all choices are returned in order, each with its own
+// arguments hash and derived child span ID
+func DetectAllToolCalls(responseBody string) []models.ToolCallInfo {
 	if responseBody == "" {
 		return nil
 	}
@@ -48,38 +61,40 @@ func DetectToolCalls(responseBody string) *models.ToolCallInfo {
 		return nil
 	}
 
-	// Check if there are any choices with tool calls
-	if len(resp.Choices) == 0 {
-		return nil
-	}
-
-	toolCalls := resp.Choices[0].Message.ToolCalls
-	if len(toolCalls) == 0 {
-		return nil
+	var toolCalls []models.ToolCallInfo
+	for _, choice := range resp.Choices {
+		for i, tc := range choice.Message.ToolCalls {
+			toolCalls = append(toolCalls, models.ToolCallInfo{
+				ID:   tc.ID,
+				Type: tc.Type,
+				Function: models.FunctionCall{
+					Name:          tc.Function.Name,
+					Arguments:     tc.Function.Arguments,
+					ArgumentsHash: hashString(tc.Function.Arguments),
+				},
+				Index:  i,
+				SpanID: ToolCallSpanID(tc.ID),
+			})
+		}
 	}
 
-	// Extract the first tool call
-	tc := toolCalls[0]
-
-	// Compute SHA256 hash of arguments for integrity
-	argsHash := sha256.Sum256([]byte(tc.Function.Arguments))
-	argsHashStr := hex.EncodeToString(argsHash[:])
-
-	return &models.ToolCallInfo{
-		ID:   tc.ID,
-		Type: tc.Type,
-		Function: models.FunctionCall{
-			Name:          tc.Function.Name,
-			Arguments:     tc.Function.Arguments,
-			ArgumentsHash: argsHashStr,
-		},
-		Index: 0, // For now, we only track the first tool call
-	}
+	return toolCalls
 }
 
 // DetectToolResults extracts OpenAI tool result information from a request body
 // Returns the first tool result found, or nil if none present
 func DetectToolResults(requestBody string) *models.ToolResultInfo {
+	toolResults := DetectAllToolResults(requestBody)
+	if len(toolResults) == 0 {
+		return nil
+	}
+	return &toolResults[0]
+}
+
+// DetectAllToolResults extracts the OpenAI tool results answering the last assistant turn
+// Results earlier in the history were recorded by the request that first carried them
+// Each result is hashed and linked to the span of the tool call that produced it
+func DetectAllToolResults(requestBody string) []models.ToolResultInfo {
 	if requestBody == "" {
 		return nil
 	}
@@ -90,44 +105,130 @@ func DetectToolResults(requestBody string) *models.ToolResultInfo {
 		return nil
 	}
 
-	// Look for the first message with role "tool"
-	for _, msg := range req.Messages {
-		if msg.Role == "tool" && msg.ToolCallID != "" {
-			// Compute SHA256 hash of content for integrity
-			contentHash := sha256.Sum256([]byte(msg.Content))
-			contentHashStr := hex.EncodeToString(contentHash[:])
-
-			// Check if content indicates an error
-			isError := false
-			errorMessage := ""
-
-			// Try to parse content as JSON to check for error field
-			var contentObj map[string]interface{}
-			if err := json.Unmarshal([]byte(msg.Content), &contentObj); err == nil {
-				if errField, exists := contentObj["error"]; exists {
-					isError = true
-					if errStr, ok := errField.(string); ok {
-						errorMessage = errStr
-					} else {
-						// Error field exists but not a string, convert to JSON
-						if errBytes, err := json.Marshal(errField); err == nil {
-							errorMessage = string(errBytes)
-						}
+	// Only the tool messages after the last assistant message are new in this request
+	start := 0
+	for i, msg := range req.Messages {
+		if msg.Role == "assistant" {
+			start = i + 1
+		}
+	}
+
+	var toolResults []models.ToolResultInfo
+	for _, msg := range req.Messages[start:] {
+		if msg.Role != "tool" || msg.ToolCallID == "" {
+			continue
+		}
+
+		content := messageText(msg.Content)
+
+		// Check if content indicates an error
+		isError := false
+		errorMessage := ""
+
+		// Try to parse content as JSON to check for error field
+		var contentObj map[string]interface{}
+		if err := json.Unmarshal([]byte(content), &contentObj); err == nil {
+			if errField, exists := contentObj["error"]; exists {
+				isError = true
+				if errStr, ok := errField.(string); ok {
+					errorMessage = errStr
+				} else {
+					// Error field exists but not a string, convert to JSON
+					if errBytes, err := json.Marshal(errField); err == nil {
+						errorMessage = string(errBytes)
 					}
 				}
 			}
+		}
+
+		toolResults = append(toolResults, models.ToolResultInfo{
+			ToolCallID:   msg.ToolCallID,
+			Content:      content,
+			ContentHash:  hashString(content),
+			IsError:      isError,
+			ErrorMessage: errorMessage,
+			LinkedSpanID: ToolCallSpanID(msg.ToolCallID),
+		})
+	}
+
+	return toolResults
+}
 
-			return &models.ToolResultInfo{
-				ToolCallID:   msg.ToolCallID,
-				Content:      msg.Content,
-				ContentHash:  contentHashStr,
-				IsError:      isError,
-				ErrorMessage: errorMessage,
+// UserMessageTexts returns the textual content of every user message in a request body
+// Retrieved documents (RAG context) are usually inlined in these messages
+func UserMessageTexts(requestBody string) []string {
+	if requestBody == "" {
+		return nil
+	}
+
+	var req openAIRequest
+	if err := json.Unmarshal([]byte(requestBody), &req); err != nil {
+		return nil
+	}
+
+	var texts []string
+	for _, msg := range req.Messages {
+		if msg.Role == "user" {
+			if text := messageText(msg.Content); text != "" {
+				texts = append(texts, text)
 			}
 		}
 	}
+	return texts
+}
+
+// ToolCallSpanID derives the child span ID for a tool call from its call ID
+// The derivation is deterministic so that the TOOL_RESULT entry of a later request
+// links to the same span without the proxy keeping any state between requests
+func ToolCallSpanID(toolCallID string) string {
+	if toolCallID == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte("tool_call:" + toolCallID))
+	return hex.EncodeToString(hash[:8]) // 64-bit span ID
+}
+
+// AttemptSpanID derives the child span ID of an upstream attempt from the request's span ID
+// Attempts are numbered from 1 in the order they were sent
+func AttemptSpanID(spanID string, attempt int) string {
+	if spanID == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte("attempt:" + spanID + ":" + strconv.Itoa(attempt)))
+	return hex.EncodeToString(hash[:8]) // 64-bit span ID
+}
+
+// messageText returns the textual content of a chat message
+// Handles both plain string content and arrays of {"type":"text","text":...} parts
+func messageText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err == nil {
+		var builder strings.Builder
+		for _, part := range parts {
+			builder.WriteString(part.Text)
+		}
+		return builder.String()
+	}
 
-	return nil
+	return string(raw)
+}
+
+// hashString returns the hex-encoded SHA256 of a string
+func hashString(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
 }
 
 // DetermineSpanType determines the span type based on request and response content
@@ -197,37 +298,58 @@ func EnrichTraceContext(trace *models.TraceContext, requestBody, responseBody st
 		trace.Attributes = make(map[string]string)
 	}
 
-	// Detect tool calls in response
-	toolCall := DetectToolCalls(responseBody)
-	if toolCall != nil {
+	// Detect tool results in request
+	// Recorded even when the response makes new tool calls (the usual agent loop),
+	// so every result the model acted on is covered by the hash chain
+	toolResults := DetectAllToolResults(requestBody)
+	if len(toolResults) > 0 {
+		trace.ToolResult = &toolResults[0]
+		trace.ToolResults = toolResults
+
+		// Add attributes for linking
+		anyError := false
+		for _, tr := range toolResults {
+			anyError = anyError || tr.IsError
+		}
+		trace.Attributes["tool_result_count"] = intToString(len(toolResults))
+		trace.Attributes["is_error"] = boolToString(anyError)
+		trace.Attributes["detection"] = "auto"
+
+		log.Printf("INFO: Detected tool results: trace=%s, span=%s, call_id=%s, count=%d, is_error=%v",
+			trace.TraceID, trace.SpanID, trace.ToolResult.ToolCallID, len(toolResults), anyError)
+	}
+
+	// Detect tool calls in response; they determine the span type
+	toolCalls := DetectAllToolCalls(responseBody)
+	if len(toolCalls) > 0 {
+		toolCall := &toolCalls[0]
 		trace.ToolCall = toolCall
+		trace.ToolCalls = toolCalls
 		trace.SpanType = models.SpanTypeToolCall
 		trace.SpanName = GenerateSpanName(models.SpanTypeToolCall, toolCall, nil)
 
 		// Add attributes for searchability
 		trace.Attributes["tool_name"] = toolCall.Function.Name
 		trace.Attributes["tool_call_id"] = toolCall.ID
+		trace.Attributes["tool_call_count"] = intToString(len(toolCalls))
 		trace.Attributes["detection"] = "auto"
+		if len(toolCalls) > 1 {
+			names := make([]string, len(toolCalls))
+			for i, tc := range toolCalls {
+				names[i] = tc.Function.Name
+			}
+			trace.Attributes["tool_names"] = strings.Join(names, ",")
+		}
 
-		log.Printf("INFO: Detected tool call: trace=%s, span=%s, tool=%s, call_id=%s",
-			trace.TraceID, trace.SpanID, toolCall.Function.Name, toolCall.ID)
+		log.Printf("INFO: Detected tool calls: trace=%s, span=%s, tool=%s, call_id=%s, count=%d",
+			trace.TraceID, trace.SpanID, toolCall.Function.Name, toolCall.ID, len(toolCalls))
 		return
 	}
 
-	// Detect tool results in request
-	toolResult := DetectToolResults(requestBody)
-	if toolResult != nil {
-		trace.ToolResult = toolResult
+	if trace.ToolResult != nil {
 		trace.SpanType = models.SpanTypeToolResult
-		trace.SpanName = GenerateSpanName(models.SpanTypeToolResult, nil, toolResult)
-
-		// Add attributes for linking
-		trace.Attributes["tool_call_id"] = toolResult.ToolCallID
-		trace.Attributes["is_error"] = boolToString(toolResult.IsError)
-		trace.Attributes["detection"] = "auto"
-
-		log.Printf("INFO: Detected tool result: trace=%s, span=%s, call_id=%s, is_error=%v",
-			trace.TraceID, trace.SpanID, toolResult.ToolCallID, toolResult.IsError)
+		trace.SpanName = GenerateSpanName(models.SpanTypeToolResult, nil, trace.ToolResult)
+		trace.Attributes["tool_call_id"] = trace.ToolResult.ToolCallID
 		return
 	}
 
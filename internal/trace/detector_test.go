@@ -476,3 +476,187 @@ func TestEnrichTraceContext_FinalResponse(t *testing.T) {
 		t.Error("Expected ToolResult to be nil for final response")
 	}
 }
+
+// TestDetectAllToolCalls_Parallel verifies every parallel tool call is returned with its own hash and span
+func TestDetectAllToolCalls_Parallel(t *testing.T) {
+	responseBody := `{
+		"choices": [{
+			"message": {
+				"tool_calls": [
+					{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}},
+					{"id": "call_2", "type": "function", "function": {"name": "get_time", "arguments": "{}"}},
+					{"id": "call_3", "type": "function", "function": {"name": "search", "arguments": "{\"q\":\"go\"}"}}
+				]
+			}
+		}]
+	}`
+
+	toolCalls := DetectAllToolCalls(responseBody)
+
+	if len(toolCalls) != 3 {
+		t.Fatalf("Expected 3 tool calls, got %d", len(toolCalls))
+	}
+
+	seenSpans := make(map[string]bool)
+	for i, tc := range toolCalls {
+		if tc.Index != i {
+			t.Errorf("Tool call %d: expected index %d, got %d", i, i, tc.Index)
+		}
+		if tc.Function.ArgumentsHash == "" {
+			t.Errorf("Tool call %d: expected arguments hash", i)
+		}
+		if tc.SpanID == "" || len(tc.SpanID) != 16 {
+			t.Errorf("Tool call %d: expected 16-char child span ID, got %q", i, tc.SpanID)
+		}
+		if seenSpans[tc.SpanID] {
+			t.Errorf("Tool call %d: duplicate child span ID %s", i, tc.SpanID)
+		}
+		seenSpans[tc.SpanID] = true
+	}
+
+	if toolCalls[2].Function.Name != "search" {
+		t.Errorf("Expected third tool 'search', got '%s'", toolCalls[2].Function.Name)
+	}
+}
+
+// TestDetectAllToolResults_Multiple verifies every tool result is returned and linked to its call span
+func TestDetectAllToolResults_Multiple(t *testing.T) {
+	requestBody := `{
+		"messages": [
+			{"role": "user", "content": "Weather and time?"},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1"}, {"id": "call_2"}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "{\"temp\": 20}"},
+			{"role": "tool", "tool_call_id": "call_2", "content": [{"type": "text", "text": "12:00"}]}
+		]
+	}`
+
+	toolResults := DetectAllToolResults(requestBody)
+
+	if len(toolResults) != 2 {
+		t.Fatalf("Expected 2 tool results, got %d", len(toolResults))
+	}
+
+	if toolResults[1].ToolCallID != "call_2" {
+		t.Errorf("Expected second result for 'call_2', got '%s'", toolResults[1].ToolCallID)
+	}
+
+	if toolResults[1].Content != "12:00" {
+		t.Errorf("Expected content parts to be flattened, got '%s'", toolResults[1].Content)
+	}
+
+	for i, tr := range toolResults {
+		if tr.LinkedSpanID != ToolCallSpanID(tr.ToolCallID) {
+			t.Errorf("Tool result %d: linked span %s does not match tool call span", i, tr.LinkedSpanID)
+		}
+		if tr.ContentHash == "" {
+			t.Errorf("Tool result %d: expected content hash", i)
+		}
+	}
+}
+
+// TestEnrichTraceContext_ParallelToolCalls verifies all tool calls are recorded on the trace
+func TestEnrichTraceContext_ParallelToolCalls(t *testing.T) {
+	trace := &models.TraceContext{
+		TraceID: "trace123",
+		SpanID:  "span456",
+	}
+
+	responseBody := `{
+		"choices": [{
+			"message": {
+				"tool_calls": [
+					{"id": "call_a", "type": "function", "function": {"name": "tool_a", "arguments": "{}"}},
+					{"id": "call_b", "type": "function", "function": {"name": "tool_b", "arguments": "{}"}}
+				]
+			}
+		}]
+	}`
+
+	EnrichTraceContext(trace, `{"messages": []}`, responseBody)
+
+	if len(trace.ToolCalls) != 2 {
+		t.Fatalf("Expected 2 tool calls on trace, got %d", len(trace.ToolCalls))
+	}
+
+	if trace.ToolCall == nil || trace.ToolCall.ID != "call_a" {
+		t.Error("Expected ToolCall to remain the first tool call")
+	}
+
+	if trace.Attributes["tool_call_count"] != "2" {
+		t.Errorf("Expected tool_call_count '2', got '%s'", trace.Attributes["tool_call_count"])
+	}
+
+	if trace.Attributes["tool_names"] != "tool_a,tool_b" {
+		t.Errorf("Expected tool_names 'tool_a,tool_b', got '%s'", trace.Attributes["tool_names"])
+	}
+}
+
+// TestDetectAllToolResults_History verifies results from earlier turns are not recorded again
+func TestDetectAllToolResults_History(t *testing.T) {
+	requestBody := `{
+		"messages": [
+			{"role": "user", "content": "Plan my trip"},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1"}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "{\"flights\": 3}"},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_2"}, {"id": "call_3"}]},
+			{"role": "tool", "tool_call_id": "call_2", "content": "{\"hotels\": 5}"},
+			{"role": "tool", "tool_call_id": "call_3", "content": "{\"cars\": 2}"}
+		]
+	}`
+
+	toolResults := DetectAllToolResults(requestBody)
+	if len(toolResults) != 2 || toolResults[0].ToolCallID != "call_2" || toolResults[1].ToolCallID != "call_3" {
+		t.Fatalf("Expected only the results of the last turn, got %+v", toolResults)
+	}
+
+	// Once the model answered, the results are history
+	requestBody = `{
+		"messages": [
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1"}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "{}"},
+			{"role": "assistant", "content": "Done"},
+			{"role": "user", "content": "Thanks"}
+		]
+	}`
+	if toolResults := DetectAllToolResults(requestBody); len(toolResults) != 0 {
+		t.Errorf("Expected no new tool results, got %+v", toolResults)
+	}
+}
+
+// TestEnrichTraceContext_ToolResultsWithToolCalls verifies tool results are recorded when the response makes new tool calls
+func TestEnrichTraceContext_ToolResultsWithToolCalls(t *testing.T) {
+	trace := &models.TraceContext{
+		TraceID: "trace123",
+		SpanID:  "span456",
+	}
+
+	requestBody := `{
+		"messages": [
+			{"role": "user", "content": "Plan my trip"},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1"}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "{\"flights\": 3}"}
+		]
+	}`
+	responseBody := `{
+		"choices": [{
+			"message": {
+				"tool_calls": [{"id": "call_2", "type": "function", "function": {"name": "book_hotel", "arguments": "{}"}}]
+			}
+		}]
+	}`
+
+	EnrichTraceContext(trace, requestBody, responseBody)
+
+	if trace.SpanType != models.SpanTypeToolCall || trace.SpanName != "book_hotel" {
+		t.Errorf("Expected the tool call span, got %s/%s", trace.SpanType, trace.SpanName)
+	}
+	if len(trace.ToolCalls) != 1 || trace.ToolCall.ID != "call_2" {
+		t.Errorf("Expected the new tool call, got %+v", trace.ToolCalls)
+	}
+	if len(trace.ToolResults) != 1 || trace.ToolResult == nil || trace.ToolResult.ToolCallID != "call_1" {
+		t.Fatalf("Expected the tool result of the request, got %+v", trace.ToolResults)
+	}
+	if trace.Attributes["tool_call_id"] != "call_2" || trace.Attributes["tool_result_count"] != "1" {
+		t.Errorf("Unexpected attributes %v", trace.Attributes)
+	}
+}
@@ -0,0 +1,146 @@
+package usage
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+)
+
+// providerUsage covers the usage block of OpenAI Chat Completions, OpenAI Responses and Anthropic Messages
+type providerUsage struct {
+	// OpenAI Chat Completions
+	PromptTokens            *int64       `json:"prompt_tokens"`
+	CompletionTokens        *int64       `json:"completion_tokens"`
+	PromptTokensDetails     tokenDetails `json:"prompt_tokens_details"`
+	CompletionTokensDetails tokenDetails `json:"completion_tokens_details"`
+
+	// OpenAI Responses and Anthropic Messages
+	InputTokens         *int64       `json:"input_tokens"`
+	OutputTokens        *int64       `json:"output_tokens"`
+	InputTokensDetails  tokenDetails `json:"input_tokens_details"`
+	OutputTokensDetails tokenDetails `json:"output_tokens_details"`
+
+	// Anthropic reports cache traffic separately from input_tokens
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+}
+
+type tokenDetails struct {
+	CachedTokens    int64 `json:"cached_tokens"`
+	ReasoningTokens int64 `json:"reasoning_tokens"`
+}
+
+// usageEnvelope is the part of a request or response body relevant for accounting
+type usageEnvelope struct {
+	Model string         `json:"model"`
+	Usage *providerUsage `json:"usage"`
+}
+
+// Extract reads the token usage from a response body (regular or reconstructed stream)
+// The model falls back to the one named in the request body
+// Returns nil if the response carries no usage block
+func Extract(requestBody, responseBody string) *models.TokenUsage {
+	if responseBody == "" {
+		return nil
+	}
+
+	var resp usageEnvelope
+	if err := json.Unmarshal([]byte(responseBody), &resp); err != nil || resp.Usage == nil {
+		// Not JSON or no usage reported (errors, streams without include_usage)
+		return nil
+	}
+
+	u := resp.Usage
+	result := &models.TokenUsage{Model: resp.Model}
+
+	switch {
+	case u.PromptTokens != nil || u.CompletionTokens != nil:
+		result.PromptTokens = valueOf(u.PromptTokens)
+		result.CompletionTokens = valueOf(u.CompletionTokens)
+		result.CachedTokens = u.PromptTokensDetails.CachedTokens
+		result.ReasoningTokens = u.CompletionTokensDetails.ReasoningTokens
+	case u.InputTokens != nil || u.OutputTokens != nil:
+		// Anthropic input_tokens excludes cache reads and writes; the Responses API includes them
+		result.PromptTokens = valueOf(u.InputTokens) + u.CacheReadInputTokens + u.CacheCreationInputTokens
+		result.CompletionTokens = valueOf(u.OutputTokens)
+		result.CachedTokens = u.InputTokensDetails.CachedTokens + u.CacheReadInputTokens
+		result.ReasoningTokens = u.OutputTokensDetails.ReasoningTokens
+	default:
+		return nil
+	}
+	result.TotalTokens = result.PromptTokens + result.CompletionTokens
+
+	if result.Model == "" && requestBody != "" {
+		var req usageEnvelope
+		if err := json.Unmarshal([]byte(requestBody), &req); err == nil {
+			result.Model = req.Model
+		}
+	}
+
+	return result
+}
+
+func valueOf(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// PriceTable computes call costs from the configured per-model prices
+type PriceTable struct {
+	prices []config.ModelPrice
+}
+
+// NewPriceTable creates a price table from the pricing config
+func NewPriceTable(prices []config.ModelPrice) *PriceTable {
+	return &PriceTable{prices: prices}
+}
+
+// Lookup finds the price entry for a model
+// Exact matches win, otherwise the longest entry that prefixes the model name
+func (t *PriceTable) Lookup(model string) (config.ModelPrice, bool) {
+	var best config.ModelPrice
+	found := false
+	for _, p := range t.prices {
+		if p.Model == model {
+			return p, true
+		}
+		if strings.HasPrefix(model, p.Model) && len(p.Model) > len(best.Model) {
+			best = p
+			found = true
+		}
+	}
+	return best, found
+}
+
+// Apply sets CostUSD and PricedAs on usage if a price is configured for its model
+func (t *PriceTable) Apply(usage *models.TokenUsage) {
+	if usage == nil || usage.Model == "" {
+		return
+	}
+
+	price, ok := t.Lookup(usage.Model)
+	if !ok {
+		return
+	}
+
+	cachedPrice := price.InputPerMillion
+	if price.CachedInputPerMillion != nil {
+		cachedPrice = *price.CachedInputPerMillion
+	}
+
+	uncached := usage.PromptTokens - usage.CachedTokens
+	cost := (float64(uncached)*price.InputPerMillion +
+		float64(usage.CachedTokens)*cachedPrice +
+		float64(usage.CompletionTokens)*price.OutputPerMillion) / 1e6
+
+	// Round away floating point noise (1e-10 USD precision)
+	cost = math.Round(cost*1e10) / 1e10
+
+	usage.CostUSD = &cost
+	usage.PricedAs = price.Model
+}
@@ -0,0 +1,129 @@
+package usage
+
+import (
+	"testing"
+
+	"github.com/jnd-labs/aiblackbox/internal/config"
+	"github.com/jnd-labs/aiblackbox/internal/models"
+)
+
+// TestExtractOpenAIChatUsage verifies Chat Completions usage with cached and reasoning details
+func TestExtractOpenAIChatUsage(t *testing.T) {
+	resp := `{"id":"chatcmpl-1","model":"gpt-4o-2024-08-06","choices":[],"usage":{"prompt_tokens":1200,"completion_tokens":300,"total_tokens":1500,"prompt_tokens_details":{"cached_tokens":1000},"completion_tokens_details":{"reasoning_tokens":120}}}`
+
+	u := Extract(`{"model":"gpt-4o"}`, resp)
+	if u == nil {
+		t.Fatal("Expected usage, got nil")
+	}
+
+	expected := models.TokenUsage{
+		Model:            "gpt-4o-2024-08-06",
+		PromptTokens:     1200,
+		CompletionTokens: 300,
+		TotalTokens:      1500,
+		CachedTokens:     1000,
+		ReasoningTokens:  120,
+	}
+	if *u != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *u)
+	}
+}
+
+// TestExtractAnthropicUsage verifies cache reads and writes are folded into prompt tokens
+func TestExtractAnthropicUsage(t *testing.T) {
+	resp := `{"id":"msg_1","type":"message","usage":{"input_tokens":50,"output_tokens":20,"cache_read_input_tokens":400,"cache_creation_input_tokens":100}}`
+
+	u := Extract(`{"model":"claude-sonnet-4"}`, resp)
+	if u == nil {
+		t.Fatal("Expected usage, got nil")
+	}
+
+	if u.Model != "claude-sonnet-4" {
+		t.Errorf("Expected model from request, got %q", u.Model)
+	}
+	if u.PromptTokens != 550 || u.CachedTokens != 400 || u.CompletionTokens != 20 || u.TotalTokens != 570 {
+		t.Errorf("Unexpected usage: %+v", *u)
+	}
+}
+
+// TestExtractResponsesAPIUsage verifies the OpenAI Responses API usage shape
+func TestExtractResponsesAPIUsage(t *testing.T) {
+	resp := `{"id":"resp_1","model":"o3","usage":{"input_tokens":800,"input_tokens_details":{"cached_tokens":200},"output_tokens":500,"output_tokens_details":{"reasoning_tokens":450},"total_tokens":1300}}`
+
+	u := Extract("", resp)
+	if u == nil {
+		t.Fatal("Expected usage, got nil")
+	}
+	if u.PromptTokens != 800 || u.CachedTokens != 200 || u.CompletionTokens != 500 || u.ReasoningTokens != 450 {
+		t.Errorf("Unexpected usage: %+v", *u)
+	}
+}
+
+// TestExtractNoUsage verifies responses without usage are ignored
+func TestExtractNoUsage(t *testing.T) {
+	tests := []string{
+		"",
+		"not json",
+		`{"error":{"message":"rate limited"}}`,
+		`{"usage":{}}`,
+	}
+
+	for _, body := range tests {
+		if u := Extract(`{"model":"gpt-4o"}`, body); u != nil {
+			t.Errorf("Expected nil usage for %q, got %+v", body, *u)
+		}
+	}
+}
+
+// TestPriceTableApply verifies cost computation and model matching
+func TestPriceTableApply(t *testing.T) {
+	cachedPrice := 1.25
+	table := NewPriceTable([]config.ModelPrice{
+		{Model: "gpt-4o", InputPerMillion: 2.5, CachedInputPerMillion: &cachedPrice, OutputPerMillion: 10},
+		{Model: "gpt-4o-mini", InputPerMillion: 0.15, OutputPerMillion: 0.6},
+	})
+
+	tests := []struct {
+		name     string
+		usage    models.TokenUsage
+		pricedAs string
+		cost     float64
+	}{
+		{
+			name:     "prefix match with cached tokens",
+			usage:    models.TokenUsage{Model: "gpt-4o-2024-08-06", PromptTokens: 1200, CachedTokens: 1000, CompletionTokens: 300},
+			pricedAs: "gpt-4o",
+			cost:     (200*2.5 + 1000*1.25 + 300*10) / 1e6,
+		},
+		{
+			name:     "longest prefix wins",
+			usage:    models.TokenUsage{Model: "gpt-4o-mini-2024-07-18", PromptTokens: 1000, CachedTokens: 500, CompletionTokens: 1000},
+			pricedAs: "gpt-4o-mini",
+			cost:     (1000*0.15 + 1000*0.6) / 1e6, // Cached tokens billed at the input price
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := tt.usage
+			table.Apply(&u)
+
+			if u.CostUSD == nil {
+				t.Fatal("Expected cost to be set")
+			}
+			if u.PricedAs != tt.pricedAs {
+				t.Errorf("Expected priced as %q, got %q", tt.pricedAs, u.PricedAs)
+			}
+			if diff := *u.CostUSD - tt.cost; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("Expected cost %v, got %v", tt.cost, *u.CostUSD)
+			}
+		})
+	}
+
+	// Unknown models are left unpriced
+	unknown := models.TokenUsage{Model: "llama3", PromptTokens: 10}
+	table.Apply(&unknown)
+	if unknown.CostUSD != nil {
+		t.Errorf("Expected no cost for unknown model, got %v", *unknown.CostUSD)
+	}
+}